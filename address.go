@@ -0,0 +1,343 @@
+package netki
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/sha3"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// Network selects which address formats of a currency are accepted
+type Network int
+
+const (
+	Mainnet Network = iota
+	Testnet
+)
+
+func (n Network) String() string {
+	if n == Testnet {
+		return "testnet"
+	}
+	return "mainnet"
+}
+
+// AddressValidator checks that an address is well formed for a network
+type AddressValidator interface {
+	ValidateAddress(address string, network Network) error
+}
+
+// AddressValidatorFunc adapts a function to an AddressValidator
+type AddressValidatorFunc func(address string, network Network) error
+
+func (f AddressValidatorFunc) ValidateAddress(address string, network Network) error {
+	return f(address, network)
+}
+
+// AddressError is returned when a wallet address fails validation
+type AddressError struct {
+	Currency string
+	Address  string
+	Err      error
+}
+
+func (e *AddressError) Error() string {
+	return fmt.Sprintf("Invalid %s Address %q: %s", e.Currency, e.Address, e.Err)
+}
+
+func (e *AddressError) Unwrap() error {
+	return e.Err
+}
+
+func (e *AddressError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+var (
+	addressValidatorsMu sync.RWMutex
+	addressValidators   = map[string]AddressValidator{
+		"btc": AnyAddressValidator{
+			SegwitValidator{HRP: map[Network]string{Mainnet: "bc", Testnet: "tb"}},
+			Base58CheckValidator{Versions: map[Network][]byte{Mainnet: {0x00, 0x05}, Testnet: {0x6f, 0xc4}}},
+		},
+		"tbtc": AnyAddressValidator{
+			SegwitValidator{HRP: map[Network]string{Mainnet: "tb", Testnet: "tb"}},
+			Base58CheckValidator{Versions: map[Network][]byte{Mainnet: {0x6f, 0xc4}, Testnet: {0x6f, 0xc4}}},
+		},
+		"ltc": AnyAddressValidator{
+			SegwitValidator{HRP: map[Network]string{Mainnet: "ltc", Testnet: "tltc"}},
+			Base58CheckValidator{Versions: map[Network][]byte{Mainnet: {0x30, 0x32, 0x05}, Testnet: {0x6f, 0x3a, 0xc4}}},
+		},
+		"dgc": Base58CheckValidator{Versions: map[Network][]byte{Mainnet: {0x1e, 0x16}, Testnet: {0x71, 0xc4}}},
+		"eth": EIP55Validator{},
+	}
+)
+
+// RegisterAddressValidator sets the validator used for a currency code,
+// replacing any built-in one. A nil validator disables validation of the currency.
+func RegisterAddressValidator(currency string, validator AddressValidator) {
+	addressValidatorsMu.Lock()
+	defer addressValidatorsMu.Unlock()
+	if validator == nil {
+		delete(addressValidators, NormalizeCurrency(currency))
+		return
+	}
+	addressValidators[NormalizeCurrency(currency)] = validator
+}
+
+// ValidateAddress checks address with the validator registered for currency.
+// Currencies without a validator are accepted as is.
+func ValidateAddress(currency string, address string, network Network) error {
+	addressValidatorsMu.RLock()
+	validator, ok := addressValidators[NormalizeCurrency(currency)]
+	addressValidatorsMu.RUnlock()
+	if !ok {
+		return nil
+	}
+	if err := validator.ValidateAddress(address, network); err != nil {
+		return &AddressError{Currency: currency, Address: address, Err: err}
+	}
+	return nil
+}
+
+// Validate checks every wallet address of the Wallet Name for network
+func (w WalletName) Validate(network Network) error {
+	for _, wallet := range w.Wallets {
+		if err := ValidateAddress(wallet.Currency, wallet.WalletAddress, network); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AnyAddressValidator accepts addresses accepted by any of its validators,
+// reporting the first validator's error otherwise
+type AnyAddressValidator []AddressValidator
+
+func (v AnyAddressValidator) ValidateAddress(address string, network Network) error {
+	var first error
+	for _, validator := range v {
+		err := validator.ValidateAddress(address, network)
+		if err == nil {
+			return nil
+		}
+		// Prefer the error of a validator that recognised the format
+		if first == nil || errors.Is(first, errAddressFormat) {
+			first = err
+		}
+	}
+	if first == nil {
+		return errAddressFormat
+	}
+	return first
+}
+
+// errAddressFormat is reported when an address is not in a validator's format at all
+var errAddressFormat = errors.New("unrecognised address format")
+
+// Base58CheckValidator validates Base58Check encoded addresses with a one byte
+// version prefix and a 20 byte hash, as used by Bitcoin and its forks
+type Base58CheckValidator struct {
+	// Versions are the version bytes accepted on each network
+	Versions map[Network][]byte
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func (v Base58CheckValidator) ValidateAddress(address string, network Network) error {
+	decoded, err := base58Decode(address)
+	if err != nil {
+		return err
+	}
+	if len(decoded) != 25 {
+		return fmt.Errorf("bad length %d", len(decoded))
+	}
+
+	payload, checksum := decoded[:21], decoded[21:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !bytes.Equal(second[:4], checksum) {
+		return errors.New("bad checksum")
+	}
+	if bytes.IndexByte(v.Versions[network], payload[0]) < 0 {
+		for other, versions := range v.Versions {
+			if bytes.IndexByte(versions, payload[0]) >= 0 {
+				return fmt.Errorf("address is for %s", other)
+			}
+		}
+		return fmt.Errorf("unknown version 0x%02x", payload[0])
+	}
+	return nil
+}
+
+func base58Decode(s string) ([]byte, error) {
+	if s == "" {
+		return nil, errAddressFormat
+	}
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		digit := strings.IndexRune(base58Alphabet, c)
+		if digit < 0 {
+			return nil, errAddressFormat
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+
+	// Each leading '1' encodes a leading zero byte
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), nil
+}
+
+// SegwitValidator validates BIP173 (Bech32) and BIP350 (Bech32m) segwit addresses
+type SegwitValidator struct {
+	// HRP is the human readable part expected on each network, e.g. "bc"
+	HRP map[Network]string
+}
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+const (
+	bech32Const  = 1
+	bech32mConst = 0x2bc830a3
+)
+
+func (v SegwitValidator) ValidateAddress(address string, network Network) error {
+	lower := strings.ToLower(address)
+	separator := strings.LastIndex(lower, "1")
+	if separator < 1 || len(lower) > 90 || separator+7 > len(lower) {
+		return errAddressFormat
+	}
+	hrp := lower[:separator]
+	if hrp != v.HRP[network] {
+		for other, otherHRP := range v.HRP {
+			if hrp == otherHRP {
+				return fmt.Errorf("address is for %s", other)
+			}
+		}
+		return errAddressFormat
+	}
+	if address != lower && address != strings.ToUpper(address) {
+		return errors.New("mixed case")
+	}
+
+	data := make([]byte, 0, len(lower)-separator-1)
+	for _, c := range lower[separator+1:] {
+		digit := strings.IndexRune(bech32Charset, c)
+		if digit < 0 {
+			return fmt.Errorf("invalid character %q", c)
+		}
+		data = append(data, byte(digit))
+	}
+
+	checksum := bech32Polymod(append(bech32HRPExpand(hrp), data...))
+	data = data[:len(data)-6]
+	if len(data) == 0 {
+		return errors.New("missing witness version")
+	}
+	version := data[0]
+	if version > 16 {
+		return fmt.Errorf("bad witness version %d", version)
+	}
+	if (version == 0 && checksum != bech32Const) || (version != 0 && checksum != bech32mConst) {
+		return errors.New("bad checksum")
+	}
+
+	program, err := convertBits(data[1:], 5, 8)
+	if err != nil {
+		return err
+	}
+	if len(program) < 2 || len(program) > 40 {
+		return fmt.Errorf("bad witness program length %d", len(program))
+	}
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		return fmt.Errorf("bad witness program length %d", len(program))
+	}
+	return nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// convertBits regroups 5 bit words into bytes, rejecting non-zero padding
+func convertBits(data []byte, from uint, to uint) ([]byte, error) {
+	acc, bits := uint32(0), uint(0)
+	maxv := uint32(1)<<to - 1
+	out := make([]byte, 0, len(data)*int(from)/int(to))
+	for _, value := range data {
+		acc = acc<<from | uint32(value)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if bits >= from || (acc<<(to-bits))&maxv != 0 {
+		return nil, errors.New("bad padding")
+	}
+	return out, nil
+}
+
+// EIP55Validator validates Ethereum addresses. Mixed case addresses must
+// carry a valid EIP-55 checksum; all lower or upper case ones have none.
+type EIP55Validator struct{}
+
+func (v EIP55Validator) ValidateAddress(address string, network Network) error {
+	if !strings.HasPrefix(address, "0x") || len(address) != 42 {
+		return errAddressFormat
+	}
+	hexPart := address[2:]
+	if _, err := hex.DecodeString(hexPart); err != nil {
+		return errAddressFormat
+	}
+	if hexPart == strings.ToLower(hexPart) || hexPart == strings.ToUpper(hexPart) {
+		return nil
+	}
+
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(strings.ToLower(hexPart)))
+	digest := hash.Sum(nil)
+	for i, c := range hexPart {
+		nibble := digest[i/2] >> 4
+		if i%2 == 1 {
+			nibble = digest[i/2] & 0x0f
+		}
+		if c >= 'a' && c <= 'f' && nibble >= 8 || c >= 'A' && c <= 'F' && nibble < 8 {
+			return errors.New("bad checksum")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package netki
+
+import (
+	"errors"
+	"github.com/bmizerany/assert"
+	"strings"
+	"testing"
+)
+
+func TestValidateAddress(t *testing.T) {
+	valid := []struct {
+		currency string
+		address  string
+		network  Network
+	}{
+		{"btc", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", Mainnet},
+		{"btc", "31hANjYptKcgNw8JZtfZabsqqKRKak39vG", Mainnet},
+		{"BTC", "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", Mainnet},
+		{"btc", "bc1pqqqsyqcyq5rqwzqfpg9scrgwpugpzysnzs23v9ccrydpk8qarc0sg5tmnz", Mainnet},
+		{"btc", "mfX6kF9N9SjZ4suVAMyLytjEYnjJwmfKdF", Testnet},
+		{"btc", "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", Testnet},
+		{"tbtc", "mfX6kF9N9SjZ4suVAMyLytjEYnjJwmfKdF", Mainnet},
+		{"ltc", "LKE6iQNDR5YMYa82cvzGRzafu1Vt65SJJt", Mainnet},
+		{"ltc", "ltc1qw508d6qejxtdg4y5r3zarvary0c5xw7kgmn4n9", Mainnet},
+		{"dgc", "D59EzT12dqCapmcUBNzXhjgWZvruJ175AZ", Mainnet},
+		{"dgc", "nUCJiTjwZofJhkBfDCdyx9GoooFCLfVetZ", Testnet},
+		{"eth", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", Mainnet},
+		{"eth", "0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359", Mainnet},
+		{"xyz", "anything goes", Mainnet},
+	}
+	for _, v := range valid {
+		assert.Equal(t, nil, ValidateAddress(v.currency, v.address, v.network), v.address)
+	}
+
+	invalid := []struct {
+		currency string
+		address  string
+		network  Network
+		reason   string
+	}{
+		{"btc", "1dgkjsdfhlkjfsdhkjlsdfhsgdf", Mainnet, "unrecognised address format"},
+		{"btc", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN3", Mainnet, "bad checksum"},
+		{"btc", "mfX6kF9N9SjZ4suVAMyLytjEYnjJwmfKdF", Mainnet, "address is for testnet"},
+		{"btc", "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7", Mainnet, "address is for testnet"},
+		{"btc", "bc1pqqqsyqcyq5rqwzqfpg9scrgwpugpzysnzs23v9ccrydpk8qarc0sagmhkq", Mainnet, "bad checksum"},
+		{"btc", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7Kv8f3t4", Mainnet, "mixed case"},
+		{"btc", "0Ol", Mainnet, "unrecognised address format"},
+		{"ltc", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", Mainnet, "unknown version 0x00"},
+		{"dgc", "D548376529834756928376523", Mainnet, "bad length 19"},
+		{"eth", "0x5AAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", Mainnet, "bad checksum"},
+		{"eth", "5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", Mainnet, "unrecognised address format"},
+	}
+	for _, v := range invalid {
+		err := ValidateAddress(v.currency, v.address, v.network)
+		assert.NotEqual(t, nil, err, v.address)
+		addrErr, ok := err.(*AddressError)
+		assert.Equal(t, true, ok)
+		assert.Equal(t, v.reason, addrErr.Err.Error(), v.address)
+		assert.Equal(t, true, errors.Is(err, ErrValidation))
+	}
+
+	err := ValidateAddress("btc", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN3", Mainnet)
+	assert.Equal(t, `Invalid btc Address "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN3": bad checksum`, err.Error())
+}
+
+func TestRegisterAddressValidator(t *testing.T) {
+	RegisterAddressValidator("XMPL", AddressValidatorFunc(func(address string, network Network) error {
+		if !strings.HasPrefix(address, "xmpl:") {
+			return errors.New("missing xmpl: prefix")
+		}
+		return nil
+	}))
+	defer RegisterAddressValidator("xmpl", nil)
+
+	assert.Equal(t, nil, ValidateAddress("xmpl", "xmpl:abc", Mainnet))
+	assert.Equal(t, `Invalid xmpl Address "abc": missing xmpl: prefix`, ValidateAddress("xmpl", "abc", Mainnet).Error())
+
+	RegisterAddressValidator("xmpl", nil)
+	assert.Equal(t, nil, ValidateAddress("xmpl", "abc", Mainnet))
+}
+
+func TestWalletNameSaveValidatesAddresses(t *testing.T) {
+	mockRequester := getMockRequester(`{"wallet_names":[{"id":"newId"}]}`, nil)
+	partner := &NetkiPartner{Requester: mockRequester}
+
+	wn := getWalletName()
+	wn.SetCurrencyAddress("dgc", "D548376529834756928376523")
+	err := wn.Save(partner)
+	assert.Equal(t, `Invalid dgc Address "D548376529834756928376523": bad length 19`, err.Error())
+	assert.Equal(t, "", mockRequester.calledUri)
+
+	partner.SkipAddressValidation = true
+	assert.Equal(t, nil, wn.Save(partner))
+	assert.Equal(t, "newId", wn.Id)
+
+	wn = getWalletName()
+	wn.SetCurrencyAddress("btc", "mfX6kF9N9SjZ4suVAMyLytjEYnjJwmfKdF")
+	partner = &NetkiPartner{Requester: mockRequester, Network: Testnet}
+	assert.Equal(t, nil, wn.Save(partner))
+}
+
+func TestSaveWalletNamesValidatesAddresses(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{
+		{returnData: `{"wallet_names":[{"id":"id0"}]}`},
+	}}
+	partner := &NetkiPartner{Requester: mockRequester}
+
+	walletNames := getBatchWalletNames(2)
+	walletNames[1].SetCurrencyAddress("btc", "1bad")
+	err := partner.SaveWalletNames(walletNames)
+
+	batchErr, ok := err.(*BatchError)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, 1, len(batchErr.Failures))
+	assert.Equal(t, 1, batchErr.Failures[0].Index)
+	assert.Equal(t, true, errors.Is(batchErr.Failures[0].Err, ErrValidation))
+	assert.Equal(t, 1, len(mockRequester.calls))
+	assert.Equal(t, "id0", walletNames[0].Id)
+}
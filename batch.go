@@ -0,0 +1,233 @@
+package netki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DefaultMaxBatchSize is the number of wallet names sent per request when
+// NetkiPartner.MaxBatchSize is not set
+const DefaultMaxBatchSize = 100
+
+// BatchFailure is a wallet name that a batch operation could not apply
+type BatchFailure struct {
+	// Index is the position of the wallet name in the slice passed in
+	Index      int
+	WalletName WalletName
+	Err        error
+}
+
+// BatchError is returned by SaveWalletNames and DeleteWalletNames when some
+// of the wallet names failed. Wallet names not listed were applied.
+type BatchError struct {
+	Total    int
+	Failures []BatchFailure
+}
+
+func (e *BatchError) Error() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(fmt.Sprintf("%d of %d Wallet Names Failed", len(e.Failures), e.Total))
+	for i, failure := range e.Failures {
+		if i == 0 {
+			buffer.WriteString(": ")
+		} else {
+			buffer.WriteString(", ")
+		}
+		buffer.WriteString(failure.WalletName.Name)
+		buffer.WriteString(" (")
+		buffer.WriteString(failure.Err.Error())
+		buffer.WriteString(")")
+	}
+	return buffer.String()
+}
+
+func (n NetkiPartner) batchSize() int {
+	if n.MaxBatchSize > 0 {
+		return n.MaxBatchSize
+	}
+	return DefaultMaxBatchSize
+}
+
+// SaveWalletNames creates and updates many wallet names, sending as few
+// requests as MaxBatchSize allows. Wallet names without an Id are created
+// (POST) and have their new Id set in walletNames; the others are updated (PUT).
+// Wallet names with invalid names or addresses are reported as failures
+// without being sent.
+func (n NetkiPartner) SaveWalletNames(walletNames []WalletName) error {
+	return n.SaveWalletNamesContext(context.Background(), walletNames)
+}
+
+func (n NetkiPartner) SaveWalletNamesContext(ctx context.Context, walletNames []WalletName) error {
+	creates := make([]int, 0)
+	updates := make([]int, 0)
+	batchErr := &BatchError{Total: len(walletNames), Failures: make([]BatchFailure, 0)}
+	payloads := make([]WalletNamePayload, len(walletNames))
+	for i, wn := range walletNames {
+		var err error
+		if payloads[i], err = wn.validPayload(); err != nil {
+			batchErr.fail(walletNames, payloads, []int{i}, err)
+			continue
+		}
+		if !n.SkipAddressValidation {
+			if err := wn.Validate(n.Network); err != nil {
+				batchErr.fail(walletNames, payloads, []int{i}, err)
+				continue
+			}
+		}
+		if wn.Id == "" {
+			creates = append(creates, i)
+		} else {
+			updates = append(updates, i)
+		}
+	}
+
+	for _, group := range []struct {
+		method  string
+		indexes []int
+	}{{"POST", creates}, {"PUT", updates}} {
+		for _, chunk := range chunkIndexes(group.indexes, n.batchSize()) {
+			if err := ctx.Err(); err != nil {
+				batchErr.fail(walletNames, payloads, chunk, err)
+				continue
+			}
+
+			req := WalletNamesRequest{WalletNames: make([]WalletNamePayload, 0)}
+			for _, i := range chunk {
+				req.WalletNames = append(req.WalletNames, payloads[i])
+			}
+			jsondata, err := json.Marshal(req)
+			if err != nil {
+				batchErr.fail(walletNames, payloads, chunk, &NetkiError{fmt.Sprintf("Unable to Marshall JSON Data: %s", err), make([]string, 0)})
+				continue
+			}
+
+			saved := WalletNamesSaveResponse{}
+			if err := requestInto(ctx, &n, "/v1/partner/walletname", group.method, string(jsondata), &saved); err != nil {
+				batchErr.fail(walletNames, payloads, chunk, err)
+				continue
+			}
+			assignIds(walletNames, payloads, chunk, saved.WalletNames)
+		}
+	}
+
+	return batchErr.orNil()
+}
+
+// DeleteWalletNames deletes many wallet names, sending as few requests as
+// MaxBatchSize allows. Wallet names without an Id are reported as failures.
+func (n NetkiPartner) DeleteWalletNames(walletNames []WalletName) error {
+	return n.DeleteWalletNamesContext(context.Background(), walletNames)
+}
+
+func (n NetkiPartner) DeleteWalletNamesContext(ctx context.Context, walletNames []WalletName) error {
+	batchErr := &BatchError{Total: len(walletNames), Failures: make([]BatchFailure, 0)}
+
+	indexes := make([]int, 0)
+	for i, wn := range walletNames {
+		if wn.Id == "" {
+			batchErr.fail(walletNames, nil, []int{i}, &NetkiError{"WalletName has no ID! Cannot Delete!", make([]string, 0)})
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+
+	for _, chunk := range chunkIndexes(indexes, n.batchSize()) {
+		if err := ctx.Err(); err != nil {
+			batchErr.fail(walletNames, nil, chunk, err)
+			continue
+		}
+
+		req := WalletNamesDeleteRequest{WalletNames: make([]WalletNameRefPayload, 0)}
+		for _, i := range chunk {
+			req.WalletNames = append(req.WalletNames, WalletNameRefPayload{DomainName: walletNames[i].DomainName, Id: walletNames[i].Id})
+		}
+		jsondata, err := json.Marshal(req)
+		if err != nil {
+			batchErr.fail(walletNames, nil, chunk, &NetkiError{fmt.Sprintf("Unable to Marshall JSON Data: %s", err), make([]string, 0)})
+			continue
+		}
+
+		if err := requestInto(ctx, &n, "/v1/partner/walletname", "DELETE", string(jsondata), nil); err != nil {
+			batchErr.fail(walletNames, nil, chunk, err)
+		}
+	}
+
+	return batchErr.orNil()
+}
+
+// fail records every wallet name of chunk as failed. When err is an APIError
+// whose failures name specific wallet names, each wallet name gets an error
+// carrying only its own failures. Failures are matched against the name sent
+// in payloads when given, since the API reports names in their ASCII form.
+func (e *BatchError) fail(walletNames []WalletName, payloads []WalletNamePayload, chunk []int, err error) {
+	var apiErr *APIError
+	errors.As(err, &apiErr)
+
+	for _, i := range chunk {
+		itemErr := err
+		if apiErr != nil {
+			name := walletNames[i].Name
+			if payloads != nil && payloads[i].Name != "" {
+				name = payloads[i].Name
+			}
+			own := make([]Failure, 0)
+			for _, failure := range apiErr.Failures {
+				if failure.Name != "" && failure.Name == name {
+					own = append(own, failure)
+				}
+			}
+			if len(own) > 0 {
+				narrowed := *apiErr
+				narrowed.Failures = own
+				itemErr = &narrowed
+			}
+		}
+		e.Failures = append(e.Failures, BatchFailure{Index: i, WalletName: walletNames[i], Err: itemErr})
+	}
+}
+
+func (e *BatchError) orNil() error {
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	return e
+}
+
+// assignIds copies the ids of saved wallet names back onto walletNames. Saved
+// entries are matched on the domain and name sent in payloads when the API
+// returns them, otherwise by position.
+func assignIds(walletNames []WalletName, payloads []WalletNamePayload, chunk []int, saved []SavedWalletNamePayload) {
+	for pos, s := range saved {
+		index := -1
+		if s.Name != "" {
+			for _, i := range chunk {
+				if payloads[i].Name == s.Name && (s.DomainName == "" || payloads[i].DomainName == s.DomainName) {
+					index = i
+					break
+				}
+			}
+		}
+		if index == -1 && pos < len(chunk) {
+			index = chunk[pos]
+		}
+		if index != -1 {
+			walletNames[index].Id = s.Id
+		}
+	}
+}
+
+// chunkIndexes splits indexes into slices of at most size elements
+func chunkIndexes(indexes []int, size int) [][]int {
+	chunks := make([][]int, 0)
+	for len(indexes) > size {
+		chunks = append(chunks, indexes[:size])
+		indexes = indexes[size:]
+	}
+	if len(indexes) > 0 {
+		chunks = append(chunks, indexes)
+	}
+	return chunks
+}
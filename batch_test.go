@@ -0,0 +1,213 @@
+package netki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bitly/go-simplejson"
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+// Setup a mock that records every call and answers from a queue
+type mockCall struct {
+	uri, method, bodyData string
+}
+
+type mockResponse struct {
+	returnData  string
+	returnError error
+}
+
+type SequenceNetkiRequester struct {
+	responses []mockResponse
+	calls     []mockCall
+}
+
+func (n *SequenceNetkiRequester) ProcessRequest(partner *NetkiPartner, uri string, method string, bodyData string) (*simplejson.Json, error) {
+	n.calls = append(n.calls, mockCall{uri, method, bodyData})
+
+	response := mockResponse{returnData: `{}`}
+	if len(n.responses) > 0 {
+		response = n.responses[0]
+		n.responses = n.responses[1:]
+	}
+	if response.returnError != nil {
+		return &simplejson.Json{}, response.returnError
+	}
+	js, err := simplejson.NewJson([]byte(response.returnData))
+	if err != nil {
+		fmt.Println("JSON FORMAT ERROR: ", err)
+	}
+	return js, nil
+}
+
+func getBatchWalletNames(count int) []WalletName {
+	walletNames := make([]WalletName, 0)
+	for i := 0; i < count; i++ {
+		wn := getWalletName()
+		wn.Name = fmt.Sprintf("wallet%d", i)
+		wn.ExternalId = ""
+		walletNames = append(walletNames, wn)
+	}
+	return walletNames
+}
+
+func TestSaveWalletNamesChunked(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{
+		{returnData: `{"wallet_names":[{"id":"id0"},{"id":"id1"}]}`},
+		{returnData: `{"wallet_names":[{"id":"id2"}]}`},
+		{returnData: `{"wallet_names":[{"id":"id3"}]}`},
+	}}
+	mockPartner := &NetkiPartner{Requester: mockRequester, MaxBatchSize: 2}
+
+	walletNames := getBatchWalletNames(4)
+	walletNames[1].Id = "id3"
+	walletNames[1].Name = "existing"
+	err := mockPartner.SaveWalletNames(walletNames)
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(mockRequester.calls))
+	assert.Equal(t, "POST", mockRequester.calls[0].method)
+	assert.Equal(t, "/v1/partner/walletname", mockRequester.calls[0].uri)
+	assert.Equal(t, `{"wallet_names":[{"domain_name":"domain.com","external_id":"","name":"wallet0","wallets":[{"currency":"btc","wallet_address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}]},{"domain_name":"domain.com","external_id":"","name":"wallet2","wallets":[{"currency":"btc","wallet_address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}]}]}`, mockRequester.calls[0].bodyData)
+	assert.Equal(t, "POST", mockRequester.calls[1].method)
+	assert.Equal(t, `{"wallet_names":[{"domain_name":"domain.com","external_id":"","name":"wallet3","wallets":[{"currency":"btc","wallet_address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}]}]}`, mockRequester.calls[1].bodyData)
+	assert.Equal(t, "PUT", mockRequester.calls[2].method)
+	assert.Equal(t, `{"wallet_names":[{"domain_name":"domain.com","external_id":"","id":"id3","name":"existing","wallets":[{"currency":"btc","wallet_address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}]}]}`, mockRequester.calls[2].bodyData)
+
+	assert.Equal(t, "id0", walletNames[0].Id)
+	assert.Equal(t, "id3", walletNames[1].Id)
+	assert.Equal(t, "id1", walletNames[2].Id)
+	assert.Equal(t, "id2", walletNames[3].Id)
+}
+
+func TestSaveWalletNamesMatchesIdsByName(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{
+		{returnData: `{"wallet_names":[{"id":"id1","name":"wallet1"},{"id":"id0","name":"wallet0"}]}`},
+	}}
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	walletNames := getBatchWalletNames(2)
+	err := mockPartner.SaveWalletNames(walletNames)
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(mockRequester.calls))
+	assert.Equal(t, "id0", walletNames[0].Id)
+	assert.Equal(t, "id1", walletNames[1].Id)
+}
+
+func TestSaveWalletNamesMatchesNormalizedNames(t *testing.T) {
+	apiErr := &APIError{StatusCode: 400, Message: "Invalid Wallet Names", hasFailures: true, Failures: []Failure{{Name: "wallet", Message: "taken"}, {Name: "xn--bcher-kva", Message: "bad address"}}}
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{
+		{returnData: `{"wallet_names":[{"id":"id1","name":"xn--bcher-kva"},{"id":"id0","name":"wallet"}]}`},
+		{returnError: apiErr},
+	}}
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	// The API answers with the lowercased, punycode names that were sent
+	walletNames := getBatchWalletNames(2)
+	walletNames[0].Name = "Wallet"
+	walletNames[1].Name = "bücher"
+	assert.Equal(t, nil, mockPartner.SaveWalletNames(walletNames))
+	assert.Equal(t, "id0", walletNames[0].Id)
+	assert.Equal(t, "id1", walletNames[1].Id)
+
+	walletNames = getBatchWalletNames(2)
+	walletNames[0].Name = "Wallet"
+	walletNames[1].Name = "bücher"
+	err := mockPartner.SaveWalletNames(walletNames)
+	batchErr := err.(*BatchError)
+	assert.Equal(t, "Invalid Wallet Names [FAILURES: taken]", batchErr.Failures[0].Err.Error())
+	assert.Equal(t, "Invalid Wallet Names [FAILURES: bad address]", batchErr.Failures[1].Err.Error())
+}
+
+func TestSaveWalletNamesFailures(t *testing.T) {
+	apiErr := &APIError{StatusCode: 400, Message: "Invalid Wallet Names", hasFailures: true, Failures: []Failure{{Name: "wallet1", Message: "bad address"}}}
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{
+		{returnError: apiErr},
+		{returnData: `{"wallet_names":[{"id":"id2"}]}`},
+	}}
+	mockPartner := &NetkiPartner{Requester: mockRequester, MaxBatchSize: 2}
+
+	walletNames := getBatchWalletNames(3)
+	err := mockPartner.SaveWalletNames(walletNames)
+
+	var batchErr *BatchError
+	assert.Equal(t, true, errors.As(err, &batchErr))
+	assert.Equal(t, 3, batchErr.Total)
+	assert.Equal(t, 2, len(batchErr.Failures))
+
+	assert.Equal(t, 0, batchErr.Failures[0].Index)
+	assert.Equal(t, apiErr, batchErr.Failures[0].Err)
+	assert.Equal(t, 1, batchErr.Failures[1].Index)
+	assert.Equal(t, "wallet1", batchErr.Failures[1].WalletName.Name)
+	assert.Equal(t, "Invalid Wallet Names [FAILURES: bad address]", batchErr.Failures[1].Err.Error())
+	assert.Equal(t, true, errors.Is(batchErr.Failures[1].Err, ErrValidation))
+
+	assert.Equal(t, "", walletNames[0].Id)
+	assert.Equal(t, "id2", walletNames[2].Id)
+	assert.Equal(t, "2 of 3 Wallet Names Failed: wallet0 (Invalid Wallet Names [FAILURES: bad address]), wallet1 (Invalid Wallet Names [FAILURES: bad address])", err.Error())
+}
+
+func TestSaveWalletNamesCanceled(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{}
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := mockPartner.SaveWalletNamesContext(ctx, getBatchWalletNames(2))
+
+	var batchErr *BatchError
+	assert.Equal(t, true, errors.As(err, &batchErr))
+	assert.Equal(t, 2, len(batchErr.Failures))
+	assert.Equal(t, context.Canceled, batchErr.Failures[0].Err)
+	assert.Equal(t, 0, len(mockRequester.calls))
+}
+
+func TestSaveWalletNamesEmpty(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{}
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	err := mockPartner.SaveWalletNames(make([]WalletName, 0))
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(mockRequester.calls))
+}
+
+func TestDeleteWalletNames(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{}
+	mockPartner := &NetkiPartner{Requester: mockRequester, MaxBatchSize: 2}
+
+	walletNames := getBatchWalletNames(4)
+	walletNames[0].Id = "id0"
+	walletNames[2].Id = "id2"
+	walletNames[3].Id = "id3"
+	err := mockPartner.DeleteWalletNames(walletNames)
+
+	var batchErr *BatchError
+	assert.Equal(t, true, errors.As(err, &batchErr))
+	assert.Equal(t, 1, len(batchErr.Failures))
+	assert.Equal(t, 1, batchErr.Failures[0].Index)
+	assert.Equal(t, "WalletName has no ID! Cannot Delete!", batchErr.Failures[0].Err.Error())
+
+	assert.Equal(t, 2, len(mockRequester.calls))
+	assert.Equal(t, "DELETE", mockRequester.calls[0].method)
+	assert.Equal(t, `{"wallet_names":[{"domain_name":"domain.com","id":"id0"},{"domain_name":"domain.com","id":"id2"}]}`, mockRequester.calls[0].bodyData)
+	assert.Equal(t, `{"wallet_names":[{"domain_name":"domain.com","id":"id3"}]}`, mockRequester.calls[1].bodyData)
+}
+
+func TestDeleteWalletNamesError(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{{returnError: &NetkiError{"Error Message", make([]string, 0)}}}}
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	walletNames := getBatchWalletNames(2)
+	walletNames[0].Id = "id0"
+	walletNames[1].Id = "id1"
+	err := mockPartner.DeleteWalletNames(walletNames)
+
+	var batchErr *BatchError
+	assert.Equal(t, true, errors.As(err, &batchErr))
+	assert.Equal(t, 2, len(batchErr.Failures))
+	assert.Equal(t, "Error Message", batchErr.Failures[1].Err.Error())
+}
@@ -0,0 +1,150 @@
+package netki
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// DefaultBulkConcurrency is the number of lookups a BulkResolver runs at once
+// when Concurrency is zero
+const DefaultBulkConcurrency = 8
+
+// LookupRequest is one wallet name and currency to resolve
+type LookupRequest struct {
+	Name     string
+	Currency string
+}
+
+// BulkResult is the outcome of one LookupRequest
+type BulkResult struct {
+	LookupRequest
+	Address string
+	Err     error
+}
+
+// BulkResolver resolves many wallet names concurrently. Requests for the same
+// name and currency, within one call or across concurrent calls, share a
+// single lookup.
+type BulkResolver struct {
+	// Resolver performs each lookup, DefaultResolver when nil
+	Resolver *Resolver
+
+	// Concurrency bounds the lookups in flight per call, DefaultBulkConcurrency when zero
+	Concurrency int
+
+	mu       sync.Mutex
+	inflight map[LookupRequest]*bulkCall
+}
+
+type bulkCall struct {
+	done    chan struct{}
+	address string
+	err     error
+}
+
+// Lookup resolves every request, returning results in request order
+func (b *BulkResolver) Lookup(requests []LookupRequest) []BulkResult {
+	return b.LookupContext(context.Background(), requests)
+}
+
+// LookupContext is like Lookup but carries ctx to the lookups. Requests not
+// yet started when ctx is done fail with ctx.Err().
+func (b *BulkResolver) LookupContext(ctx context.Context, requests []LookupRequest) []BulkResult {
+	results := make([]BulkResult, len(requests))
+
+	// Coalesce duplicate requests within the call
+	keys := make([]LookupRequest, 0)
+	indexes := make(map[LookupRequest][]int)
+	for i, request := range requests {
+		results[i].LookupRequest = request
+		key := bulkKey(request)
+		if _, ok := indexes[key]; !ok {
+			keys = append(keys, key)
+		}
+		indexes[key] = append(indexes[key], i)
+	}
+
+	concurrency := b.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBulkConcurrency
+	}
+	if concurrency > len(keys) {
+		concurrency = len(keys)
+	}
+
+	work := make(chan LookupRequest)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range work {
+				address, err := b.lookup(ctx, key)
+				mu.Lock()
+				for _, i := range indexes[key] {
+					results[i].Address = address
+					results[i].Err = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, key := range keys {
+		work <- key
+	}
+	close(work)
+	wg.Wait()
+
+	return results
+}
+
+// lookup resolves key, joining a lookup already in flight for it
+func (b *BulkResolver) lookup(ctx context.Context, key LookupRequest) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	b.mu.Lock()
+	if b.inflight == nil {
+		b.inflight = make(map[LookupRequest]*bulkCall)
+	}
+	if call, ok := b.inflight[key]; ok {
+		b.mu.Unlock()
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		// Another caller's cancellation is no answer for this one
+		if errors.Is(call.err, context.Canceled) || errors.Is(call.err, context.DeadlineExceeded) {
+			return b.lookup(ctx, key)
+		}
+		return call.address, call.err
+	}
+	call := &bulkCall{done: make(chan struct{})}
+	b.inflight[key] = call
+	b.mu.Unlock()
+
+	resolver := b.Resolver
+	if resolver == nil {
+		resolver = DefaultResolver
+	}
+	call.address, call.err = resolver.LookupContext(ctx, key.Name, key.Currency)
+
+	b.mu.Lock()
+	delete(b.inflight, key)
+	b.mu.Unlock()
+	close(call.done)
+	return call.address, call.err
+}
+
+// bulkKey normalizes a request so differently written duplicates coalesce
+func bulkKey(request LookupRequest) LookupRequest {
+	return LookupRequest{
+		Name:     strings.TrimSuffix(strings.ToLower(strings.TrimSpace(request.Name)), "."),
+		Currency: NormalizeCurrency(request.Currency),
+	}
+}
@@ -0,0 +1,173 @@
+package netki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bmizerany/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Setup a lookup API stand-in that counts requests and tracks concurrency
+type bulkLookupServer struct {
+	mu          sync.Mutex
+	requests    map[string]int
+	inflight    int
+	maxInflight int
+	delay       time.Duration
+}
+
+func setupBulkLookupHttp(t *testing.T, delay time.Duration) (*bulkLookupServer, *Resolver) {
+	counter := &bulkLookupServer{requests: make(map[string]int), delay: delay}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter.mu.Lock()
+		counter.requests[r.URL.Path]++
+		counter.inflight++
+		if counter.inflight > counter.maxInflight {
+			counter.maxInflight = counter.inflight
+		}
+		counter.mu.Unlock()
+
+		time.Sleep(counter.delay)
+
+		counter.mu.Lock()
+		counter.inflight--
+		counter.mu.Unlock()
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if strings.HasPrefix(parts[0], "missing") {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"success":false,"message":"Wallet Name Does Not Exist"}`)
+			return
+		}
+		if parts[1] == "eth" {
+			fmt.Fprint(w, `{"success":false,"message":"Currency Not Available"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"success":true,"wallet_address":"%s-%s"}`, parts[1], parts[0])
+	}))
+	t.Cleanup(server.Close)
+	return counter, &Resolver{BaseURL: server.URL, HTTPClient: server.Client()}
+}
+
+func TestBulkResolverLookup(t *testing.T) {
+	counter, resolver := setupBulkLookupHttp(t, 20*time.Millisecond)
+	bulk := &BulkResolver{Resolver: resolver, Concurrency: 3}
+
+	requests := make([]LookupRequest, 0)
+	for i := 0; i < 10; i++ {
+		requests = append(requests, LookupRequest{Name: fmt.Sprintf("wallet%d.domain.com", i), Currency: "btc"})
+	}
+	requests = append(requests,
+		LookupRequest{Name: "Wallet0.Domain.com.", Currency: "BTC"},
+		LookupRequest{Name: "missing.domain.com", Currency: "btc"},
+		LookupRequest{Name: "wallet1.domain.com", Currency: "XBT"},
+	)
+	results := bulk.Lookup(requests)
+
+	assert.Equal(t, len(requests), len(results))
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, nil, results[i].Err)
+		assert.Equal(t, fmt.Sprintf("btc-wallet%d.domain.com", i), results[i].Address)
+	}
+	assert.Equal(t, "Wallet0.Domain.com.", results[10].Name)
+	assert.Equal(t, "btc-wallet0.domain.com", results[10].Address)
+	assert.Equal(t, true, errors.Is(results[11].Err, ErrNotFound))
+	assert.Equal(t, "Could not resolve netki address", results[11].Err.Error())
+	assert.Equal(t, "XBT", results[12].Currency)
+	assert.Equal(t, "btc-wallet1.domain.com", results[12].Address)
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	assert.Equal(t, 1, counter.requests["/wallet0.domain.com/btc"])
+	assert.Equal(t, 1, counter.requests["/wallet1.domain.com/btc"])
+	assert.Equal(t, 11, len(counter.requests))
+	assert.Equal(t, true, counter.maxInflight <= 3)
+}
+
+func TestBulkResolverCoalescesConcurrentCalls(t *testing.T) {
+	counter, resolver := setupBulkLookupHttp(t, 50*time.Millisecond)
+	bulk := &BulkResolver{Resolver: resolver}
+
+	var wg sync.WaitGroup
+	results := make([][]BulkResult, 4)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = bulk.Lookup([]LookupRequest{{Name: "wallet.domain.com", Currency: "btc"}})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		assert.Equal(t, "btc-wallet.domain.com", result[0].Address)
+	}
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	assert.Equal(t, 1, counter.requests["/wallet.domain.com/btc"])
+}
+
+func TestBulkResolverCanceled(t *testing.T) {
+	_, resolver := setupBulkLookupHttp(t, 0)
+	bulk := &BulkResolver{Resolver: resolver}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := bulk.LookupContext(ctx, []LookupRequest{{Name: "wallet.domain.com", Currency: "btc"}, {Name: "other.domain.com", Currency: "btc"}})
+	assert.Equal(t, context.Canceled, results[0].Err)
+	assert.Equal(t, context.Canceled, results[1].Err)
+
+	assert.Equal(t, 0, len(bulk.Lookup(nil)))
+}
+
+func TestBulkResolverJoinerOutlivesCanceledCaller(t *testing.T) {
+	counter, resolver := setupBulkLookupHttp(t, 100*time.Millisecond)
+	bulk := &BulkResolver{Resolver: resolver}
+	request := []LookupRequest{{Name: "wallet.domain.com", Currency: "btc"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan []BulkResult)
+	go func() { first <- bulk.LookupContext(ctx, request) }()
+	time.Sleep(20 * time.Millisecond)
+
+	second := make(chan []BulkResult)
+	go func() { second <- bulk.Lookup(request) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	results := <-first
+	assert.Equal(t, true, errors.Is(results[0].Err, context.Canceled))
+
+	results = <-second
+	assert.Equal(t, nil, results[0].Err)
+	assert.Equal(t, "btc-wallet.domain.com", results[0].Address)
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	assert.Equal(t, 2, counter.requests["/wallet.domain.com/btc"])
+}
+
+func TestResolverLookupAll(t *testing.T) {
+	counter, resolver := setupBulkLookupHttp(t, 0)
+	resolver.Currencies = []string{"btc", "eth", "ltc"}
+
+	wallets, err := resolver.LookupAll("wallet.domain.com")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []Wallet{{Currency: "btc", WalletAddress: "btc-wallet.domain.com"}, {Currency: "ltc", WalletAddress: "ltc-wallet.domain.com"}}, wallets)
+
+	_, err = resolver.LookupAll("missing.domain.com")
+	assert.Equal(t, "Could not resolve missing.domain.com: no addresses found", err.Error())
+	assert.Equal(t, true, errors.Is(err, ErrNotFound))
+
+	resolver.Currencies = nil
+	resolver.LookupAll("wallet.domain.com")
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	assert.Equal(t, 1, counter.requests["/wallet.domain.com/dgc"])
+}
@@ -0,0 +1,315 @@
+package netki
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultCacheSize is the number of lookups a LookupCache holds when MaxEntries is zero
+const DefaultCacheSize = 10000
+
+// DefaultCacheTTL is how long a lookup without a TTL of its own is cached
+const DefaultCacheTTL = 5 * time.Minute
+
+// DefaultNegativeCacheTTL is how long a not found answer is cached
+const DefaultNegativeCacheTTL = time.Minute
+
+// cacheFileVersion is the format version of persisted LookupCache files
+const cacheFileVersion = 1
+
+// unknownTTL marks an address resolved without a TTL, as opposed to a TTL of
+// zero which forbids caching it
+const unknownTTL time.Duration = -1
+
+// LookupCache is a size-bounded LRU cache of wallet lookups, set as
+// Resolver.Cache. Addresses are cached for their DNS TTL, or DefaultTTL
+// when they have none, and not at all when their TTL is zero. Not found
+// answers are cached for NegativeTTL. It is safe for concurrent use.
+type LookupCache struct {
+	// MaxEntries bounds the cache, DefaultCacheSize when zero
+	MaxEntries int
+
+	// DefaultTTL applies to addresses without a TTL, DefaultCacheTTL when zero
+	DefaultTTL time.Duration
+
+	// NegativeTTL applies to not found answers, DefaultNegativeCacheTTL when
+	// zero. Negative values disable negative caching.
+	NegativeTTL time.Duration
+
+	// Path is the file Save writes and OpenLookupCache reads
+	Path string
+
+	// Now returns the current time, time.Now when nil
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	stats   CacheStats
+}
+
+// CacheStats counts the lookups answered by a LookupCache
+type CacheStats struct {
+	Hits         uint64
+	NegativeHits uint64
+	Misses       uint64
+	Evictions    uint64
+	Entries      int
+}
+
+// HitRatio returns the share of lookups answered from the cache
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.NegativeHits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits+s.NegativeHits) / float64(total)
+}
+
+// cacheEntry is a cached answer. NotFound holds the message of a cached not found error.
+type cacheEntry struct {
+	Name     string    `json:"name"`
+	Currency string    `json:"currency"`
+	Address  string    `json:"address,omitempty"`
+	NotFound string    `json:"not_found,omitempty"`
+	Expires  time.Time `json:"expires"`
+
+	err error
+}
+
+type cacheFile struct {
+	Version int           `json:"version"`
+	Entries []*cacheEntry `json:"entries"`
+}
+
+// NewLookupCache creates an empty LookupCache holding up to maxEntries lookups
+func NewLookupCache(maxEntries int) *LookupCache {
+	return &LookupCache{MaxEntries: maxEntries}
+}
+
+// OpenLookupCache creates a LookupCache persisted at path, loading the
+// entries saved there if the file exists
+func OpenLookupCache(path string, maxEntries int) (*LookupCache, error) {
+	c := &LookupCache{MaxEntries: maxEntries, Path: path}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, &NetkiError{"Unable to Read Lookup Cache: " + err.Error(), make([]string, 0)}
+	}
+
+	file := cacheFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, &NetkiError{"Unable to Read Lookup Cache: " + err.Error(), make([]string, 0)}
+	}
+	if file.Version != cacheFileVersion {
+		return c, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	// Entries are saved most recently used first
+	for i := len(file.Entries) - 1; i >= 0; i-- {
+		entry := file.Entries[i]
+		if !now.Before(entry.Expires) {
+			continue
+		}
+		if entry.NotFound != "" {
+			entry.err = &lookupNotFoundError{entry.NotFound}
+		}
+		c.add(entry)
+	}
+	return c, nil
+}
+
+// Save writes the unexpired entries to Path, replacing the file atomically
+func (c *LookupCache) Save() error {
+	if c.Path == "" {
+		return &NetkiError{"Lookup Cache Has No Path", make([]string, 0)}
+	}
+
+	c.mu.Lock()
+	file := cacheFile{Version: cacheFileVersion, Entries: make([]*cacheEntry, 0)}
+	now := c.now()
+	if c.order != nil {
+		for element := c.order.Front(); element != nil; element = element.Next() {
+			if entry := element.Value.(*cacheEntry); now.Before(entry.Expires) {
+				file.Entries = append(file.Entries, entry)
+			}
+		}
+	}
+	data, err := json.Marshal(file)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(c.Path, data); err != nil {
+		return &NetkiError{"Unable to Write Lookup Cache: " + err.Error(), make([]string, 0)}
+	}
+	return nil
+}
+
+// Stats returns the cache counters
+func (c *LookupCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+// Len returns the number of cached lookups, including expired ones not yet evicted
+func (c *LookupCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Purge removes every entry, keeping the statistics
+func (c *LookupCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = nil
+	c.order = nil
+}
+
+// Remove drops the cached lookup for name and currency
+func (c *LookupCache) Remove(name string, currency string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[cacheKey(name, currency)]; ok {
+		c.order.Remove(element)
+		delete(c.entries, cacheKey(name, currency))
+	}
+}
+
+// get returns a cached, unexpired answer
+func (c *LookupCache) get(name string, currency string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey(name, currency)
+	element, ok := c.entries[key]
+	if ok && !c.now().Before(element.Value.(*cacheEntry).Expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return "", false, nil
+	}
+
+	c.order.MoveToFront(element)
+	entry := element.Value.(*cacheEntry)
+	if entry.err != nil {
+		c.stats.NegativeHits++
+	} else {
+		c.stats.Hits++
+	}
+	return entry.Address, true, entry.err
+}
+
+// put caches an answer. Only addresses and not found errors are cached. ttl
+// is unknownTTL when the address came without one.
+func (c *LookupCache) put(name string, currency string, address string, ttl time.Duration, err error) {
+	entry := &cacheEntry{Name: name, Currency: currency, Address: address}
+	switch {
+	case err == nil:
+		if ttl == 0 {
+			return
+		}
+		if ttl < 0 {
+			ttl = c.DefaultTTL
+		}
+		if ttl <= 0 {
+			ttl = DefaultCacheTTL
+		}
+	case errors.Is(err, ErrNotFound):
+		ttl = c.NegativeTTL
+		if ttl == 0 {
+			ttl = DefaultNegativeCacheTTL
+		}
+		if ttl < 0 {
+			return
+		}
+		entry.NotFound = err.Error()
+		entry.err = err
+	default:
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.Expires = c.now().Add(ttl)
+	c.add(entry)
+}
+
+// add inserts entry as the most recently used, evicting the least recently
+// used entries beyond MaxEntries. c.mu must be held.
+func (c *LookupCache) add(entry *cacheEntry) {
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.order = list.New()
+	}
+
+	key := cacheKey(entry.Name, entry.Currency)
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+
+	maxEntries := c.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheSize
+	}
+	for c.order.Len() > maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		oldestEntry := oldest.Value.(*cacheEntry)
+		delete(c.entries, cacheKey(oldestEntry.Name, oldestEntry.Currency))
+		c.stats.Evictions++
+	}
+}
+
+func (c *LookupCache) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func cacheKey(name string, currency string) string {
+	key := bulkKey(LookupRequest{Name: name, Currency: currency})
+	return key.Name + "/" + key.Currency
+}
+
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory, so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,204 @@
+package netki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bmizerany/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func TestLookupCacheHitsAndExpiry(t *testing.T) {
+	counter, resolver := setupBulkLookupHttp(t, 0)
+	clock := &testClock{now: time.Now()}
+	resolver.Cache = &LookupCache{DefaultTTL: time.Minute, Now: clock.Now}
+
+	for i := 0; i < 3; i++ {
+		address, err := resolver.Lookup("wallet.domain.com", "btc")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "btc-wallet.domain.com", address)
+	}
+	address, _ := resolver.Lookup("Wallet.Domain.com", "BTC")
+	assert.Equal(t, "btc-wallet.domain.com", address)
+
+	clock.now = clock.now.Add(time.Minute)
+	resolver.Lookup("wallet.domain.com", "btc")
+
+	counter.mu.Lock()
+	assert.Equal(t, 2, counter.requests["/wallet.domain.com/btc"])
+	counter.mu.Unlock()
+	assert.Equal(t, CacheStats{Hits: 3, Misses: 2, Entries: 1}, resolver.Cache.Stats())
+	assert.Equal(t, 0.6, resolver.Cache.Stats().HitRatio())
+}
+
+func TestLookupCacheNegative(t *testing.T) {
+	counter, resolver := setupBulkLookupHttp(t, 0)
+	clock := &testClock{now: time.Now()}
+	resolver.Cache = &LookupCache{NegativeTTL: 10 * time.Second, Now: clock.Now}
+
+	for i := 0; i < 2; i++ {
+		_, err := resolver.Lookup("missing.domain.com", "btc")
+		assert.Equal(t, true, errors.Is(err, ErrNotFound))
+		assert.Equal(t, "Could not resolve netki address", err.Error())
+	}
+	clock.now = clock.now.Add(10 * time.Second)
+	resolver.Lookup("missing.domain.com", "btc")
+
+	counter.mu.Lock()
+	assert.Equal(t, 2, counter.requests["/missing.domain.com/btc"])
+	counter.mu.Unlock()
+	assert.Equal(t, uint64(1), resolver.Cache.Stats().NegativeHits)
+
+	resolver.Cache = &LookupCache{NegativeTTL: -1}
+	resolver.Lookup("missing.domain.com", "btc")
+	assert.Equal(t, 0, resolver.Cache.Len())
+}
+
+func TestLookupCacheSkipsErrors(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	resolver := &Resolver{BaseURL: server.URL, HTTPClient: server.Client(), Cache: NewLookupCache(10)}
+	resolver.Lookup("wallet.domain.com", "btc")
+	_, err := resolver.Lookup("wallet.domain.com", "btc")
+	assert.Equal(t, "Could not resolve netki address", err.Error())
+	assert.Equal(t, false, errors.Is(err, ErrNotFound))
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 0, resolver.Cache.Len())
+}
+
+func TestLookupCacheEviction(t *testing.T) {
+	counter, resolver := setupBulkLookupHttp(t, 0)
+	resolver.Cache = NewLookupCache(2)
+
+	resolver.Lookup("a.domain.com", "btc")
+	resolver.Lookup("b.domain.com", "btc")
+	resolver.Lookup("a.domain.com", "btc")
+	resolver.Lookup("c.domain.com", "btc")
+	resolver.Lookup("a.domain.com", "btc")
+	resolver.Lookup("b.domain.com", "btc")
+
+	counter.mu.Lock()
+	assert.Equal(t, 1, counter.requests["/a.domain.com/btc"])
+	assert.Equal(t, 2, counter.requests["/b.domain.com/btc"])
+	counter.mu.Unlock()
+	stats := resolver.Cache.Stats()
+	assert.Equal(t, uint64(2), stats.Evictions)
+	assert.Equal(t, 2, stats.Entries)
+
+	resolver.Cache.Remove("A.domain.com", "btc")
+	assert.Equal(t, 1, resolver.Cache.Len())
+	resolver.Cache.Purge()
+	assert.Equal(t, 0, resolver.Cache.Len())
+	assert.Equal(t, uint64(2), resolver.Cache.Stats().Evictions)
+}
+
+func TestLookupCacheTTL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=30")
+		fmt.Fprint(w, `{"success":true,"wallet_address":"1btcaddress"}`)
+	}))
+	defer server.Close()
+	clock := &testClock{now: time.Now()}
+	cache := &LookupCache{Now: clock.Now}
+
+	resolver := &Resolver{BaseURL: server.URL, HTTPClient: server.Client(), Cache: cache}
+	resolver.Lookup("wallet.domain.com", "btc")
+	clock.now = clock.now.Add(29 * time.Second)
+	resolver.Lookup("wallet.domain.com", "btc")
+	clock.now = clock.now.Add(time.Second)
+	resolver.Lookup("wallet.domain.com", "btc")
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2, Entries: 1}, cache.Stats())
+
+	_, nameserver := setupDNS(t,
+		`_wallet.wallet.domain.test. 600 IN TXT "btc"`,
+		`_btc._wallet.wallet.domain.test. 20 IN TXT "1btcaddress"`,
+	)
+	dnsResolver := &DNSResolver{Nameserver: nameserver}
+	result, err := dnsResolver.Resolve(context.Background(), "wallet.domain.test", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 20*time.Second, result.TTL)
+
+	cache = &LookupCache{Now: clock.Now}
+	resolver = &Resolver{DNS: dnsResolver, Cache: cache}
+	resolver.Lookup("wallet.domain.test", "btc")
+	clock.now = clock.now.Add(20 * time.Second)
+	resolver.Lookup("wallet.domain.test", "btc")
+	assert.Equal(t, uint64(2), cache.Stats().Misses)
+}
+
+func TestLookupCacheZeroTTL(t *testing.T) {
+	_, nameserver := setupDNS(t,
+		`_wallet.wallet.domain.test. 600 IN TXT "btc"`,
+		`_btc._wallet.wallet.domain.test. 0 IN TXT "1btcaddress"`,
+	)
+	cache := &LookupCache{}
+	resolver := &Resolver{DNS: &DNSResolver{Nameserver: nameserver}, Cache: cache}
+	for i := 0; i < 2; i++ {
+		address, err := resolver.Lookup("wallet.domain.test", "btc")
+		assert.Equal(t, nil, err)
+		assert.Equal(t, "1btcaddress", address)
+	}
+	assert.Equal(t, CacheStats{Misses: 2}, cache.Stats())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=0")
+		fmt.Fprint(w, `{"success":true,"wallet_address":"1btcaddress"}`)
+	}))
+	defer server.Close()
+	cache = &LookupCache{}
+	resolver = &Resolver{BaseURL: server.URL, HTTPClient: server.Client(), Cache: cache}
+	resolver.Lookup("wallet.domain.com", "btc")
+	resolver.Lookup("wallet.domain.com", "btc")
+	assert.Equal(t, CacheStats{Misses: 2}, cache.Stats())
+}
+
+func TestLookupCachePersistence(t *testing.T) {
+	_, resolver := setupBulkLookupHttp(t, 0)
+	path := filepath.Join(t.TempDir(), "lookups.json")
+
+	cache, err := OpenLookupCache(path, 10)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, cache.Len())
+	resolver.Cache = cache
+	resolver.Lookup("wallet.domain.com", "btc")
+	resolver.Lookup("missing.domain.com", "btc")
+	cache.add(&cacheEntry{Name: "expired.domain.com", Currency: "btc", Address: "1expired", Expires: time.Now().Add(-time.Second)})
+	assert.Equal(t, nil, cache.Save())
+
+	reopened, err := OpenLookupCache(path, 10)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, reopened.Len())
+	address, ok, err := reopened.get("wallet.domain.com", "btc")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "btc-wallet.domain.com", address)
+	_, ok, err = reopened.get("missing.domain.com", "btc")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, true, errors.Is(err, ErrNotFound))
+	assert.Equal(t, "Could not resolve netki address", err.Error())
+
+	assert.Equal(t, "Lookup Cache Has No Path", NewLookupCache(1).Save().Error())
+
+	ioutil.WriteFile(path, []byte("garbage"), 0600)
+	_, err = OpenLookupCache(path, 10)
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"netki"
+	"strconv"
+	"strings"
+)
+
+// dispatch runs the command named by the first one or two arguments
+func dispatch(ctx context.Context, cfg config, args []string) (*result, error) {
+	if args[0] == "lookup" {
+		return lookup(ctx, cfg, args[1:])
+	}
+	if len(args) < 2 {
+		return nil, &usageError{fmt.Sprintf("%s needs a subcommand", args[0])}
+	}
+
+	var handler func(context.Context, *netki.NetkiPartner, []string) (*result, error)
+	switch args[0] + " " + args[1] {
+	case "partner create":
+		handler = partnerCreate
+	case "partner list":
+		handler = partnerList
+	case "partner delete":
+		handler = partnerDelete
+	case "domain create":
+		handler = domainCreate
+	case "domain list":
+		handler = domainList
+	case "domain status":
+		handler = domainStatus
+	case "domain dnssec":
+		handler = domainDnssec
+	case "domain delete":
+		handler = domainDelete
+	case "walletname get":
+		handler = walletNameGet
+	case "walletname set":
+		handler = walletNameSet
+	case "walletname remove-currency":
+		handler = walletNameRemoveCurrency
+	case "walletname delete":
+		handler = walletNameDelete
+	default:
+		return nil, &usageError{fmt.Sprintf("unknown command %q", strings.Join(args[:2], " "))}
+	}
+
+	partner, err := cfg.partner()
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, partner, args[2:])
+}
+
+// parseArgs parses a subcommand's flags and checks its number of positional arguments
+func parseArgs(fs *flag.FlagSet, args []string, min int, max int) ([]string, error) {
+	fs.SetOutput(ioutil.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, &usageError{err.Error()}
+	}
+	if fs.NArg() < min || (max >= 0 && fs.NArg() > max) {
+		return nil, &usageError{fmt.Sprintf("%s takes %s", fs.Name(), argCount(min, max))}
+	}
+	return fs.Args(), nil
+}
+
+func argCount(min int, max int) string {
+	switch {
+	case min == max:
+		return fmt.Sprintf("%d arguments", min)
+	case max < 0:
+		return fmt.Sprintf("at least %d arguments", min)
+	}
+	return fmt.Sprintf("%d to %d arguments", min, max)
+}
+
+func partnerResult(partners ...netki.Partner) *result {
+	res := &result{columns: []string{"ID", "NAME"}}
+	values := make([]partnerOutput, 0)
+	for _, p := range partners {
+		res.rows = append(res.rows, []string{p.Id(), p.Name()})
+		values = append(values, partnerOutput{Id: p.Id(), Name: p.Name()})
+	}
+	res.value = values
+	return res
+}
+
+func partnerCreate(ctx context.Context, partner *netki.NetkiPartner, args []string) (*result, error) {
+	args, err := parseArgs(flag.NewFlagSet("partner create", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	created, err := partner.CreateNewPartnerContext(ctx, args[0])
+	if err != nil {
+		return nil, err
+	}
+	res := partnerResult(created)
+	res.value = res.value.([]partnerOutput)[0]
+	return res, nil
+}
+
+func partnerList(ctx context.Context, partner *netki.NetkiPartner, args []string) (*result, error) {
+	if _, err := parseArgs(flag.NewFlagSet("partner list", flag.ContinueOnError), args, 0, 0); err != nil {
+		return nil, err
+	}
+	partners, err := partner.GetPartnersContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return partnerResult(partners...), nil
+}
+
+func partnerDelete(ctx context.Context, partner *netki.NetkiPartner, args []string) (*result, error) {
+	args, err := parseArgs(flag.NewFlagSet("partner delete", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	found, err := findPartner(ctx, partner, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return nil, partner.DeletePartnerContext(ctx, found)
+}
+
+func findPartner(ctx context.Context, partner *netki.NetkiPartner, name string) (netki.Partner, error) {
+	partners, err := partner.GetPartnersContext(ctx)
+	if err != nil {
+		return netki.Partner{}, err
+	}
+	for _, p := range partners {
+		if p.Name() == name {
+			return p, nil
+		}
+	}
+	return netki.Partner{}, fmt.Errorf("partner %q not found", name)
+}
+
+func domainResult(domains ...netki.Domain) *result {
+	res := &result{columns: []string{"DOMAIN", "STATUS"}}
+	values := make([]domainOutput, 0)
+	for _, d := range domains {
+		res.rows = append(res.rows, []string{d.DomainName, d.Status})
+		values = append(values, domainOutput{DomainName: d.DomainName, Status: d.Status, Nameservers: d.Namesevers})
+	}
+	res.value = values
+	return res
+}
+
+func domainCreate(ctx context.Context, partner *netki.NetkiPartner, args []string) (*result, error) {
+	fs := flag.NewFlagSet("domain create", flag.ContinueOnError)
+	partnerName := fs.String("partner", "", "sub-partner to create the domain for")
+	args, err := parseArgs(fs, args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := netki.Partner{}
+	if *partnerName != "" {
+		if owner, err = findPartner(ctx, partner, *partnerName); err != nil {
+			return nil, err
+		}
+	}
+	domain, err := partner.CreateNewDomainContext(ctx, args[0], owner)
+	if err != nil {
+		return nil, err
+	}
+	res := domainResult(domain)
+	res.columns = append(res.columns, "NAMESERVERS")
+	res.rows[0] = append(res.rows[0], strings.Join(domain.Namesevers, ","))
+	res.value = res.value.([]domainOutput)[0]
+	return res, nil
+}
+
+func domainList(ctx context.Context, partner *netki.NetkiPartner, args []string) (*result, error) {
+	if _, err := parseArgs(flag.NewFlagSet("domain list", flag.ContinueOnError), args, 0, 0); err != nil {
+		return nil, err
+	}
+	domains, err := partner.GetDomainsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := domainResult(domains...)
+	res.columns = res.columns[:1]
+	for i := range res.rows {
+		res.rows[i] = res.rows[i][:1]
+	}
+	return res, nil
+}
+
+func domainStatus(ctx context.Context, partner *netki.NetkiPartner, args []string) (*result, error) {
+	args, err := parseArgs(flag.NewFlagSet("domain status", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	domain, err := partner.GetDomainStatusContext(ctx, netki.Domain{DomainName: args[0]})
+	if err != nil {
+		return nil, err
+	}
+	return &result{
+		columns: []string{"DOMAIN", "STATUS", "DELEGATED", "WALLET NAMES", "MESSAGE"},
+		rows:    [][]string{{domain.DomainName, domain.Status, strconv.FormatBool(domain.DelegationStatus), strconv.Itoa(domain.WalletNameCount), domain.DelegationMessage}},
+		value: domainOutput{
+			DomainName:        domain.DomainName,
+			Status:            domain.Status,
+			DelegationStatus:  &domain.DelegationStatus,
+			DelegationMessage: domain.DelegationMessage,
+			WalletNameCount:   &domain.WalletNameCount,
+		},
+	}, nil
+}
+
+func domainDnssec(ctx context.Context, partner *netki.NetkiPartner, args []string) (*result, error) {
+	args, err := parseArgs(flag.NewFlagSet("domain dnssec", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	domain, err := partner.GetDomainDnssecContext(ctx, netki.Domain{DomainName: args[0]})
+	if err != nil {
+		return nil, err
+	}
+	nextRoll := ""
+	if !domain.NextRollDate.IsZero() {
+		nextRoll = domain.NextRollDate.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return &result{
+		columns: []string{"DOMAIN", "NEXT ROLL", "DS RECORDS"},
+		rows:    [][]string{{domain.DomainName, nextRoll, strings.Join(domain.DsRecords, "; ")}},
+		value:   domainOutput{DomainName: domain.DomainName, NextRollDate: nextRoll, DsRecords: domain.DsRecords, PublicSigningKey: domain.PublicSigningKey},
+	}, nil
+}
+
+func domainDelete(ctx context.Context, partner *netki.NetkiPartner, args []string) (*result, error) {
+	args, err := parseArgs(flag.NewFlagSet("domain delete", flag.ContinueOnError), args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	return nil, partner.DeleteDomainContext(ctx, netki.Domain{DomainName: args[0]})
+}
+
+func walletNameResult(walletNames ...netki.WalletName) *result {
+	res := &result{columns: []string{"ID", "WALLET NAME", "EXTERNAL ID", "CURRENCY", "ADDRESS"}}
+	values := make([]walletNameOutput, 0)
+	for _, wn := range walletNames {
+		out := walletNameOutput{Id: wn.Id, DomainName: wn.DomainName, Name: wn.Name, ExternalId: wn.ExternalId, Wallets: make([]walletOutput, 0)}
+		for _, wallet := range wn.Wallets {
+			res.rows = append(res.rows, []string{wn.Id, wn.Name + "." + wn.DomainName, wn.ExternalId, wallet.Currency, wallet.WalletAddress})
+			out.Wallets = append(out.Wallets, walletOutput{Currency: wallet.Currency, Address: wallet.WalletAddress})
+		}
+		if len(wn.Wallets) == 0 {
+			res.rows = append(res.rows, []string{wn.Id, wn.Name + "." + wn.DomainName, wn.ExternalId, "", ""})
+		}
+		values = append(values, out)
+	}
+	res.value = values
+	return res
+}
+
+// findPageSize is the page size used when searching a domain for one wallet name
+const findPageSize = 100
+
+// findWalletName fetches a wallet name of a domain by name, comparing names in
+// the normalized ASCII form the API stores them in
+func findWalletName(ctx context.Context, partner *netki.NetkiPartner, domainName string, name string, externalId string) (netki.WalletName, bool, error) {
+	ascii, err := netki.ToASCIIName(name)
+	if err != nil {
+		return netki.WalletName{}, false, err
+	}
+
+	it := partner.IterateWalletNames(ctx, netki.WalletNamesQuery{DomainName: domainName, ExternalId: externalId, PageSize: findPageSize})
+	defer it.Close()
+	for it.Next() {
+		if wn := it.WalletName(); wn.Name == ascii {
+			return wn, true, nil
+		}
+	}
+	return netki.WalletName{}, false, it.Err()
+}
+
+func walletNameGet(ctx context.Context, partner *netki.NetkiPartner, args []string) (*result, error) {
+	fs := flag.NewFlagSet("walletname get", flag.ContinueOnError)
+	externalId := fs.String("external-id", "", "only wallet names with this external id")
+	args, err := parseArgs(fs, args, 1, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) == 2 {
+		wn, found, err := findWalletName(ctx, partner, args[0], args[1], *externalId)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("wallet name %s.%s not found", args[1], args[0])
+		}
+		return walletNameResult(wn), nil
+	}
+
+	walletNames, err := partner.GetWalletNamesContext(ctx, netki.Domain{DomainName: args[0]}, *externalId)
+	if err != nil {
+		return nil, err
+	}
+	return walletNameResult(walletNames...), nil
+}
+
+func walletNameSet(ctx context.Context, partner *netki.NetkiPartner, args []string) (*result, error) {
+	fs := flag.NewFlagSet("walletname set", flag.ContinueOnError)
+	externalId := fs.String("external-id", "", "external id to store with the wallet name")
+	args, err := parseArgs(fs, args, 4, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	wn, found, err := findWalletName(ctx, partner, args[0], args[1], "")
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		wn = partner.CreateNewWalletName(netki.Domain{DomainName: args[0]}, args[1], make([]netki.Wallet, 0), *externalId)
+	} else if *externalId != "" {
+		wn.ExternalId = *externalId
+	}
+	wn.SetCurrencyAddress(args[2], args[3])
+	if err := wn.SaveContext(ctx, partner); err != nil {
+		return nil, err
+	}
+	return walletNameResult(wn), nil
+}
+
+func walletNameRemoveCurrency(ctx context.Context, partner *netki.NetkiPartner, args []string) (*result, error) {
+	args, err := parseArgs(flag.NewFlagSet("walletname remove-currency", flag.ContinueOnError), args, 3, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	wn, found, err := findWalletName(ctx, partner, args[0], args[1], "")
+	if err != nil {
+		return nil, err
+	} else if !found {
+		return nil, fmt.Errorf("wallet name %s.%s not found", args[1], args[0])
+	}
+	if wn.GetAddress(args[2]) == "" {
+		return nil, fmt.Errorf("wallet name %s.%s has no %s address", args[1], args[0], args[2])
+	}
+	wn.RemoveCurrency(args[2])
+	if err := wn.SaveContext(ctx, partner); err != nil {
+		return nil, err
+	}
+	return walletNameResult(wn), nil
+}
+
+func walletNameDelete(ctx context.Context, partner *netki.NetkiPartner, args []string) (*result, error) {
+	args, err := parseArgs(flag.NewFlagSet("walletname delete", flag.ContinueOnError), args, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	wn, found, err := findWalletName(ctx, partner, args[0], args[1], "")
+	if err != nil {
+		return nil, err
+	} else if !found {
+		return nil, fmt.Errorf("wallet name %s.%s not found", args[1], args[0])
+	}
+	return nil, wn.DeleteContext(ctx, partner)
+}
+
+func lookup(ctx context.Context, cfg config, args []string) (*result, error) {
+	args, err := parseArgs(flag.NewFlagSet("lookup", flag.ContinueOnError), args, 1, -1)
+	if err != nil {
+		return nil, err
+	}
+	resolver := &netki.Resolver{BaseURL: cfg.LookupUrl}
+
+	name := args[0]
+	wallets := make([]netki.Wallet, 0)
+	if len(args) == 1 {
+		if wallets, err = resolver.LookupAllContext(ctx, name); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, currency := range args[1:] {
+			address, err := resolver.LookupContext(ctx, name, currency)
+			if err != nil {
+				return nil, err
+			}
+			wallets = append(wallets, netki.Wallet{Currency: currency, WalletAddress: address})
+		}
+	}
+
+	res := &result{columns: []string{"WALLET NAME", "CURRENCY", "ADDRESS"}}
+	values := make([]lookupOutput, 0)
+	for _, wallet := range wallets {
+		res.rows = append(res.rows, []string{name, wallet.Currency, wallet.WalletAddress})
+		values = append(values, lookupOutput{WalletName: name, Currency: wallet.Currency, Address: wallet.WalletAddress})
+	}
+	res.value = values
+	return res, nil
+}
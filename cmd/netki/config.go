@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"netki"
+	"os"
+	"path/filepath"
+)
+
+// DefaultApiUrl is the partner API used when none is configured
+const DefaultApiUrl = "https://api.netki.com"
+
+// config holds the settings of a run. Being YAML, config files may also be JSON.
+type config struct {
+	ApiUrl         string `yaml:"api_url"`
+	PartnerId      string `yaml:"partner_id"`
+	ApiKey         string `yaml:"api_key"`
+	CredentialFile string `yaml:"credential_file"`
+	LookupUrl      string `yaml:"lookup_url"`
+	Output         string `yaml:"output"`
+}
+
+// loadConfig reads the config file and overlays the environment, then flags
+func loadConfig(path string, flags config, getenv func(string) string) (config, error) {
+	cfg := config{}
+
+	explicit := path != ""
+	if !explicit {
+		path = getenv("NETKI_CONFIG")
+		explicit = path != ""
+	}
+	if !explicit && getenv("HOME") != "" {
+		path = filepath.Join(getenv("HOME"), ".netki.yaml")
+	}
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil && (explicit || !os.IsNotExist(err)) {
+			return cfg, fmt.Errorf("unable to read config file: %s", err)
+		}
+		if err == nil {
+			if err := yaml.Unmarshal(data, &cfg); err != nil {
+				return cfg, fmt.Errorf("unable to parse config file %s: %s", path, err)
+			}
+		}
+	}
+
+	cfg.overlay(config{
+		ApiUrl:         getenv("NETKI_API_URL"),
+		PartnerId:      getenv("NETKI_PARTNER_ID"),
+		ApiKey:         getenv("NETKI_API_KEY"),
+		CredentialFile: getenv("NETKI_CREDENTIAL"),
+		LookupUrl:      getenv("NETKI_LOOKUP_URL"),
+		Output:         getenv("NETKI_OUTPUT"),
+	})
+	cfg.overlay(flags)
+
+	if cfg.ApiUrl == "" {
+		cfg.ApiUrl = DefaultApiUrl
+	}
+	if cfg.Output == "" {
+		cfg.Output = "table"
+	}
+	if cfg.Output != "table" && cfg.Output != "json" && cfg.Output != "yaml" {
+		return cfg, &usageError{fmt.Sprintf("unknown output format %q", cfg.Output)}
+	}
+	return cfg, nil
+}
+
+// overlay replaces settings with those set in other
+func (c *config) overlay(other config) {
+	for _, field := range []struct{ dst, src *string }{
+		{&c.ApiUrl, &other.ApiUrl},
+		{&c.PartnerId, &other.PartnerId},
+		{&c.ApiKey, &other.ApiKey},
+		{&c.CredentialFile, &other.CredentialFile},
+		{&c.LookupUrl, &other.LookupUrl},
+		{&c.Output, &other.Output},
+	} {
+		if *field.src != "" {
+			*field.dst = *field.src
+		}
+	}
+}
+
+// partner builds the API client from the configured credentials
+func (c config) partner() (*netki.NetkiPartner, error) {
+	if c.CredentialFile != "" {
+		cred, err := netki.LoadUserCredentialFile(c.CredentialFile)
+		if err != nil {
+			return nil, err
+		}
+		return cred.NewPartner(c.ApiUrl, nil)
+	}
+	if c.PartnerId == "" || c.ApiKey == "" {
+		return nil, fmt.Errorf("no credentials: set -partner-id and -api-key, NETKI_PARTNER_ID and NETKI_API_KEY, or a config file")
+	}
+	return netki.NewNetkiPartner(c.PartnerId, c.ApiKey, c.ApiUrl), nil
+}
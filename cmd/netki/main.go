@@ -0,0 +1,92 @@
+// Command netki administers partners, domains and wallet names through the
+// Netki partner API and looks up Wallet Names.
+//
+// Credentials are taken from flags, then the NETKI_* environment variables,
+// then a config file (-config, $NETKI_CONFIG or ~/.netki.yaml).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage: netki [flags] <command> [args]
+
+Commands:
+  partner create NAME
+  partner list
+  partner delete NAME
+  domain create [-partner NAME] DOMAIN
+  domain list
+  domain status DOMAIN
+  domain dnssec DOMAIN
+  domain delete DOMAIN
+  walletname get [-external-id ID] DOMAIN [NAME]
+  walletname set [-external-id ID] DOMAIN NAME CURRENCY ADDRESS
+  walletname remove-currency DOMAIN NAME CURRENCY
+  walletname delete DOMAIN NAME
+  lookup WALLETNAME [CURRENCY...]
+
+Flags:
+`
+
+// usageError is reported for bad command lines, exiting with status 2
+type usageError struct {
+	message string
+}
+
+func (e *usageError) Error() string {
+	return e.message
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Getenv, os.Stdout, os.Stderr))
+}
+
+func run(args []string, getenv func(string) string, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("netki", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	flags := config{}
+	configPath := fs.String("config", "", "config file (YAML or JSON)")
+	fs.StringVar(&flags.ApiUrl, "api-url", "", "partner API URL (NETKI_API_URL)")
+	fs.StringVar(&flags.PartnerId, "partner-id", "", "partner id (NETKI_PARTNER_ID)")
+	fs.StringVar(&flags.ApiKey, "api-key", "", "partner API key (NETKI_API_KEY)")
+	fs.StringVar(&flags.CredentialFile, "credential", "", "key-signed user credential file, used instead of an API key (NETKI_CREDENTIAL)")
+	fs.StringVar(&flags.LookupUrl, "lookup-url", "", "wallet lookup API URL (NETKI_LOOKUP_URL)")
+	fs.StringVar(&flags.Output, "o", "", "output format: table, json or yaml (NETKI_OUTPUT)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := loadConfig(*configPath, flags, getenv)
+	if err == nil {
+		var res *result
+		if res, err = dispatch(context.Background(), cfg, fs.Args()); err == nil {
+			err = writeResult(stdout, cfg.Output, res)
+		}
+	}
+
+	var usageErr *usageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintf(stderr, "netki: %s\n", err)
+		fs.Usage()
+		return 2
+	} else if err != nil {
+		fmt.Fprintf(stderr, "netki: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"github.com/bmizerany/assert"
+	"io/ioutil"
+	"netki/netkitest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testAddress = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+
+// runCLI runs the command with the server's credentials in the environment
+func runCLI(t *testing.T, server *netkitest.Server, args ...string) (int, string, string) {
+	env := map[string]string{
+		"NETKI_API_URL":    server.URL,
+		"NETKI_PARTNER_ID": server.PartnerID,
+		"NETKI_API_KEY":    server.APIKey,
+		"NETKI_LOOKUP_URL": server.URL + netkitest.LookupPath,
+	}
+	var stdout, stderr bytes.Buffer
+	code := run(args, func(key string) string { return env[key] }, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestPartnerCommands(t *testing.T) {
+	server := netkitest.NewServer()
+	defer server.Close()
+
+	code, out, _ := runCLI(t, server, "partner", "create", "Sub Partner")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "ID   NAME\nid1  Sub Partner\n", out)
+
+	code, out, _ = runCLI(t, server, "-o", "json", "partner", "list")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "[\n  {\n    \"id\": \"id1\",\n    \"name\": \"Sub Partner\"\n  }\n]\n", out)
+
+	code, out, _ = runCLI(t, server, "partner", "delete", "Sub Partner")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", out)
+
+	code, _, errOut := runCLI(t, server, "partner", "delete", "Sub Partner")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "netki: partner \"Sub Partner\" not found\n", errOut)
+}
+
+func TestDomainCommands(t *testing.T) {
+	server := netkitest.NewServer()
+	defer server.Close()
+	runCLI(t, server, "partner", "create", "sub")
+
+	code, out, _ := runCLI(t, server, "-o", "yaml", "domain", "create", "-partner", "sub", "domain.com")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "domain_name: domain.com\nstatus: completed\nnameservers:\n    - ns1.netkitest.invalid\n    - ns2.netkitest.invalid\n", out)
+
+	code, out, _ = runCLI(t, server, "domain", "list")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "DOMAIN\ndomain.com\n", out)
+
+	code, out, _ = runCLI(t, server, "domain", "status", "domain.com")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, true, strings.Contains(out, "domain.com  completed  true       0"))
+
+	code, out, _ = runCLI(t, server, "-o", "json", "domain", "dnssec", "domain.com")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, true, strings.Contains(out, `"ds_records": [`))
+
+	code, _, _ = runCLI(t, server, "domain", "delete", "domain.com")
+	assert.Equal(t, 0, code)
+	code, _, errOut := runCLI(t, server, "domain", "status", "domain.com")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "netki: Domain Not Found\n", errOut)
+}
+
+func TestWalletNameCommands(t *testing.T) {
+	server := netkitest.NewServer()
+	defer server.Close()
+	server.AddDomain("domain.com")
+
+	code, out, errOut := runCLI(t, server, "walletname", "set", "-external-id", "ext1", "domain.com", "wallet", "BTC", testAddress)
+	assert.Equal(t, 0, code, errOut)
+	assert.Equal(t, "ID   WALLET NAME        EXTERNAL ID  CURRENCY  ADDRESS\nid1  wallet.domain.com  ext1         btc       "+testAddress+"\n", out)
+
+	code, _, _ = runCLI(t, server, "walletname", "set", "domain.com", "Wallet", "dgc", "D59EzT12dqCapmcUBNzXhjgWZvruJ175AZ")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, 1, len(server.WalletNames("domain.com")))
+
+	code, out, _ = runCLI(t, server, "lookup", "wallet.domain.com", "dgc")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "WALLET NAME        CURRENCY  ADDRESS\nwallet.domain.com  dgc       D59EzT12dqCapmcUBNzXhjgWZvruJ175AZ\n", out)
+
+	code, out, _ = runCLI(t, server, "-o", "json", "walletname", "get", "domain.com", "WALLET")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, true, strings.Contains(out, `"external_id": "ext1"`))
+
+	code, _, _ = runCLI(t, server, "walletname", "remove-currency", "domain.com", "wallet", "btc")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "", server.WalletNames("domain.com")[0].GetAddress("btc"))
+
+	code, _, errOut = runCLI(t, server, "walletname", "remove-currency", "domain.com", "wallet", "btc")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "netki: wallet name wallet.domain.com has no btc address\n", errOut)
+
+	code, _, errOut = runCLI(t, server, "walletname", "set", "domain.com", "wallet", "btc", "1bad")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, true, strings.HasPrefix(errOut, `netki: Invalid btc Address "1bad"`))
+
+	code, _, _ = runCLI(t, server, "walletname", "delete", "domain.com", "wallet")
+	assert.Equal(t, 0, code)
+	assert.Equal(t, 0, len(server.WalletNames("")))
+}
+
+func TestUsageErrors(t *testing.T) {
+	server := netkitest.NewServer()
+	defer server.Close()
+
+	code, _, errOut := runCLI(t, server)
+	assert.Equal(t, 2, code)
+	assert.Equal(t, true, strings.HasPrefix(errOut, "Usage: netki"))
+
+	code, _, errOut = runCLI(t, server, "partner", "explode")
+	assert.Equal(t, 2, code)
+	assert.Equal(t, true, strings.HasPrefix(errOut, "netki: unknown command \"partner explode\"\n"))
+
+	code, _, errOut = runCLI(t, server, "walletname", "set", "domain.com")
+	assert.Equal(t, 2, code)
+	assert.Equal(t, true, strings.HasPrefix(errOut, "netki: walletname set takes 4 arguments\n"))
+
+	code, _, errOut = runCLI(t, server, "-o", "xml", "domain", "list")
+	assert.Equal(t, 2, code)
+	assert.Equal(t, true, strings.HasPrefix(errOut, "netki: unknown output format \"xml\"\n"))
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	ioutil.WriteFile(path, []byte("api_url: https://file.example\npartner_id: file-partner\napi_key: file-key\noutput: json\n"), 0600)
+
+	env := map[string]string{"NETKI_CONFIG": path, "NETKI_API_KEY": "env-key"}
+	getenv := func(key string) string { return env[key] }
+
+	cfg, err := loadConfig("", config{PartnerId: "flag-partner"}, getenv)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, config{ApiUrl: "https://file.example", PartnerId: "flag-partner", ApiKey: "env-key", Output: "json"}, cfg)
+
+	// JSON config files work too, and a missing default file is fine
+	jsonPath := filepath.Join(dir, "config.json")
+	ioutil.WriteFile(jsonPath, []byte(`{"partner_id": "json-partner", "api_key": "json-key"}`), 0600)
+	cfg, err = loadConfig(jsonPath, config{}, func(key string) string { return map[string]string{"HOME": dir}[key] })
+	assert.Equal(t, nil, err)
+	assert.Equal(t, config{ApiUrl: DefaultApiUrl, PartnerId: "json-partner", ApiKey: "json-key", Output: "table"}, cfg)
+
+	cfg, err = loadConfig("", config{}, func(key string) string { return map[string]string{"HOME": dir}[key] })
+	assert.Equal(t, nil, err)
+	_, err = cfg.partner()
+	assert.Equal(t, true, strings.HasPrefix(err.Error(), "no credentials"))
+
+	_, err = loadConfig(filepath.Join(dir, "missing.yaml"), config{}, getenv)
+	assert.NotEqual(t, nil, err)
+}
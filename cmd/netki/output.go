@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// result is the output of a command: rows under columns for tables, value
+// for JSON and YAML
+type result struct {
+	columns []string
+	rows    [][]string
+	value   interface{}
+}
+
+type partnerOutput struct {
+	Id   string `json:"id" yaml:"id"`
+	Name string `json:"name" yaml:"name"`
+}
+
+type domainOutput struct {
+	DomainName        string   `json:"domain_name" yaml:"domain_name"`
+	Status            string   `json:"status,omitempty" yaml:"status,omitempty"`
+	DelegationStatus  *bool    `json:"delegation_status,omitempty" yaml:"delegation_status,omitempty"`
+	DelegationMessage string   `json:"delegation_message,omitempty" yaml:"delegation_message,omitempty"`
+	WalletNameCount   *int     `json:"wallet_name_count,omitempty" yaml:"wallet_name_count,omitempty"`
+	Nameservers       []string `json:"nameservers,omitempty" yaml:"nameservers,omitempty"`
+	NextRollDate      string   `json:"next_roll_date,omitempty" yaml:"next_roll_date,omitempty"`
+	DsRecords         []string `json:"ds_records,omitempty" yaml:"ds_records,omitempty"`
+	PublicSigningKey  string   `json:"public_signing_key,omitempty" yaml:"public_signing_key,omitempty"`
+}
+
+type walletOutput struct {
+	Currency string `json:"currency" yaml:"currency"`
+	Address  string `json:"address" yaml:"address"`
+}
+
+type walletNameOutput struct {
+	Id         string         `json:"id" yaml:"id"`
+	DomainName string         `json:"domain_name" yaml:"domain_name"`
+	Name       string         `json:"name" yaml:"name"`
+	ExternalId string         `json:"external_id,omitempty" yaml:"external_id,omitempty"`
+	Wallets    []walletOutput `json:"wallets" yaml:"wallets"`
+}
+
+type lookupOutput struct {
+	WalletName string `json:"wallet_name" yaml:"wallet_name"`
+	Currency   string `json:"currency" yaml:"currency"`
+	Address    string `json:"address" yaml:"address"`
+}
+
+// writeResult prints res in format. Commands without output return a nil result.
+func writeResult(w io.Writer, format string, res *result) error {
+	if res == nil {
+		return nil
+	}
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(res.value, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(res.value)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(res.columns, "\t"))
+	for _, row := range res.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
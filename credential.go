@@ -0,0 +1,193 @@
+package netki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// ErrInvalidKeySignature is returned when a KeySignature does not match the user key
+var ErrInvalidKeySignature = errors.New("netki: invalid key signature")
+
+// SignUserKey issues the KeySignature for a user key: the partner's key signing
+// key signs the SHA-256 hash of the user's DER encoded (PKIX) public key.
+func SignUserKey(partnerKey crypto.Signer, userPub crypto.PublicKey) ([]byte, error) {
+	userDERHash, err := userKeyHash(userPub)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := partnerKey.Sign(rand.Reader, userDERHash, crypto.SHA256)
+	if err != nil {
+		return nil, &NetkiError{"Unable to Sign User Key", make([]string, 0)}
+	}
+	return sig, nil
+}
+
+// VerifyKeySignature checks that keySignature was issued for userPub by keySigningKey
+func VerifyKeySignature(keySigningKey *ecdsa.PublicKey, userPub crypto.PublicKey, keySignature []byte) error {
+	if keySigningKey == nil {
+		return ErrInvalidKeySignature
+	}
+	userDERHash, err := userKeyHash(userPub)
+	if err != nil {
+		return err
+	}
+	if !ecdsa.VerifyASN1(keySigningKey, userDERHash, keySignature) {
+		return ErrInvalidKeySignature
+	}
+	return nil
+}
+
+func userKeyHash(userPub crypto.PublicKey) ([]byte, error) {
+	userDER, err := x509.MarshalPKIXPublicKey(userPub)
+	if err != nil {
+		return nil, &KeyError{Reason: "unable to encode user public key", Err: err}
+	}
+	hash := sha256.Sum256(userDER)
+	return hash[:], nil
+}
+
+// UserCredential bundles what an end-user device needs to act as a key-signed
+// remote partner. UserKey is optional: a partner may hand out credentials for
+// keys the device generated itself and keeps behind a crypto.Signer.
+type UserCredential struct {
+	UserPublicKey *ecdsa.PublicKey
+	KeySigningKey *ecdsa.PublicKey
+	KeySignature  []byte
+	UserKey       *ecdsa.PrivateKey
+}
+
+// userCredentialJSON is the serialized form of a UserCredential, with keys
+// hex encoded as in the X-Identity and X-Partner-Key headers
+type userCredentialJSON struct {
+	UserPublicKey string `json:"user_public_key"`
+	KeySigningKey string `json:"key_signing_key"`
+	KeySignature  string `json:"key_signature"`
+	UserKey       string `json:"user_key,omitempty"`
+}
+
+// IssueUserCredential signs userPub with partnerKey and returns the resulting credential
+func IssueUserCredential(partnerKey *ecdsa.PrivateKey, userPub *ecdsa.PublicKey) (*UserCredential, error) {
+	keySignature, err := SignUserKey(partnerKey, userPub)
+	if err != nil {
+		return nil, err
+	}
+	return &UserCredential{UserPublicKey: userPub, KeySigningKey: &partnerKey.PublicKey, KeySignature: keySignature}, nil
+}
+
+// Verify checks the credential's key signature and that UserKey, when present, matches UserPublicKey
+func (c *UserCredential) Verify() error {
+	if c.UserPublicKey == nil {
+		return &KeyError{Reason: "credential has no user public key"}
+	}
+	if c.UserKey != nil && !c.UserKey.PublicKey.Equal(c.UserPublicKey) {
+		return &KeyError{Reason: "user key does not match user public key"}
+	}
+	return VerifyKeySignature(c.KeySigningKey, c.UserPublicKey, c.KeySignature)
+}
+
+// NewPartner builds a remote partner from the credential. userSigner holds the
+// user key; when nil the credential's own UserKey is used.
+func (c *UserCredential) NewPartner(apiUrl string, userSigner crypto.Signer) (*NetkiPartner, error) {
+	if userSigner == nil {
+		if c.UserKey == nil {
+			return nil, &KeyError{Reason: "credential has no user key and no signer was given"}
+		}
+		return NewNetkiRemotePartner(apiUrl, c.UserKey, c.KeySigningKey, c.KeySignature), nil
+	}
+
+	if c.UserPublicKey == nil {
+		return nil, &KeyError{Reason: "credential has no user public key"}
+	}
+	if pub, ok := userSigner.Public().(*ecdsa.PublicKey); !ok || !pub.Equal(c.UserPublicKey) {
+		return nil, &KeyError{Reason: "signer public key does not match user public key"}
+	}
+	return NewNetkiSignerPartner(apiUrl, userSigner, c.KeySigningKey, c.KeySignature), nil
+}
+
+func (c UserCredential) MarshalJSON() ([]byte, error) {
+	if c.UserPublicKey == nil {
+		return nil, &KeyError{Reason: "credential has no user public key"}
+	}
+	if c.KeySigningKey == nil {
+		return nil, &KeyError{Reason: "credential has no key signing key"}
+	}
+	userPub, err := x509.MarshalPKIXPublicKey(c.UserPublicKey)
+	if err != nil {
+		return nil, &KeyError{Reason: "unable to encode user public key", Err: err}
+	}
+	keySigningKey, err := x509.MarshalPKIXPublicKey(c.KeySigningKey)
+	if err != nil {
+		return nil, &KeyError{Reason: "unable to encode key signing key", Err: err}
+	}
+
+	out := userCredentialJSON{
+		UserPublicKey: hex.EncodeToString(userPub),
+		KeySigningKey: hex.EncodeToString(keySigningKey),
+		KeySignature:  hex.EncodeToString(c.KeySignature),
+	}
+	if c.UserKey != nil {
+		userKey, err := x509.MarshalECPrivateKey(c.UserKey)
+		if err != nil {
+			return nil, &KeyError{Reason: "unable to encode user key", Err: err}
+		}
+		out.UserKey = hex.EncodeToString(userKey)
+	}
+	return json.Marshal(out)
+}
+
+func (c *UserCredential) UnmarshalJSON(data []byte) error {
+	in := userCredentialJSON{}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	cred := UserCredential{}
+	var err error
+	if cred.UserPublicKey, err = parseECPublicKey([]byte(in.UserPublicKey), "user_public_key"); err != nil {
+		return err
+	}
+	if cred.KeySigningKey, err = parseECPublicKey([]byte(in.KeySigningKey), "key_signing_key"); err != nil {
+		return err
+	}
+	if cred.KeySignature, err = hex.DecodeString(in.KeySignature); err != nil {
+		return &NetkiError{fmt.Sprintf("Invalid Key Signature: %s", err), make([]string, 0)}
+	}
+	if in.UserKey != "" {
+		if cred.UserKey, err = parseECPrivateKey([]byte(in.UserKey), "user_key"); err != nil {
+			return err
+		}
+	}
+
+	*c = cred
+	return nil
+}
+
+// LoadUserCredential parses and verifies a serialized UserCredential
+func LoadUserCredential(data []byte) (*UserCredential, error) {
+	cred := &UserCredential{}
+	if err := json.Unmarshal(data, cred); err != nil {
+		return nil, err
+	}
+	if err := cred.Verify(); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// LoadUserCredentialFile reads a serialized UserCredential from a file
+func LoadUserCredentialFile(path string) (*UserCredential, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, &KeyError{Source: path, Reason: "unable to read file", Err: err}
+	}
+	return LoadUserCredential(data)
+}
@@ -0,0 +1,138 @@
+package netki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/bmizerany/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func getTestCredential(t *testing.T) (*ecdsa.PrivateKey, *UserCredential) {
+	partnerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	userKey := getTestUserKey(t)
+	cred, err := IssueUserCredential(partnerKey, &userKey.PublicKey)
+	assert.Equal(t, nil, err)
+	return partnerKey, cred
+}
+
+func TestSignUserKey(t *testing.T) {
+	partnerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	userKey := getTestUserKey(t)
+
+	sig, err := SignUserKey(partnerKey, &userKey.PublicKey)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, VerifyKeySignature(&partnerKey.PublicKey, &userKey.PublicKey, sig))
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, ErrInvalidKeySignature, VerifyKeySignature(&otherKey.PublicKey, &userKey.PublicKey, sig))
+	assert.Equal(t, ErrInvalidKeySignature, VerifyKeySignature(&partnerKey.PublicKey, &otherKey.PublicKey, sig))
+	assert.Equal(t, ErrInvalidKeySignature, VerifyKeySignature(nil, &userKey.PublicKey, sig))
+}
+
+func TestSignUserKeyMatchesHeaders(t *testing.T) {
+	partnerKey, cred := getTestCredential(t)
+	partner, err := cred.NewPartner("http://localhost:5000", getTestUserKey(t))
+	assert.Equal(t, nil, err)
+
+	req, err := NetkiRequester{}.newRequest(context.Background(), partner, "http://localhost:5000/v1/partner/walletname", "GET", "")
+	assert.Equal(t, nil, err)
+
+	identity, err := ParseECPublicKey([]byte(req.Header.Get("X-Identity")))
+	assert.Equal(t, nil, err)
+	ksk, err := ParseECPublicKey([]byte(req.Header.Get("X-Partner-Key")))
+	assert.Equal(t, nil, err)
+	keySig, err := hex.DecodeString(req.Header.Get("X-Partner-KeySig"))
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, true, ksk.Equal(&partnerKey.PublicKey))
+	assert.Equal(t, nil, VerifyKeySignature(ksk, identity, keySig))
+}
+
+func TestUserCredentialJSON(t *testing.T) {
+	_, cred := getTestCredential(t)
+	cred.UserKey = getTestUserKey(t)
+
+	data, err := json.Marshal(cred)
+	assert.Equal(t, nil, err)
+
+	loaded, err := LoadUserCredential(data)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, cred.KeySignature, loaded.KeySignature)
+	assert.Equal(t, true, loaded.KeySigningKey.Equal(cred.KeySigningKey))
+	assert.Equal(t, cred.UserKey.D, loaded.UserKey.D)
+
+	partner, err := loaded.NewPartner("http://localhost:5000", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, cred.KeySignature, partner.KeySignature)
+	assert.Equal(t, cred.UserKey.D, partner.UserKey.D)
+}
+
+func TestUserCredentialWithoutUserKey(t *testing.T) {
+	_, cred := getTestCredential(t)
+
+	data, err := json.Marshal(cred)
+	assert.Equal(t, nil, err)
+	raw := map[string]interface{}{}
+	json.Unmarshal(data, &raw)
+	_, hasUserKey := raw["user_key"]
+	assert.Equal(t, false, hasUserKey)
+
+	path := filepath.Join(t.TempDir(), "credential.json")
+	ioutil.WriteFile(path, data, 0600)
+	loaded, err := LoadUserCredentialFile(path)
+	assert.Equal(t, nil, err)
+
+	_, err = loaded.NewPartner("http://localhost:5000", nil)
+	assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+
+	partner, err := loaded.NewPartner("http://localhost:5000", getTestUserKey(t))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, (&NetkiPartner{UserKey: getTestUserKey(t)}).GetUserPublicKey(), partner.GetUserPublicKey())
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, err = loaded.NewPartner("http://localhost:5000", otherKey)
+	assert.Equal(t, "Unable to Load Key: signer public key does not match user public key", err.Error())
+}
+
+func TestLoadUserCredentialErrors(t *testing.T) {
+	_, cred := getTestCredential(t)
+	cred.KeySignature[len(cred.KeySignature)-1] ^= 0xff
+	data, _ := json.Marshal(cred)
+	_, err := LoadUserCredential(data)
+	assert.Equal(t, ErrInvalidKeySignature, err)
+
+	_, cred = getTestCredential(t)
+	cred.UserKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	data, _ = json.Marshal(cred)
+	_, err = LoadUserCredential(data)
+	assert.Equal(t, "Unable to Load Key: user key does not match user public key", err.Error())
+
+	_, err = LoadUserCredential([]byte(`{"user_public_key":"abcd"}`))
+	assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+
+	_, err = LoadUserCredentialFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+}
+
+func TestUserCredentialMarshalMissingKeys(t *testing.T) {
+	_, cred := getTestCredential(t)
+	cred.KeySigningKey = nil
+	_, err := json.Marshal(cred)
+	assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+
+	_, err = json.Marshal(UserCredential{})
+	assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+}
+
+func TestUserCredentialNewPartnerWithoutUserPublicKey(t *testing.T) {
+	_, err := (&UserCredential{}).NewPartner("http://localhost:5000", getTestUserKey(t))
+	assert.Equal(t, "Unable to Load Key: credential has no user public key", err.Error())
+	assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+}
@@ -0,0 +1,122 @@
+package netki
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Currency describes a currency wallet names can hold addresses for
+type Currency struct {
+	// Code is the canonical, lower case code the Netki API uses, e.g. "btc"
+	Code string
+	Name string
+
+	// Aliases are other codes and names normalized to Code, e.g. "bitcoin"
+	Aliases []string
+
+	// URIScheme is the scheme of the currency's payment URIs, empty when it has none
+	URIScheme string
+
+	// AddressFormats names the address encodings of the currency, e.g. "base58check"
+	AddressFormats []string
+
+	// Testnet is set on testnet currencies. TestnetCode is the code of the
+	// testnet variant of a mainnet currency, empty when it has none.
+	Testnet     bool
+	TestnetCode string
+}
+
+var (
+	currencyRegistryMu sync.RWMutex
+	currencyRegistry   = map[string]Currency{}
+	currencyAliases    = map[string]string{}
+)
+
+func init() {
+	for _, c := range []Currency{
+		{Code: "btc", Name: "Bitcoin", Aliases: []string{"bitcoin", "xbt"}, URIScheme: "bitcoin", AddressFormats: []string{"base58check", "bech32", "bech32m"}, TestnetCode: "tbtc"},
+		{Code: "tbtc", Name: "Bitcoin Testnet", Aliases: []string{"testnet", "bitcoin-testnet"}, URIScheme: "bitcoin", AddressFormats: []string{"base58check", "bech32", "bech32m"}, Testnet: true},
+		{Code: "ltc", Name: "Litecoin", Aliases: []string{"litecoin"}, URIScheme: "litecoin", AddressFormats: []string{"base58check", "bech32"}},
+		{Code: "dgc", Name: "Dogecoin", Aliases: []string{"doge", "dogecoin"}, URIScheme: "dogecoin", AddressFormats: []string{"base58check"}},
+		{Code: "nmc", Name: "Namecoin", Aliases: []string{"namecoin"}, URIScheme: "namecoin", AddressFormats: []string{"base58check"}},
+		{Code: "dash", Name: "Dash", URIScheme: "dash", AddressFormats: []string{"base58check"}},
+		{Code: "zec", Name: "Zcash", Aliases: []string{"zcash"}, URIScheme: "zcash", AddressFormats: []string{"base58check"}},
+		{Code: "eth", Name: "Ethereum", Aliases: []string{"ethereum", "ether"}, AddressFormats: []string{"eip55"}},
+	} {
+		RegisterCurrency(c)
+	}
+}
+
+// RegisterCurrency adds a currency to the registry, replacing any currency
+// with the same code
+func RegisterCurrency(c Currency) {
+	c.Code = strings.ToLower(strings.TrimSpace(c.Code))
+
+	currencyRegistryMu.Lock()
+	defer currencyRegistryMu.Unlock()
+	if old, ok := currencyRegistry[c.Code]; ok {
+		for _, alias := range old.Aliases {
+			delete(currencyAliases, strings.ToLower(alias))
+		}
+	}
+	currencyRegistry[c.Code] = c
+	for _, alias := range c.Aliases {
+		currencyAliases[strings.ToLower(alias)] = c.Code
+	}
+}
+
+// LookupCurrency finds a registered currency by code or alias, ignoring case
+func LookupCurrency(code string) (Currency, bool) {
+	currencyRegistryMu.RLock()
+	defer currencyRegistryMu.RUnlock()
+	code = strings.ToLower(strings.TrimSpace(code))
+	if alias, ok := currencyAliases[code]; ok {
+		code = alias
+	}
+	c, ok := currencyRegistry[code]
+	return c, ok
+}
+
+// NormalizeCurrency returns the canonical code of a currency code or alias.
+// Unregistered codes are lower cased and trimmed.
+func NormalizeCurrency(code string) string {
+	if c, ok := LookupCurrency(code); ok {
+		return c.Code
+	}
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// RegisteredCurrencies returns every registered currency, sorted by code
+func RegisteredCurrencies() []Currency {
+	currencyRegistryMu.RLock()
+	defer currencyRegistryMu.RUnlock()
+	currencies := make([]Currency, 0, len(currencyRegistry))
+	for _, c := range currencyRegistry {
+		currencies = append(currencies, c)
+	}
+	sort.Slice(currencies, func(i, j int) bool { return currencies[i].Code < currencies[j].Code })
+	return currencies
+}
+
+// GetSupportedCurrencies fetches the currencies the API accepts, filling in
+// metadata for those in the registry. Not every server publishes the list;
+// those answer with an error matching ErrNotFound, and callers can fall back
+// to RegisteredCurrencies.
+func (n NetkiPartner) GetSupportedCurrencies() ([]Currency, error) {
+	return n.GetSupportedCurrenciesContext(context.Background())
+}
+
+func (n NetkiPartner) GetSupportedCurrenciesContext(ctx context.Context) ([]Currency, error) {
+	currenciesResp := CurrenciesResponse{}
+	if err := requestInto(ctx, &n, "/v1/partner/currency", "GET", "", &currenciesResp); err != nil {
+		return make([]Currency, 0), err
+	}
+
+	currencies := make([]Currency, 0)
+	for _, p := range currenciesResp.Currencies {
+		currencies = append(currencies, p.currency())
+	}
+	return currencies, nil
+}
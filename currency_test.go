@@ -0,0 +1,111 @@
+package netki
+
+import (
+	"errors"
+	"github.com/bmizerany/assert"
+	"net/http"
+	"testing"
+)
+
+func TestLookupCurrency(t *testing.T) {
+	for _, code := range []string{"btc", "BTC", " Bitcoin ", "xbt"} {
+		c, ok := LookupCurrency(code)
+		assert.Equal(t, true, ok, code)
+		assert.Equal(t, "btc", c.Code)
+		assert.Equal(t, "Bitcoin", c.Name)
+		assert.Equal(t, "bitcoin", c.URIScheme)
+		assert.Equal(t, "tbtc", c.TestnetCode)
+	}
+
+	c, ok := LookupCurrency("doge")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "dgc", c.Code)
+
+	c, ok = LookupCurrency("tbtc")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, true, c.Testnet)
+
+	_, ok = LookupCurrency("xyz")
+	assert.Equal(t, false, ok)
+}
+
+func TestNormalizeCurrency(t *testing.T) {
+	assert.Equal(t, "btc", NormalizeCurrency("BTC"))
+	assert.Equal(t, "btc", NormalizeCurrency("bitcoin"))
+	assert.Equal(t, "ltc", NormalizeCurrency("Litecoin"))
+	assert.Equal(t, "xyz", NormalizeCurrency(" XYZ "))
+}
+
+func TestRegisterCurrency(t *testing.T) {
+	RegisterCurrency(Currency{Code: "XMPL", Name: "Example", Aliases: []string{"example"}})
+	c, ok := LookupCurrency("Example")
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "xmpl", c.Code)
+
+	// Re-registering replaces the aliases
+	RegisterCurrency(Currency{Code: "xmpl", Name: "Example", Aliases: []string{"sample"}})
+	_, ok = LookupCurrency("example")
+	assert.Equal(t, false, ok)
+	assert.Equal(t, "xmpl", NormalizeCurrency("sample"))
+
+	codes := make([]string, 0)
+	for _, c := range RegisteredCurrencies() {
+		codes = append(codes, c.Code)
+	}
+	assert.Equal(t, []string{"btc", "dash", "dgc", "eth", "ltc", "nmc", "tbtc", "xmpl", "zec"}, codes)
+
+	currencyRegistryMu.Lock()
+	delete(currencyRegistry, "xmpl")
+	delete(currencyAliases, "sample")
+	currencyRegistryMu.Unlock()
+}
+
+func TestWalletNameNormalizesCurrencies(t *testing.T) {
+	wn := getWalletName()
+	wn.Wallets = append(wn.Wallets, Wallet{"LTC", "Lltcaddress"})
+
+	assert.Equal(t, "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", wn.GetAddress("Bitcoin"))
+	assert.Equal(t, "Lltcaddress", wn.GetAddress("ltc"))
+	assert.Equal(t, []string{"btc", "ltc"}, wn.UsedCurrencies())
+
+	wn.SetCurrencyAddress("litecoin", "Lnewaddress")
+	assert.Equal(t, 2, len(wn.Wallets))
+	assert.Equal(t, Wallet{"ltc", "Lnewaddress"}, wn.Wallets[1])
+
+	wn.SetCurrencyAddress("DOGE", "Ddogeaddress")
+	assert.Equal(t, Wallet{"dgc", "Ddogeaddress"}, wn.Wallets[2])
+
+	wn.RemoveCurrency("BTC")
+	assert.Equal(t, []string{"ltc", "dgc"}, wn.UsedCurrencies())
+}
+
+func TestWalletNamePayloadNormalizesCurrencies(t *testing.T) {
+	wn := getWalletName()
+	wn.Wallets[0].Currency = "BTC"
+	assert.Equal(t, "btc", wn.payload().Wallets[0].Currency)
+}
+
+func TestGetSupportedCurrencies(t *testing.T) {
+	mockRequester := getMockRequester(`{"success":true,"currencies":[{"code":"btc"},{"code":"LTC","name":"Litecoin Classic"},{"code":"xyz","name":"Unknown Coin"}]}`, nil)
+	partner := &NetkiPartner{Requester: mockRequester}
+
+	currencies, err := partner.GetSupportedCurrencies()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "/v1/partner/currency", mockRequester.calledUri)
+	assert.Equal(t, "GET", mockRequester.calledMethod)
+	assert.Equal(t, 3, len(currencies))
+	assert.Equal(t, "Bitcoin", currencies[0].Name)
+	assert.Equal(t, "bitcoin", currencies[0].URIScheme)
+	assert.Equal(t, "ltc", currencies[1].Code)
+	assert.Equal(t, "Litecoin Classic", currencies[1].Name)
+	assert.Equal(t, Currency{Code: "xyz", Name: "Unknown Coin"}, currencies[2])
+}
+
+func TestGetSupportedCurrenciesUnavailable(t *testing.T) {
+	mockRequester := getMockRequester("", &APIError{StatusCode: http.StatusNotFound, Message: "Not Found"})
+	partner := &NetkiPartner{Requester: mockRequester}
+
+	currencies, err := partner.GetSupportedCurrencies()
+	assert.Equal(t, true, errors.Is(err, ErrNotFound))
+	assert.Equal(t, 0, len(currencies))
+}
@@ -0,0 +1,447 @@
+package netki
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultNameserver is queried when no nameserver is configured and none can be read from /etc/resolv.conf
+const DefaultNameserver = "127.0.0.1:53"
+
+// DefaultDNSTimeout bounds a single DNS exchange
+const DefaultDNSTimeout = 5 * time.Second
+
+// maxCNAMEHops limits how many CNAME records are followed for a single query
+const maxCNAMEHops = 8
+
+// maxIndirectionSize caps the body read from a URL indirection record
+const maxIndirectionSize = 64 << 10
+
+// LookupError is returned when a Wallet Name cannot be resolved from DNS
+type LookupError struct {
+	Name     string
+	Currency string
+	Reason   string
+	Err      error
+	notFound bool
+}
+
+func (e *LookupError) Error() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("Could not resolve ")
+	buffer.WriteString(e.Name)
+	if e.Currency != "" {
+		buffer.WriteString(" (")
+		buffer.WriteString(e.Currency)
+		buffer.WriteString(")")
+	}
+	buffer.WriteString(": ")
+	buffer.WriteString(e.Reason)
+	if e.Err != nil {
+		buffer.WriteString(": ")
+		buffer.WriteString(e.Err.Error())
+	}
+	return buffer.String()
+}
+
+func (e *LookupError) Unwrap() error {
+	return e.Err
+}
+
+func (e *LookupError) Is(target error) bool {
+	return target == ErrNotFound && e.notFound
+}
+
+// DNSResolver resolves Wallet Names from their DNS records instead of the
+// lookup API. The currencies of a Wallet Name are listed in a TXT record at
+// _wallet.<name>, and each address in a TXT record at _<currency>._wallet.<name>.
+// An address record may instead hold a base64 encoded URL the address is
+// fetched from.
+type DNSResolver struct {
+	// Nameserver is the host:port queried, the first nameserver in
+	// /etc/resolv.conf or DefaultNameserver when empty
+	Nameserver string
+
+	// Net is "udp" or "tcp". Over "udp", the default, truncated answers are
+	// retried over TCP.
+	Net string
+
+	// Timeout bounds each DNS exchange, DefaultDNSTimeout when zero
+	Timeout time.Duration
+
+	// HTTPClient fetches https URL indirection records, http.DefaultClient when nil
+	HTTPClient *http.Client
+
+	// TrustAnchors enables DNSSEC validation of every record used in a
+	// lookup, from these DS records down. See RootTrustAnchors and
+	// DomainTrustAnchors. Negative answers are not validated.
+	TrustAnchors []*dns.DS
+
+	// AllowBogus returns answers that fail DNSSEC validation, with
+	// DNSSECBogus status, instead of refusing them
+	AllowBogus bool
+}
+
+// LookupResult is a resolved address along with its DNSSEC status
+type LookupResult struct {
+	Name     string
+	Currency string
+	Address  string
+	DNSSEC   DNSSECStatus
+
+	// TTL is the lowest TTL of the DNS records the address was resolved from
+	TTL time.Duration
+}
+
+// Lookup resolves the address for a wallet name and currency
+func (r *DNSResolver) Lookup(name string, currency string) (string, error) {
+	return r.LookupContext(context.Background(), name, currency)
+}
+
+// LookupContext is like Lookup but carries ctx to the DNS and HTTP requests
+func (r *DNSResolver) LookupContext(ctx context.Context, name string, currency string) (string, error) {
+	result, err := r.Resolve(ctx, name, currency)
+	if err != nil {
+		return "", err
+	}
+	return result.Address, nil
+}
+
+// Resolve looks up the address for a wallet name and currency, reporting the
+// DNSSEC status of the records it was resolved from. Currencies are compared
+// by NormalizeCurrency, so "bitcoin" finds a Wallet Name listing "btc".
+func (r *DNSResolver) Resolve(ctx context.Context, name string, currency string) (*LookupResult, error) {
+	currency = NormalizeCurrency(currency)
+	v := r.newValidator(ctx)
+
+	labels, ttl, err := r.currencies(ctx, v, name)
+	if err != nil {
+		return nil, err
+	}
+	label := ""
+	for _, l := range labels {
+		if NormalizeCurrency(l) == currency {
+			label = l
+			break
+		}
+	}
+	if label == "" {
+		return nil, &LookupError{Name: name, Currency: currency, Reason: "currency not available", notFound: true}
+	}
+
+	result, err := r.resolveAddress(ctx, v, name, label)
+	if err != nil {
+		return nil, err
+	}
+	result.Currency = currency
+	if ttl < result.TTL {
+		result.TTL = ttl
+	}
+	return result, nil
+}
+
+// LookupAll resolves the addresses of every currency a Wallet Name lists. A
+// name with none fails with a LookupError matching ErrNotFound.
+func (r *DNSResolver) LookupAll(name string) ([]Wallet, error) {
+	return r.LookupAllContext(context.Background(), name)
+}
+
+// LookupAllContext is like LookupAll but carries ctx to the DNS and HTTP requests
+func (r *DNSResolver) LookupAllContext(ctx context.Context, name string) ([]Wallet, error) {
+	v := r.newValidator(ctx)
+	labels, _, err := r.currencies(ctx, v, name)
+	if errors.Is(err, ErrNotFound) {
+		return nil, noAddressesError(name)
+	} else if err != nil {
+		return nil, err
+	}
+
+	wallets := make([]Wallet, 0)
+	for _, label := range labels {
+		result, err := r.resolveAddress(ctx, v, name, label)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, Wallet{Currency: NormalizeCurrency(label), WalletAddress: result.Address})
+	}
+	if len(wallets) == 0 {
+		return nil, noAddressesError(name)
+	}
+	return wallets, nil
+}
+
+// noAddressesError is the error of a LookupAll that found no addresses
+func noAddressesError(name string) error {
+	return &LookupError{Name: name, Reason: "no addresses found", notFound: true}
+}
+
+// resolveAddress looks up the address record of a currency label listed for name
+func (r *DNSResolver) resolveAddress(ctx context.Context, v *validator, name string, currency string) (*LookupResult, error) {
+	values, ttl, err := r.queryTXT(ctx, v, "_"+currency+"._wallet."+name)
+	if err != nil {
+		return nil, r.lookupError(name, currency, "no address record", err)
+	}
+	if err := r.checkDNSSEC(v, name, currency); err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, &LookupError{Name: name, Currency: currency, Reason: "no address record", notFound: true}
+	}
+
+	result := &LookupResult{Name: name, Currency: currency, Address: strings.TrimSpace(values[0]), TTL: ttl}
+	if v != nil {
+		result.DNSSEC = v.status
+	}
+	if indirectUrl, ok := indirectionUrl(result.Address); ok {
+		result.Address, err = r.fetchIndirection(ctx, indirectUrl)
+		if err != nil {
+			return nil, &LookupError{Name: name, Currency: currency, Reason: "unable to follow URL record", Err: err}
+		}
+	}
+	return result, nil
+}
+
+// Currencies returns the normalized codes of the currencies a Wallet Name has
+// addresses for
+func (r *DNSResolver) Currencies(name string) ([]string, error) {
+	return r.CurrenciesContext(context.Background(), name)
+}
+
+// CurrenciesContext is like Currencies but carries ctx to the DNS requests
+func (r *DNSResolver) CurrenciesContext(ctx context.Context, name string) ([]string, error) {
+	labels, _, err := r.currencies(ctx, r.newValidator(ctx), name)
+	if err != nil {
+		return nil, err
+	}
+	currencies := make([]string, len(labels))
+	for i, label := range labels {
+		currencies[i] = NormalizeCurrency(label)
+	}
+	return currencies, nil
+}
+
+// currencies returns the currency labels listed for name, lower cased but
+// otherwise as published since they name the address records, along with the
+// record TTL
+func (r *DNSResolver) currencies(ctx context.Context, v *validator, name string) ([]string, time.Duration, error) {
+	values, ttl, err := r.queryTXT(ctx, v, "_wallet."+name)
+	if err != nil {
+		return nil, 0, r.lookupError(name, "", "no Wallet Name record", err)
+	}
+	if err := r.checkDNSSEC(v, name, ""); err != nil {
+		return nil, 0, err
+	}
+	if len(values) == 0 {
+		return nil, 0, &LookupError{Name: name, Reason: "no Wallet Name record", notFound: true}
+	}
+
+	currencies := make([]string, 0)
+	for _, value := range values {
+		for _, currency := range strings.Fields(value) {
+			currencies = append(currencies, strings.ToLower(currency))
+		}
+	}
+	return currencies, ttl, nil
+}
+
+// checkDNSSEC refuses bogus answers unless AllowBogus is set
+func (r *DNSResolver) checkDNSSEC(v *validator, name string, currency string) error {
+	if v == nil || v.status != DNSSECBogus || r.AllowBogus {
+		return nil
+	}
+	return &LookupError{Name: name, Currency: currency, Reason: "DNSSEC validation failed", Err: v.err}
+}
+
+// errNXDomain is returned by queryTXT when the queried name does not exist
+var errNXDomain = errors.New("no such domain")
+
+func (r *DNSResolver) lookupError(name string, currency string, notFoundReason string, err error) error {
+	if err == errNXDomain {
+		return &LookupError{Name: name, Currency: currency, Reason: notFoundReason, notFound: true}
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return err
+	}
+	return &LookupError{Name: name, Currency: currency, Reason: "DNS query failed", Err: err}
+}
+
+// queryTXT returns the TXT values at qname, following CNAME records, and the
+// lowest TTL of the records used. Each value is the concatenation of the
+// record's strings. Answers are validated when v is not nil.
+func (r *DNSResolver) queryTXT(ctx context.Context, v *validator, qname string) ([]string, time.Duration, error) {
+	qname = dns.Fqdn(qname)
+	var ttl uint32
+	seen := false
+	for hop := 0; hop <= maxCNAMEHops; hop++ {
+		resp, err := r.exchange(ctx, qname, dns.TypeTXT, v != nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		switch resp.Rcode {
+		case dns.RcodeSuccess:
+		case dns.RcodeNameError:
+			return nil, 0, errNXDomain
+		default:
+			return nil, 0, fmt.Errorf("server returned %s", dns.RcodeToString[resp.Rcode])
+		}
+		if v != nil {
+			v.checkAnswer(resp)
+		}
+		for _, rr := range resp.Answer {
+			if !seen || rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+				seen = true
+			}
+		}
+
+		values, target := txtAnswer(resp, qname)
+		if len(values) > 0 || target == "" {
+			return values, time.Duration(ttl) * time.Second, nil
+		}
+		qname = target
+	}
+	return nil, 0, fmt.Errorf("more than %d CNAME records followed", maxCNAMEHops)
+}
+
+// txtAnswer collects the TXT values for qname from resp, following any CNAME
+// chain within the answer. When the chain leads outside the answer, the name
+// it ends at is returned so it can be queried next.
+func txtAnswer(resp *dns.Msg, qname string) ([]string, string) {
+	owner := qname
+	for hop := 0; hop <= maxCNAMEHops; hop++ {
+		values := make([]string, 0)
+		var target string
+		for _, rr := range resp.Answer {
+			if !strings.EqualFold(rr.Header().Name, owner) {
+				continue
+			}
+			switch record := rr.(type) {
+			case *dns.TXT:
+				values = append(values, strings.Join(record.Txt, ""))
+			case *dns.CNAME:
+				target = record.Target
+			}
+		}
+
+		switch {
+		case len(values) > 0:
+			return values, ""
+		case target == "" && owner == qname:
+			return values, ""
+		case target == "":
+			return nil, owner
+		}
+		owner = target
+	}
+	return nil, owner
+}
+
+// exchange sends a single query, retrying truncated UDP answers over TCP.
+// With dnssec set, signatures are requested and the nameserver is asked not
+// to validate, so bogus answers reach the validator.
+func (r *DNSResolver) exchange(ctx context.Context, qname string, qtype uint16, dnssec bool) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(qname, qtype)
+	msg.RecursionDesired = true
+	msg.CheckingDisabled = dnssec
+	msg.SetEdns0(4096, dnssec)
+
+	network := r.Net
+	if network == "" {
+		network = "udp"
+	}
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultDNSTimeout
+	}
+
+	client := &dns.Client{Net: network, Timeout: timeout}
+	resp, _, err := client.ExchangeContext(ctx, msg, r.nameserver())
+	if err == nil && resp.Truncated && network == "udp" {
+		client.Net = "tcp"
+		resp, _, err = client.ExchangeContext(ctx, msg, r.nameserver())
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (r *DNSResolver) nameserver() string {
+	if r.Nameserver != "" {
+		return r.Nameserver
+	}
+	if conf, err := dns.ClientConfigFromFile("/etc/resolv.conf"); err == nil && len(conf.Servers) > 0 {
+		return net.JoinHostPort(conf.Servers[0], conf.Port)
+	}
+	return DefaultNameserver
+}
+
+// indirectionUrl reports whether an address record holds a base64 encoded URL
+func indirectionUrl(value string) (string, bool) {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", false
+	}
+	parsed, err := url.Parse(string(decoded))
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+// fetchIndirection fetches the address behind a URL record. Only https is
+// followed, since the address would otherwise carry the DNSSEC status of the
+// record without being authenticated.
+func (r *DNSResolver) fetchIndirection(ctx context.Context, indirectUrl string) (string, error) {
+	if !strings.HasPrefix(indirectUrl, "https://") {
+		return "", fmt.Errorf("%s is not an https URL", indirectUrl)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", indirectUrl, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", DefaultUserAgent)
+
+	client := r.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.Request.URL.Scheme != "https" {
+		return "", fmt.Errorf("%s redirected to %s", indirectUrl, resp.Request.URL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", indirectUrl, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxIndirectionSize))
+	if err != nil {
+		return "", err
+	}
+	address := strings.TrimSpace(string(body))
+	if address == "" {
+		return "", fmt.Errorf("%s returned no address", indirectUrl)
+	}
+	return address, nil
+}
@@ -0,0 +1,295 @@
+package netki
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/bmizerany/assert"
+	"github.com/miekg/dns"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Setup an in-process nameserver answering from a zone in presentation format
+type testZone struct {
+	mu        sync.Mutex
+	records   []dns.RR
+	truncate  bool
+	queries   []string
+	tcpServed int
+}
+
+func (z *testZone) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	question := req.Question[0]
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.queries = append(z.queries, question.Name)
+	if _, tcp := w.RemoteAddr().(*net.TCPAddr); tcp {
+		z.tcpServed++
+	} else if z.truncate {
+		resp.Truncated = true
+		w.WriteMsg(resp)
+		return
+	}
+
+	exists := false
+	owner := question.Name
+	for hop := 0; hop < 4; hop++ {
+		var target string
+		for _, rr := range z.records {
+			if !strings.EqualFold(rr.Header().Name, owner) {
+				continue
+			}
+			exists = true
+			rrtype := rr.Header().Rrtype
+			if sig, ok := rr.(*dns.RRSIG); ok {
+				rrtype = sig.TypeCovered
+			}
+			if rrtype == question.Qtype || rrtype == dns.TypeCNAME {
+				resp.Answer = append(resp.Answer, rr)
+			}
+			if cname, ok := rr.(*dns.CNAME); ok {
+				target = cname.Target
+			}
+		}
+		if target == "" || !strings.HasSuffix(target, ".test.") {
+			break
+		}
+		owner = target
+	}
+
+	if !exists {
+		resp.Rcode = dns.RcodeNameError
+	} else if len(resp.Answer) == 0 {
+		// NODATA, with any denial of existence records at the name
+		for _, rr := range z.records {
+			rrtype := rr.Header().Rrtype
+			if sig, ok := rr.(*dns.RRSIG); ok {
+				rrtype = sig.TypeCovered
+			}
+			if strings.EqualFold(rr.Header().Name, question.Name) && (rrtype == dns.TypeNSEC || rrtype == dns.TypeNSEC3) {
+				resp.Ns = append(resp.Ns, rr)
+			}
+		}
+	}
+	w.WriteMsg(resp)
+}
+
+func (z *testZone) add(rrs ...dns.RR) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.records = append(z.records, rrs...)
+}
+
+func mustRR(t *testing.T, record string) dns.RR {
+	rr, err := dns.NewRR(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+func setupDNS(t *testing.T, zone ...string) (*testZone, string) {
+	handler := &testZone{}
+	for _, record := range zone {
+		handler.records = append(handler.records, mustRR(t, record))
+	}
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	servers := []*dns.Server{{PacketConn: udp, Handler: handler}, {Listener: tcp, Handler: handler}}
+	for _, server := range servers {
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+		go server.ActivateAndServe()
+		<-started
+	}
+	t.Cleanup(func() {
+		for _, server := range servers {
+			server.Shutdown()
+		}
+	})
+	return handler, udp.LocalAddr().String()
+}
+
+func TestDNSResolverLookup(t *testing.T) {
+	_, nameserver := setupDNS(t,
+		`_wallet.wallet.domain.test. 300 IN TXT "btc ltc " "dgc"`,
+		`_btc._wallet.wallet.domain.test. 300 IN TXT "1btc" "address"`,
+		`_ltc._wallet.wallet.domain.test. 300 IN TXT "Lltcaddress"`,
+	)
+	resolver := &DNSResolver{Nameserver: nameserver}
+
+	currencies, err := resolver.Currencies("wallet.domain.test")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"btc", "ltc", "dgc"}, currencies)
+
+	address, err := resolver.Lookup("wallet.domain.test", "BTC")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1btcaddress", address)
+
+	address, err = resolver.Lookup("wallet.domain.test", "bitcoin")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1btcaddress", address)
+
+	address, err = (&Resolver{DNS: resolver}).Lookup("wallet.domain.test", "ltc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "Lltcaddress", address)
+
+	_, err = resolver.Lookup("wallet.domain.test", "eth")
+	assert.Equal(t, "Could not resolve wallet.domain.test (eth): currency not available", err.Error())
+	assert.Equal(t, true, errors.Is(err, ErrNotFound))
+
+	_, err = resolver.Lookup("wallet.domain.test", "dgc")
+	assert.Equal(t, "Could not resolve wallet.domain.test (dgc): no address record", err.Error())
+
+	_, err = resolver.Lookup("missing.domain.test", "btc")
+	assert.Equal(t, "Could not resolve missing.domain.test: no Wallet Name record", err.Error())
+	assert.Equal(t, true, errors.Is(err, ErrNotFound))
+}
+
+func TestDNSResolverCNAME(t *testing.T) {
+	zone, nameserver := setupDNS(t,
+		`_wallet.alias.domain.test. 300 IN CNAME _wallet.wallet.domain.test.`,
+		`_btc._wallet.alias.domain.test. 300 IN CNAME _btc._wallet.other.example.`,
+		`_wallet.wallet.domain.test. 300 IN TXT "btc"`,
+		`_btc._wallet.other.example. 300 IN TXT "1otheraddress"`,
+	)
+	resolver := &DNSResolver{Nameserver: nameserver}
+
+	address, err := resolver.Lookup("alias.domain.test", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1otheraddress", address)
+	zone.mu.Lock()
+	defer zone.mu.Unlock()
+	assert.Equal(t, []string{"_wallet.alias.domain.test.", "_btc._wallet.alias.domain.test.", "_btc._wallet.other.example."}, zone.queries)
+}
+
+func TestDNSResolverURLIndirection(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "1plainaddress")
+	}))
+	defer plain.Close()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/redirect":
+			http.Redirect(w, r, plain.URL+"/address", http.StatusFound)
+		default:
+			fmt.Fprintln(w, "1indirectaddress")
+		}
+	}))
+	defer server.Close()
+
+	_, nameserver := setupDNS(t,
+		`_wallet.wallet.domain.test. 300 IN TXT "btc ltc doge eth"`,
+		fmt.Sprintf(`_btc._wallet.wallet.domain.test. 300 IN TXT "%s"`, base64.StdEncoding.EncodeToString([]byte(server.URL+"/address"))),
+		fmt.Sprintf(`_ltc._wallet.wallet.domain.test. 300 IN TXT "%s"`, base64.StdEncoding.EncodeToString([]byte(server.URL+"/missing"))),
+		fmt.Sprintf(`_doge._wallet.wallet.domain.test. 300 IN TXT "%s"`, base64.StdEncoding.EncodeToString([]byte(plain.URL+"/address"))),
+		fmt.Sprintf(`_eth._wallet.wallet.domain.test. 300 IN TXT "%s"`, base64.StdEncoding.EncodeToString([]byte(server.URL+"/redirect"))),
+	)
+	resolver := &DNSResolver{Nameserver: nameserver, HTTPClient: server.Client()}
+
+	address, err := resolver.Lookup("wallet.domain.test", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1indirectaddress", address)
+
+	_, err = resolver.Lookup("wallet.domain.test", "ltc")
+	assert.Equal(t, true, strings.HasPrefix(err.Error(), "Could not resolve wallet.domain.test (ltc): unable to follow URL record: "))
+
+	// Plain http is never followed, even through a redirect
+	_, err = resolver.Lookup("wallet.domain.test", "doge")
+	assert.Equal(t, fmt.Sprintf("Could not resolve wallet.domain.test (doge): unable to follow URL record: %s/address is not an https URL", plain.URL), err.Error())
+	_, err = resolver.Lookup("wallet.domain.test", "eth")
+	assert.Equal(t, fmt.Sprintf("Could not resolve wallet.domain.test (eth): unable to follow URL record: %s/redirect redirected to %s/address", server.URL, plain.URL), err.Error())
+
+	// Base64 that does not decode to a URL is taken as the address
+	_, ok := indirectionUrl("YWJjZA==")
+	assert.Equal(t, false, ok)
+}
+
+func TestDNSResolverTruncatedRetriesTCP(t *testing.T) {
+	zone, nameserver := setupDNS(t,
+		`_wallet.wallet.domain.test. 300 IN TXT "btc"`,
+		`_btc._wallet.wallet.domain.test. 300 IN TXT "1btcaddress"`,
+	)
+	zone.mu.Lock()
+	zone.truncate = true
+	zone.mu.Unlock()
+
+	address, err := (&DNSResolver{Nameserver: nameserver}).Lookup("wallet.domain.test", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1btcaddress", address)
+	zone.mu.Lock()
+	assert.Equal(t, 2, zone.tcpServed)
+	zone.mu.Unlock()
+
+	address, err = (&DNSResolver{Nameserver: nameserver, Net: "tcp"}).Lookup("wallet.domain.test", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1btcaddress", address)
+	zone.mu.Lock()
+	assert.Equal(t, 4, zone.tcpServed)
+	zone.mu.Unlock()
+}
+
+func TestDNSResolverErrors(t *testing.T) {
+	listener, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	defer listener.Close()
+	resolver := &DNSResolver{Nameserver: listener.LocalAddr().String(), Timeout: 20 * time.Millisecond}
+
+	_, err := resolver.Lookup("wallet.domain.test", "btc")
+	assert.Equal(t, true, strings.HasPrefix(err.Error(), "Could not resolve wallet.domain.test: DNS query failed: "))
+	assert.Equal(t, false, errors.Is(err, ErrNotFound))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = resolver.LookupContext(ctx, "wallet.domain.test", "btc")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestDNSResolverLookupAll(t *testing.T) {
+	_, nameserver := setupDNS(t,
+		`_wallet.wallet.domain.test. 300 IN TXT "btc ltc dgc"`,
+		`_btc._wallet.wallet.domain.test. 300 IN TXT "1btcaddress"`,
+		`_ltc._wallet.wallet.domain.test. 300 IN TXT "Lltcaddress"`,
+		`_wallet.empty.domain.test. 300 IN TXT "dgc"`,
+		`_wallet.alias.domain.test. 300 IN TXT "XBT"`,
+		`_xbt._wallet.alias.domain.test. 300 IN TXT "1aliasaddress"`,
+	)
+	resolver := &Resolver{DNS: &DNSResolver{Nameserver: nameserver}}
+
+	wallets, err := resolver.LookupAll("wallet.domain.test")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []Wallet{{Currency: "btc", WalletAddress: "1btcaddress"}, {Currency: "ltc", WalletAddress: "Lltcaddress"}}, wallets)
+
+	_, err = resolver.LookupAll("missing.domain.test")
+	assert.Equal(t, true, errors.Is(err, ErrNotFound))
+	assert.Equal(t, "Could not resolve missing.domain.test: no addresses found", err.Error())
+
+	// Listing currencies without any address records is not found either
+	_, err = resolver.LookupAll("empty.domain.test")
+	assert.Equal(t, "Could not resolve empty.domain.test: no addresses found", err.Error())
+
+	// Currencies listed under an alias are reported by their code
+	wallets, err = resolver.LookupAll("alias.domain.test")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []Wallet{{Currency: "btc", WalletAddress: "1aliasaddress"}}, wallets)
+	address, err := resolver.Lookup("alias.domain.test", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1aliasaddress", address)
+}
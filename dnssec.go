@@ -0,0 +1,501 @@
+package netki
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"strings"
+	"time"
+)
+
+// ErrDNSSECBogus is matched by every DNSSECError
+var ErrDNSSECBogus = errors.New("netki: DNSSEC validation failed")
+
+// rootTrustAnchors are the IANA root zone KSK-2017 and KSK-2024 DS records
+const rootTrustAnchors = `
+. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+. IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16
+`
+
+// DNSSECStatus is the outcome of DNSSEC validation for a DNS lookup
+type DNSSECStatus int
+
+const (
+	// DNSSECUnchecked means no trust anchor was configured
+	DNSSECUnchecked DNSSECStatus = iota
+
+	// DNSSECSecure means every record was validated from a trust anchor
+	DNSSECSecure
+
+	// DNSSECInsecure means a record is in a zone proven to be unsigned, or
+	// outside every trust anchor
+	DNSSECInsecure
+
+	// DNSSECBogus means a record should have validated but did not
+	DNSSECBogus
+)
+
+func (s DNSSECStatus) String() string {
+	switch s {
+	case DNSSECUnchecked:
+		return "unchecked"
+	case DNSSECSecure:
+		return "secure"
+	case DNSSECInsecure:
+		return "insecure"
+	case DNSSECBogus:
+		return "bogus"
+	}
+	return fmt.Sprintf("DNSSECStatus(%d)", int(s))
+}
+
+// DNSSECError explains why a DNS answer is bogus
+type DNSSECError struct {
+	Name   string
+	Reason string
+	Err    error
+}
+
+func (e *DNSSECError) Error() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("DNSSEC Validation Failed for ")
+	buffer.WriteString(e.Name)
+	buffer.WriteString(": ")
+	buffer.WriteString(e.Reason)
+	if e.Err != nil {
+		buffer.WriteString(": ")
+		buffer.WriteString(e.Err.Error())
+	}
+	return buffer.String()
+}
+
+func (e *DNSSECError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DNSSECError) Is(target error) bool {
+	return target == ErrDNSSECBogus
+}
+
+// RootTrustAnchors returns the DS records of the DNS root zone keys
+func RootTrustAnchors() []*dns.DS {
+	anchors, err := ParseTrustAnchors(rootTrustAnchors)
+	if err != nil {
+		panic(err)
+	}
+	return anchors
+}
+
+// ParseTrustAnchors parses DS and DNSKEY records in zone file format. DNSKEY
+// records are converted to SHA-256 DS records.
+func ParseTrustAnchors(data string) ([]*dns.DS, error) {
+	anchors := make([]*dns.DS, 0)
+	parser := dns.NewZoneParser(strings.NewReader(data), ".", "")
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		switch anchor := rr.(type) {
+		case *dns.DS:
+			anchors = append(anchors, anchor)
+		case *dns.DNSKEY:
+			anchors = append(anchors, anchor.ToDS(dns.SHA256))
+		default:
+			return nil, &NetkiError{fmt.Sprintf("Invalid Trust Anchor: unexpected %s record", dns.TypeToString[rr.Header().Rrtype]), make([]string, 0)}
+		}
+	}
+	if err := parser.Err(); err != nil {
+		return nil, &NetkiError{fmt.Sprintf("Invalid Trust Anchor: %s", err), make([]string, 0)}
+	}
+	return anchors, nil
+}
+
+// DomainTrustAnchors parses the DS records of a Domain fetched with
+// GetDomainDnssec, so its Wallet Names can be validated without the root.
+func DomainTrustAnchors(domain Domain) ([]*dns.DS, error) {
+	var buffer bytes.Buffer
+	for _, record := range domain.DsRecords {
+		if _, err := dns.NewRR(record); err != nil {
+			buffer.WriteString(dns.Fqdn(domain.DomainName))
+			buffer.WriteString(" IN DS ")
+		}
+		buffer.WriteString(record)
+		buffer.WriteString("\n")
+	}
+	return ParseTrustAnchors(buffer.String())
+}
+
+// validator validates the answers of a single lookup, caching zone keys as
+// the chain of trust is walked down from the trust anchors
+type validator struct {
+	r      *DNSResolver
+	ctx    context.Context
+	now    time.Time
+	status DNSSECStatus
+	err    error
+	zones  map[string]*zoneKeys
+}
+
+type zoneKeys struct {
+	keys   []*dns.DNSKEY
+	status DNSSECStatus
+	err    error
+}
+
+// signedRRset is an RRset along with the signatures covering it
+type signedRRset struct {
+	rrs  []dns.RR
+	sigs []*dns.RRSIG
+}
+
+// newValidator returns nil when no trust anchors are configured
+func (r *DNSResolver) newValidator(ctx context.Context) *validator {
+	if len(r.TrustAnchors) == 0 {
+		return nil
+	}
+	return &validator{r: r, ctx: ctx, now: time.Now(), status: DNSSECSecure, zones: make(map[string]*zoneKeys)}
+}
+
+// checkAnswer validates every RRset in the answer section of resp
+func (v *validator) checkAnswer(resp *dns.Msg) {
+	for _, set := range rrsets(resp.Answer) {
+		v.record(v.verifyRRset(set))
+	}
+}
+
+// record folds the status of one RRset into the lookup status
+func (v *validator) record(status DNSSECStatus, err error) {
+	if status > v.status {
+		v.status = status
+	}
+	if err != nil && v.err == nil {
+		v.err = err
+	}
+}
+
+// verifyRRset checks the signatures of set against the validated keys of the signing zone
+func (v *validator) verifyRRset(set *signedRRset) (DNSSECStatus, error) {
+	owner := set.rrs[0].Header().Name
+	if len(set.sigs) == 0 {
+		return v.unsignedStatus(owner)
+	}
+
+	var lastErr error
+	for _, sig := range set.sigs {
+		if !dns.IsSubDomain(sig.SignerName, owner) {
+			lastErr = &DNSSECError{Name: owner, Reason: fmt.Sprintf("signer %s is not an ancestor", sig.SignerName)}
+			continue
+		}
+		if anchor := v.closestAnchor(owner); anchor != "" && !dns.IsSubDomain(anchor, sig.SignerName) {
+			// A signer above the trust anchor would otherwise be reported insecure
+			lastErr = &DNSSECError{Name: owner, Reason: fmt.Sprintf("signer %s is above trust anchor %s", sig.SignerName, anchor)}
+			continue
+		}
+		if !sig.ValidityPeriod(v.now) {
+			lastErr = &DNSSECError{Name: owner, Reason: "signature is expired or not yet valid"}
+			continue
+		}
+
+		keys := v.zoneKeys(sig.SignerName)
+		if keys.status == DNSSECInsecure {
+			return DNSSECInsecure, nil
+		}
+		if keys.err != nil {
+			lastErr = keys.err
+			continue
+		}
+		for _, key := range keys.keys {
+			if sig.KeyTag == key.KeyTag() && sig.Algorithm == key.Algorithm && sig.Verify(key, set.rrs) == nil {
+				return DNSSECSecure, nil
+			}
+		}
+		lastErr = &DNSSECError{Name: owner, Reason: fmt.Sprintf("%s signature does not verify", dns.TypeToString[sig.TypeCovered])}
+	}
+	return DNSSECBogus, lastErr
+}
+
+// zoneKeys returns the validated DNSKEY set of zone
+func (v *validator) zoneKeys(zone string) *zoneKeys {
+	zone = dns.CanonicalName(zone)
+	if keys, ok := v.zones[zone]; ok {
+		return keys
+	}
+
+	// Guard against signature loops while the keys are loaded
+	v.zones[zone] = &zoneKeys{status: DNSSECBogus, err: &DNSSECError{Name: zone, Reason: "chain of trust loops"}}
+	keys := v.loadZoneKeys(zone)
+	v.zones[zone] = keys
+	return keys
+}
+
+func (v *validator) loadZoneKeys(zone string) *zoneKeys {
+	dsRecords := v.anchorsFor(zone)
+	if len(dsRecords) == 0 {
+		if v.closestAnchor(zone) == "" {
+			return &zoneKeys{status: DNSSECInsecure}
+		}
+
+		resp, err := v.query(zone, dns.TypeDS)
+		if err != nil {
+			return &zoneKeys{status: DNSSECBogus, err: err}
+		}
+		set := findRRset(resp.Answer, zone, dns.TypeDS)
+		if set == nil {
+			unsigned, err := v.proveUnsigned(resp, zone)
+			if unsigned {
+				return &zoneKeys{status: DNSSECInsecure}
+			}
+			if err == nil {
+				err = &DNSSECError{Name: zone, Reason: "signed zone has no DS records"}
+			}
+			return &zoneKeys{status: DNSSECBogus, err: err}
+		}
+		if status, err := v.verifyRRset(set); status != DNSSECSecure {
+			return &zoneKeys{status: status, err: err}
+		}
+		for _, rr := range set.rrs {
+			dsRecords = append(dsRecords, rr.(*dns.DS))
+		}
+	}
+
+	resp, err := v.query(zone, dns.TypeDNSKEY)
+	if err != nil {
+		return &zoneKeys{status: DNSSECBogus, err: err}
+	}
+	set := findRRset(resp.Answer, zone, dns.TypeDNSKEY)
+	if set == nil {
+		return &zoneKeys{status: DNSSECBogus, err: &DNSSECError{Name: zone, Reason: "no DNSKEY records"}}
+	}
+
+	keys := make([]*dns.DNSKEY, 0)
+	for _, rr := range set.rrs {
+		keys = append(keys, rr.(*dns.DNSKEY))
+	}
+	for _, key := range keys {
+		if !matchesDS(key, dsRecords) {
+			continue
+		}
+		for _, sig := range set.sigs {
+			if sig.KeyTag == key.KeyTag() && sig.Algorithm == key.Algorithm && sig.ValidityPeriod(v.now) && sig.Verify(key, set.rrs) == nil {
+				return &zoneKeys{keys: keys, status: DNSSECSecure}
+			}
+		}
+	}
+	return &zoneKeys{status: DNSSECBogus, err: &DNSSECError{Name: zone, Reason: "DNSKEY set is not signed by a key matching a DS record"}}
+}
+
+// unsignedStatus decides whether an unsigned record at owner is expected, by
+// looking for an unsigned delegation between the closest trust anchor and owner
+func (v *validator) unsignedStatus(owner string) (DNSSECStatus, error) {
+	anchor := v.closestAnchor(owner)
+	if anchor == "" {
+		return DNSSECInsecure, nil
+	}
+
+	labels := dns.SplitDomainName(owner)
+	for i := len(labels) - dns.CountLabel(anchor) - 1; i >= 0; i-- {
+		name := dns.Fqdn(strings.Join(labels[i:], "."))
+		resp, err := v.query(name, dns.TypeDS)
+		if err != nil {
+			return DNSSECBogus, err
+		}
+
+		if set := findRRset(resp.Answer, name, dns.TypeDS); set != nil {
+			if status, err := v.verifyRRset(set); status != DNSSECSecure {
+				return status, err
+			}
+			continue
+		}
+		if resp.Rcode == dns.RcodeNameError || findRRset(resp.Answer, name, dns.TypeCNAME) != nil {
+			continue
+		}
+
+		unsigned, err := v.proveUnsigned(resp, name)
+		if err != nil {
+			return DNSSECBogus, err
+		}
+		if unsigned {
+			return DNSSECInsecure, nil
+		}
+	}
+	return DNSSECBogus, &DNSSECError{Name: owner, Reason: "answer is not signed"}
+}
+
+// proveUnsigned checks the NSEC or NSEC3 records of a DS NODATA answer,
+// reporting whether name is an unsigned delegation
+func (v *validator) proveUnsigned(resp *dns.Msg, name string) (bool, error) {
+	nsec3s := make([]*dns.NSEC3, 0)
+	for _, set := range rrsets(resp.Ns) {
+		switch set.rrs[0].(type) {
+		case *dns.NSEC, *dns.NSEC3:
+		default:
+			continue
+		}
+
+		status, err := v.verifyRRset(set)
+		if status == DNSSECInsecure {
+			return true, nil
+		}
+		if status != DNSSECSecure {
+			return false, err
+		}
+
+		for _, rr := range set.rrs {
+			switch denial := rr.(type) {
+			case *dns.NSEC:
+				if strings.EqualFold(denial.Hdr.Name, name) {
+					return delegatesWithoutDS(denial.TypeBitMap, name)
+				}
+				if dns.IsSubDomain(name, denial.NextDomain) && !strings.EqualFold(denial.NextDomain, name) {
+					// name is an empty non-terminal, so it cannot be a delegation
+					return false, nil
+				}
+			case *dns.NSEC3:
+				if denial.Match(name) {
+					return delegatesWithoutDS(denial.TypeBitMap, name)
+				}
+				nsec3s = append(nsec3s, denial)
+			}
+		}
+	}
+	if len(nsec3s) > 0 {
+		return optOutCovers(nsec3s, name)
+	}
+	return false, &DNSSECError{Name: name, Reason: "no proof that DS records do not exist"}
+}
+
+// optOutCovers checks the closest encloser proof of RFC 5155 section 8.6: an
+// NSEC3 record must match an ancestor of name, and the record covering the
+// next closer name must have the opt-out flag set
+func optOutCovers(nsec3s []*dns.NSEC3, name string) (bool, error) {
+	labels := dns.SplitDomainName(name)
+	for i := 1; i < len(labels); i++ {
+		encloser := dns.Fqdn(strings.Join(labels[i:], "."))
+		var match *dns.NSEC3
+		for _, nsec3 := range nsec3s {
+			if nsec3.Match(encloser) {
+				match = nsec3
+				break
+			}
+		}
+		if match == nil {
+			continue
+		}
+
+		present := make(map[uint16]bool)
+		for _, t := range match.TypeBitMap {
+			present[t] = true
+		}
+		if present[dns.TypeDNAME] || (present[dns.TypeNS] && !present[dns.TypeSOA]) {
+			return false, &DNSSECError{Name: name, Reason: fmt.Sprintf("closest encloser %s is a delegation", encloser)}
+		}
+
+		nextCloser := dns.Fqdn(strings.Join(labels[i-1:], "."))
+		for _, nsec3 := range nsec3s {
+			if nsec3.Cover(nextCloser) {
+				if nsec3.Flags&1 == 1 {
+					// Opt-out spans may contain unsigned delegations
+					return true, nil
+				}
+				return false, &DNSSECError{Name: name, Reason: "NSEC3 record covering the next closer name is not opt-out"}
+			}
+		}
+		return false, &DNSSECError{Name: name, Reason: "no NSEC3 record covers the next closer name"}
+	}
+	return false, &DNSSECError{Name: name, Reason: "no closest encloser proof that DS records do not exist"}
+}
+
+func delegatesWithoutDS(types []uint16, name string) (bool, error) {
+	present := make(map[uint16]bool)
+	for _, t := range types {
+		present[t] = true
+	}
+	if present[dns.TypeDS] {
+		return false, &DNSSECError{Name: name, Reason: "DS records are denied but listed as present"}
+	}
+	return present[dns.TypeNS] && !present[dns.TypeSOA], nil
+}
+
+func (v *validator) query(name string, qtype uint16) (*dns.Msg, error) {
+	resp, err := v.r.exchange(v.ctx, dns.Fqdn(name), qtype, true)
+	if err != nil {
+		return nil, &DNSSECError{Name: name, Reason: fmt.Sprintf("unable to fetch %s records", dns.TypeToString[qtype]), Err: err}
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return nil, &DNSSECError{Name: name, Reason: fmt.Sprintf("unable to fetch %s records: server returned %s", dns.TypeToString[qtype], dns.RcodeToString[resp.Rcode])}
+	}
+	return resp, nil
+}
+
+func (v *validator) anchorsFor(zone string) []*dns.DS {
+	anchors := make([]*dns.DS, 0)
+	for _, anchor := range v.r.TrustAnchors {
+		if strings.EqualFold(dns.Fqdn(anchor.Hdr.Name), zone) {
+			anchors = append(anchors, anchor)
+		}
+	}
+	return anchors
+}
+
+// closestAnchor returns the deepest trust anchor zone containing name
+func (v *validator) closestAnchor(name string) string {
+	closest := ""
+	for _, anchor := range v.r.TrustAnchors {
+		zone := dns.CanonicalName(anchor.Hdr.Name)
+		if dns.IsSubDomain(zone, name) && (closest == "" || dns.CountLabel(zone) > dns.CountLabel(closest)) {
+			closest = zone
+		}
+	}
+	return closest
+}
+
+func matchesDS(key *dns.DNSKEY, dsRecords []*dns.DS) bool {
+	for _, ds := range dsRecords {
+		if ds.KeyTag != key.KeyTag() || ds.Algorithm != key.Algorithm || !strings.EqualFold(dns.Fqdn(ds.Hdr.Name), key.Hdr.Name) {
+			continue
+		}
+		if digest := key.ToDS(ds.DigestType); digest != nil && strings.EqualFold(digest.Digest, ds.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// rrsets groups a message section into RRsets with their covering signatures
+func rrsets(section []dns.RR) []*signedRRset {
+	sets := make([]*signedRRset, 0)
+	index := make(map[string]*signedRRset)
+	key := func(name string, rrtype uint16) string {
+		return dns.CanonicalName(name) + "/" + dns.TypeToString[rrtype]
+	}
+
+	for _, rr := range section {
+		if _, ok := rr.(*dns.RRSIG); ok {
+			continue
+		}
+		k := key(rr.Header().Name, rr.Header().Rrtype)
+		if set, ok := index[k]; ok {
+			set.rrs = append(set.rrs, rr)
+		} else {
+			index[k] = &signedRRset{rrs: []dns.RR{rr}}
+			sets = append(sets, index[k])
+		}
+	}
+	for _, rr := range section {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			if set, ok := index[key(sig.Hdr.Name, sig.TypeCovered)]; ok {
+				set.sigs = append(set.sigs, sig)
+			}
+		}
+	}
+	return sets
+}
+
+func findRRset(section []dns.RR, name string, rrtype uint16) *signedRRset {
+	for _, set := range rrsets(section) {
+		header := set.rrs[0].Header()
+		if header.Rrtype == rrtype && strings.EqualFold(header.Name, name) {
+			return set
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package netki
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"github.com/bmizerany/assert"
+	"github.com/miekg/dns"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Setup zone signing keys for the in-process nameserver
+type testZoneKey struct {
+	key    *dns.DNSKEY
+	signer crypto.Signer
+}
+
+func newTestZoneKey(t *testing.T, zone string) *testZoneKey {
+	key := &dns.DNSKEY{Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 300}, Flags: 257, Protocol: 3, Algorithm: dns.ECDSAP256SHA256}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testZoneKey{key: key, signer: priv.(crypto.Signer)}
+}
+
+// signed returns rrs along with an RRSIG over each RRset
+func (k *testZoneKey) signed(t *testing.T, rrs ...dns.RR) []dns.RR {
+	signed := append([]dns.RR{}, rrs...)
+	for _, set := range rrsets(rrs) {
+		sig := &dns.RRSIG{
+			KeyTag:     k.key.KeyTag(),
+			SignerName: k.key.Hdr.Name,
+			Algorithm:  k.key.Algorithm,
+			Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+			Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+		}
+		if err := sig.Sign(k.signer, set.rrs); err != nil {
+			t.Fatal(err)
+		}
+		signed = append(signed, sig)
+	}
+	return signed
+}
+
+// setupSignedDNS serves a signed test. zone delegating securely to domain.test.
+// and insecurely to insecure.test., returning the test. trust anchor
+func setupSignedDNS(t *testing.T) (*testZone, string, *dns.DS, *testZoneKey) {
+	zone, nameserver := setupDNS(t)
+	rootKey := newTestZoneKey(t, "test.")
+	domainKey := newTestZoneKey(t, "domain.test.")
+
+	zone.add(rootKey.signed(t, rootKey.key)...)
+	zone.add(rootKey.signed(t, domainKey.key.ToDS(dns.SHA256))...)
+	zone.add(rootKey.signed(t, mustRR(t, `insecure.test. 300 IN NSEC zzz.test. NS RRSIG NSEC`))...)
+	zone.add(domainKey.signed(t, domainKey.key)...)
+	zone.add(domainKey.signed(t,
+		mustRR(t, `_wallet.wallet.domain.test. 300 IN TXT "btc"`),
+		mustRR(t, `_btc._wallet.wallet.domain.test. 300 IN TXT "1btcaddress"`),
+		mustRR(t, `_wallet.alias.domain.test. 300 IN CNAME _wallet.wallet.domain.test.`),
+	)...)
+	zone.add(
+		mustRR(t, `_wallet.wallet.insecure.test. 300 IN TXT "btc"`),
+		mustRR(t, `_btc._wallet.wallet.insecure.test. 300 IN TXT "1insecureaddress"`),
+	)
+	return zone, nameserver, rootKey.key.ToDS(dns.SHA256), domainKey
+}
+
+func TestDNSSECSecure(t *testing.T) {
+	_, nameserver, anchor, _ := setupSignedDNS(t)
+	resolver := &DNSResolver{Nameserver: nameserver, TrustAnchors: []*dns.DS{anchor}}
+
+	result, err := resolver.Resolve(context.Background(), "wallet.domain.test", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1btcaddress", result.Address)
+	assert.Equal(t, DNSSECSecure, result.DNSSEC)
+
+	currencies, err := resolver.Currencies("alias.domain.test")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"btc"}, currencies)
+}
+
+func TestDNSSECInsecure(t *testing.T) {
+	_, nameserver, anchor, _ := setupSignedDNS(t)
+	resolver := &DNSResolver{Nameserver: nameserver, TrustAnchors: []*dns.DS{anchor}}
+
+	result, err := resolver.Resolve(context.Background(), "wallet.insecure.test", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1insecureaddress", result.Address)
+	assert.Equal(t, DNSSECInsecure, result.DNSSEC)
+
+	// Names outside every trust anchor are insecure
+	other, _ := ParseTrustAnchors(`other. IN DS 1 13 2 0000000000000000000000000000000000000000000000000000000000000000`)
+	resolver.TrustAnchors = other
+	result, err = resolver.Resolve(context.Background(), "wallet.domain.test", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, DNSSECInsecure, result.DNSSEC)
+
+	// Without trust anchors nothing is validated
+	result, err = (&DNSResolver{Nameserver: nameserver}).Resolve(context.Background(), "wallet.domain.test", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, DNSSECUnchecked, result.DNSSEC)
+}
+
+func TestDNSSECBogus(t *testing.T) {
+	zone, nameserver, anchor, domainKey := setupSignedDNS(t)
+	tampered := mustRR(t, `_btc._wallet.tampered.domain.test. 300 IN TXT "1btcaddress"`)
+	zone.add(domainKey.signed(t, mustRR(t, `_wallet.tampered.domain.test. 300 IN TXT "btc"`), tampered)...)
+	tampered.(*dns.TXT).Txt = []string{"1attackeraddress"}
+	zone.add(mustRR(t, `_wallet.stripped.domain.test. 300 IN TXT "btc"`))
+
+	resolver := &DNSResolver{Nameserver: nameserver, TrustAnchors: []*dns.DS{anchor}}
+	_, err := resolver.Resolve(context.Background(), "tampered.domain.test", "btc")
+	assert.Equal(t, "Could not resolve tampered.domain.test (btc): DNSSEC validation failed: DNSSEC Validation Failed for _btc._wallet.tampered.domain.test.: TXT signature does not verify", err.Error())
+	assert.Equal(t, true, errors.Is(err, ErrDNSSECBogus))
+	assert.Equal(t, false, errors.Is(err, ErrNotFound))
+
+	_, err = resolver.Lookup("stripped.domain.test", "btc")
+	assert.Equal(t, "Could not resolve stripped.domain.test: DNSSEC validation failed: DNSSEC Validation Failed for _wallet.stripped.domain.test.: no proof that DS records do not exist", err.Error())
+
+	resolver.AllowBogus = true
+	result, err := resolver.Resolve(context.Background(), "tampered.domain.test", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1attackeraddress", result.Address)
+	assert.Equal(t, DNSSECBogus, result.DNSSEC)
+
+	// A trust anchor that does not match the zone keys fails the whole chain
+	resolver = &DNSResolver{Nameserver: nameserver, TrustAnchors: []*dns.DS{newTestZoneKey(t, "test.").key.ToDS(dns.SHA256)}}
+	_, err = resolver.Lookup("wallet.domain.test", "btc")
+	assert.Equal(t, true, errors.Is(err, ErrDNSSECBogus))
+	assert.Equal(t, true, strings.HasSuffix(err.Error(), "DNSSEC Validation Failed for test.: DNSKEY set is not signed by a key matching a DS record"))
+}
+
+func TestDNSSECSignerAboveAnchor(t *testing.T) {
+	zone, nameserver, _, domainKey := setupSignedDNS(t)
+	forgedKey := newTestZoneKey(t, "test.")
+	zone.add(forgedKey.signed(t, mustRR(t, `_wallet.forged.domain.test. 300 IN TXT "btc"`))...)
+
+	// The forged signer is outside the domain.test. trust anchor, so it must not downgrade to insecure
+	resolver := &DNSResolver{Nameserver: nameserver, TrustAnchors: []*dns.DS{domainKey.key.ToDS(dns.SHA256)}}
+	_, err := resolver.Currencies("forged.domain.test")
+	assert.Equal(t, true, errors.Is(err, ErrDNSSECBogus))
+	assert.Equal(t, "Could not resolve forged.domain.test: DNSSEC validation failed: DNSSEC Validation Failed for _wallet.forged.domain.test.: signer test. is above trust anchor domain.test.", err.Error())
+
+	currencies, err := resolver.Currencies("wallet.domain.test")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"btc"}, currencies)
+}
+
+func TestDNSSECExpiredSignature(t *testing.T) {
+	zone, nameserver, anchor, domainKey := setupSignedDNS(t)
+	records := domainKey.signed(t, mustRR(t, `_wallet.expired.domain.test. 300 IN TXT "btc"`))
+	sig := records[1].(*dns.RRSIG)
+	sig.Inception = uint32(time.Now().Add(-2 * time.Hour).Unix())
+	sig.Expiration = uint32(time.Now().Add(-time.Hour).Unix())
+	sig.Sign(domainKey.signer, records[:1])
+	zone.add(records...)
+
+	_, err := (&DNSResolver{Nameserver: nameserver, TrustAnchors: []*dns.DS{anchor}}).Currencies("expired.domain.test")
+	assert.Equal(t, "Could not resolve expired.domain.test: DNSSEC validation failed: DNSSEC Validation Failed for _wallet.expired.domain.test.: signature is expired or not yet valid", err.Error())
+}
+
+func TestDNSSECNSEC3OptOut(t *testing.T) {
+	_, nameserver, _, domainKey := setupSignedDNS(t)
+	resolver := &DNSResolver{Nameserver: nameserver, TrustAnchors: []*dns.DS{domainKey.key.ToDS(dns.SHA256)}}
+	denial := func(owner string, flags int) *dns.Msg {
+		hash := dns.HashName(owner, dns.SHA1, 0, "")
+		record := fmt.Sprintf("%s.domain.test. 300 IN NSEC3 1 %d 0 - %s NS SOA RRSIG DNSKEY NSEC3PARAM", hash, flags, hash)
+		return &dns.Msg{Ns: domainKey.signed(t, mustRR(t, record))}
+	}
+
+	unsigned, err := resolver.newValidator(context.Background()).proveUnsigned(denial("domain.test.", 1), "sub.domain.test.")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, unsigned)
+
+	unsigned, err = resolver.newValidator(context.Background()).proveUnsigned(denial("domain.test.", 0), "sub.domain.test.")
+	assert.Equal(t, false, unsigned)
+	assert.Equal(t, "DNSSEC Validation Failed for sub.domain.test.: NSEC3 record covering the next closer name is not opt-out", err.Error())
+
+	// An opt-out span alone is not enough without a closest encloser match
+	unsigned, err = resolver.newValidator(context.Background()).proveUnsigned(denial("other.domain.test.", 1), "sub.domain.test.")
+	assert.Equal(t, false, unsigned)
+	assert.Equal(t, "DNSSEC Validation Failed for sub.domain.test.: no closest encloser proof that DS records do not exist", err.Error())
+}
+
+func TestDNSSECStatusString(t *testing.T) {
+	assert.Equal(t, "unchecked", DNSSECUnchecked.String())
+	assert.Equal(t, "secure", DNSSECSecure.String())
+	assert.Equal(t, "insecure", DNSSECInsecure.String())
+	assert.Equal(t, "bogus", DNSSECBogus.String())
+	assert.Equal(t, "DNSSECStatus(9)", DNSSECStatus(9).String())
+}
+
+func TestParseTrustAnchors(t *testing.T) {
+	root := RootTrustAnchors()
+	assert.Equal(t, 2, len(root))
+	assert.Equal(t, uint16(20326), root[0].KeyTag)
+	assert.Equal(t, ".", root[0].Hdr.Name)
+
+	key := newTestZoneKey(t, "domain.test.")
+	anchors, err := ParseTrustAnchors(key.key.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, strings.EqualFold(key.key.ToDS(dns.SHA256).Digest, anchors[0].Digest))
+
+	_, err = ParseTrustAnchors(`domain.test. 300 IN TXT "not an anchor"`)
+	assert.Equal(t, "Invalid Trust Anchor: unexpected TXT record", err.Error())
+	_, err = ParseTrustAnchors(`domain.test. IN DS nonsense`)
+	assert.Equal(t, true, strings.HasPrefix(err.Error(), "Invalid Trust Anchor: "))
+
+	ds := key.key.ToDS(dns.SHA256)
+	domain := Domain{DomainName: "domain.test", DsRecords: []string{strings.TrimPrefix(ds.String(), ds.Hdr.String()), ds.String()}}
+	anchors, err = DomainTrustAnchors(domain)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(anchors))
+	assert.Equal(t, "domain.test.", anchors[0].Hdr.Name)
+	assert.Equal(t, true, strings.EqualFold(ds.Digest, anchors[1].Digest))
+}
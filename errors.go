@@ -0,0 +1,181 @@
+package netki
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors usable with errors.Is against errors returned by the client
+var (
+	ErrUnauthorized = errors.New("netki: unauthorized")
+	ErrValidation   = errors.New("netki: validation failed")
+	ErrNotFound     = errors.New("netki: not found")
+	ErrRateLimited  = errors.New("netki: rate limited")
+	ErrServer       = errors.New("netki: server error")
+	ErrTransport    = errors.New("netki: transport error")
+	ErrSchema       = errors.New("netki: response schema mismatch")
+)
+
+// Failure is a single entry of the "failures" array in an API error response.
+// Name is set when the failure concerns a specific wallet name.
+type Failure struct {
+	Field   string
+	Name    string
+	Message string
+}
+
+// APIError is returned when the partner API answers with success set to false
+// or with a response that cannot be understood.
+type APIError struct {
+	StatusCode int
+	Method     string
+	URI        string
+	Message    string
+	Failures   []Failure
+
+	// hasFailures records whether the server sent a failures array at all, so
+	// Error() renders exactly what it always has
+	hasFailures bool
+}
+
+func (e *APIError) Error() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(e.Message)
+	if e.hasFailures || len(e.Failures) > 0 {
+		buffer.WriteString(" [FAILURES: ")
+		buffer.WriteString(strings.Join(e.FailureMessages(), ", "))
+		buffer.WriteString("]")
+	}
+	return buffer.String()
+}
+
+// FailureMessages returns the message of every failure
+func (e *APIError) FailureMessages() []string {
+	messages := make([]string, 0)
+	for _, failure := range e.Failures {
+		messages = append(messages, failure.Message)
+	}
+	return messages
+}
+
+// Is maps the HTTP status code (and presence of failures) onto the sentinel errors
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= 500
+	case ErrValidation:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity || len(e.Failures) > 0
+	}
+	return false
+}
+
+// As lets callers that still match on *NetkiError keep working. The
+// NetkiError carries the server message with the failure messages in Failures.
+func (e *APIError) As(target interface{}) bool {
+	if t, ok := target.(**NetkiError); ok {
+		*t = &NetkiError{e.Message, e.FailureMessages()}
+		return true
+	}
+	return false
+}
+
+// TransportError is returned when the HTTP request itself could not be completed
+type TransportError struct {
+	Method string
+	URI    string
+	Err    error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("HTTP Request Failed: %s", e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TransportError) Is(target error) bool {
+	return target == ErrTransport
+}
+
+func (e *TransportError) As(target interface{}) bool {
+	if t, ok := target.(**NetkiError); ok {
+		*t = &NetkiError{e.Error(), make([]string, 0)}
+		return true
+	}
+	return false
+}
+
+// SchemaError is returned when a response cannot be decoded into its payload
+// type, or, with strict decoding, has unknown or missing fields.
+type SchemaError struct {
+	Payload string
+	Unknown []string
+	Missing []string
+	Err     error
+}
+
+func (e *SchemaError) Error() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("Unexpected ")
+	buffer.WriteString(e.Payload)
+	buffer.WriteString(" Data")
+	details := make([]string, 0)
+	if e.Err != nil {
+		details = append(details, e.Err.Error())
+	}
+	if len(e.Unknown) > 0 {
+		details = append(details, "unknown fields: "+strings.Join(e.Unknown, ", "))
+	}
+	if len(e.Missing) > 0 {
+		details = append(details, "missing fields: "+strings.Join(e.Missing, ", "))
+	}
+	if len(details) > 0 {
+		buffer.WriteString(" [")
+		buffer.WriteString(strings.Join(details, "; "))
+		buffer.WriteString("]")
+	}
+	return buffer.String()
+}
+
+func (e *SchemaError) Unwrap() error {
+	return e.Err
+}
+
+func (e *SchemaError) Is(target error) bool {
+	return target == ErrSchema
+}
+
+// newAPIError builds an APIError from the status of an API response
+func newAPIError(statusCode int, method string, uri string, status responseStatus) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Method:     method,
+		URI:        uri,
+		Message:    status.Message,
+		Failures:   make([]Failure, 0),
+	}
+
+	if status.Failures != nil {
+		apiErr.hasFailures = true
+		apiErr.Failures = failuresFromPayload(*status.Failures)
+	}
+	return apiErr
+}
+
+func failuresFromPayload(payloads []FailurePayload) []Failure {
+	failures := make([]Failure, 0)
+	for _, failure := range payloads {
+		failures = append(failures, Failure{Field: failure.Field, Name: failure.Name, Message: failure.Message})
+	}
+	return failures
+}
@@ -0,0 +1,78 @@
+package netki
+
+import (
+	"errors"
+	"github.com/bmizerany/assert"
+	"net/http"
+	"testing"
+)
+
+func TestAPIErrorFromResponse(t *testing.T) {
+	server, client := setupHttp(400, "application/json", `{"success":false,"message":"Error Message","failures":[{"field":"name","message":"fail1"},{"message":"fail2"}]}`)
+	defer server.Close()
+
+	requester := &NetkiRequester{HTTPClient: client}
+	_, err := requester.ProcessRequest(&NetkiPartner{}, "http://domain.com/uri", "PUT", "")
+
+	var apiErr *APIError
+	assert.Equal(t, true, errors.As(err, &apiErr))
+	assert.Equal(t, 400, apiErr.StatusCode)
+	assert.Equal(t, "PUT", apiErr.Method)
+	assert.Equal(t, "http://domain.com/uri", apiErr.URI)
+	assert.Equal(t, "Error Message", apiErr.Message)
+	assert.Equal(t, []Failure{{Field: "name", Message: "fail1"}, {Message: "fail2"}}, apiErr.Failures)
+	assert.Equal(t, "Error Message [FAILURES: fail1, fail2]", err.Error())
+	assert.Equal(t, true, errors.Is(err, ErrValidation))
+	assert.Equal(t, false, errors.Is(err, ErrNotFound))
+}
+
+func TestAPIErrorSentinels(t *testing.T) {
+	assert.Equal(t, true, errors.Is(&APIError{StatusCode: http.StatusUnauthorized}, ErrUnauthorized))
+	assert.Equal(t, true, errors.Is(&APIError{StatusCode: http.StatusForbidden}, ErrUnauthorized))
+	assert.Equal(t, true, errors.Is(&APIError{StatusCode: http.StatusNotFound}, ErrNotFound))
+	assert.Equal(t, true, errors.Is(&APIError{StatusCode: http.StatusTooManyRequests}, ErrRateLimited))
+	assert.Equal(t, true, errors.Is(&APIError{StatusCode: http.StatusBadGateway}, ErrServer))
+	assert.Equal(t, true, errors.Is(&APIError{StatusCode: http.StatusOK, Failures: []Failure{{Message: "bad"}}}, ErrValidation))
+	assert.Equal(t, false, errors.Is(&APIError{StatusCode: http.StatusOK}, ErrValidation))
+	assert.Equal(t, false, errors.Is(&APIError{StatusCode: http.StatusNotFound}, ErrTransport))
+}
+
+func TestAPIErrorNotJSONErrorStatus(t *testing.T) {
+	server, client := setupHttp(404, "text/html", "<html>Not Found</html>")
+	defer server.Close()
+
+	requester := &NetkiRequester{HTTPClient: client}
+	_, err := requester.ProcessRequest(&NetkiPartner{}, "http://domain.com/uri", "GET", "")
+
+	assert.Equal(t, true, errors.Is(err, ErrNotFound))
+	assert.Equal(t, "Error Retrieving JSON Data: invalid character '<' looking for beginning of value", err.Error())
+}
+
+func TestAPIErrorAsNetkiError(t *testing.T) {
+	var err error = &APIError{Message: "Error Message", hasFailures: true, Failures: []Failure{{Message: "fail1"}, {Message: "fail2"}}}
+
+	var netkiErr *NetkiError
+	assert.Equal(t, true, errors.As(err, &netkiErr))
+	assert.Equal(t, "Error Message", netkiErr.ErrorString)
+	assert.Equal(t, []string{"fail1", "fail2"}, netkiErr.Failures)
+	assert.Equal(t, "Error Message: fail1, fail2", netkiErr.Error())
+}
+
+func TestTransportError(t *testing.T) {
+	server, _ := setupFlakyHttp(0, 0, nil)
+	serverUrl := server.URL
+	server.Close()
+
+	requester := &NetkiRequester{}
+	_, err := requester.ProcessRequest(&NetkiPartner{ApiUrl: serverUrl}, "/uri", "DELETE", "")
+
+	var transportErr *TransportError
+	assert.Equal(t, true, errors.As(err, &transportErr))
+	assert.Equal(t, "DELETE", transportErr.Method)
+	assert.Equal(t, serverUrl+"/uri", transportErr.URI)
+	assert.Equal(t, true, errors.Is(err, ErrTransport))
+	assert.Equal(t, "HTTP Request Failed: "+transportErr.Err.Error(), err.Error())
+
+	var netkiErr *NetkiError
+	assert.Equal(t, true, errors.As(err, &netkiErr))
+}
@@ -82,7 +82,7 @@ func main() {
 
 	// Test WalletName CUD Cycle
 	wn := partner.CreateNewWalletName(domains[1], "golangtest", make([]netki.Wallet, 0), "goLangExternalId")
-	wn.SetCurrencyAddress("btc", "1dgkjsdfhlkjfsdhkjlsdfhsgdf")
+	wn.SetCurrencyAddress("btc", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2")
 	wn.GetAddress("btc")
 
 	usedCurrencies := wn.UsedCurrencies()
@@ -95,7 +95,7 @@ func main() {
 		handleErr(err)
 	}
 
-	wn.SetCurrencyAddress("dgc", "D548376529834756928376523")
+	wn.SetCurrencyAddress("dgc", "D59EzT12dqCapmcUBNzXhjgWZvruJ175AZ")
 	err = wn.Save(partner)
 	if err != nil {
 		handleErr(err)
@@ -0,0 +1,196 @@
+package netki
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DefaultExportPageSize is the number of wallet names an Exporter fetches per
+// request when PageSize is zero
+const DefaultExportPageSize = 500
+
+// ExportFormat is the encoding of a wallet name export
+type ExportFormat int
+
+const (
+	// ExportCSV writes a header row and then one row per wallet, under the
+	// columns of ExportColumns. A wallet name without wallets gets a single
+	// row with no currency or address. The rows can be read back by an
+	// Importer.
+	ExportCSV ExportFormat = iota
+
+	// ExportJSONLines writes one wallet name per line, encoded as the API
+	// encodes it
+	ExportJSONLines
+
+	// ExportJSON writes a single object in the shape of the API's wallet
+	// name listing, {"wallet_names":[...],"wallet_name_count":N}, with one
+	// wallet name per line
+	ExportJSON
+)
+
+// ExportColumns are the columns of ExportCSV, in order
+var ExportColumns = []string{"id", "domain_name", "name", "external_id", "currency", "address"}
+
+// Exporter writes every wallet name of one or more domains, fetching them a
+// page at a time and writing each as it arrives, so memory use does not grow
+// with the size of the domain. Wallets are written sorted by currency so
+// exports of unchanged domains are identical.
+type Exporter struct {
+	Partner *NetkiPartner
+	Format  ExportFormat
+
+	// PageSize is the number of wallet names fetched per request,
+	// DefaultExportPageSize when zero
+	PageSize int
+}
+
+// exportWriter encodes wallet names in one of the export formats
+type exportWriter interface {
+	write(payload WalletNamePayload) error
+	close(count int) error
+}
+
+// Export writes the wallet names of domains to w, or of every domain of the
+// partner, sorted by name, when none are given. It returns the number of
+// wallet names written.
+func (e *Exporter) Export(w io.Writer, domains ...Domain) (int, error) {
+	return e.ExportContext(context.Background(), w, domains...)
+}
+
+// ExportContext is like Export but carries ctx to the API requests
+func (e *Exporter) ExportContext(ctx context.Context, w io.Writer, domains ...Domain) (int, error) {
+	if e.Partner == nil {
+		return 0, &NetkiError{"Export Has No Partner", make([]string, 0)}
+	}
+	if len(domains) == 0 {
+		var err error
+		if domains, err = e.Partner.GetDomainsContext(ctx); err != nil {
+			return 0, err
+		}
+		sort.SliceStable(domains, func(i, j int) bool { return domains[i].DomainName < domains[j].DomainName })
+	}
+
+	buffered := bufio.NewWriter(w)
+	var out exportWriter
+	switch e.Format {
+	case ExportCSV:
+		out = &exportCSVWriter{writer: csv.NewWriter(buffered)}
+	case ExportJSONLines:
+		out = &exportJSONWriter{writer: buffered}
+	case ExportJSON:
+		out = &exportJSONWriter{writer: buffered, document: true}
+	default:
+		return 0, &NetkiError{fmt.Sprintf("Unknown Export Format %d", e.Format), make([]string, 0)}
+	}
+
+	pageSize := e.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultExportPageSize
+	}
+
+	count := 0
+	for _, domain := range domains {
+		it := e.Partner.IterateWalletNames(ctx, WalletNamesQuery{DomainName: domain.DomainName, PageSize: pageSize})
+		for it.Next() {
+			payload := it.WalletName().payload()
+			sort.SliceStable(payload.Wallets, func(i, j int) bool { return payload.Wallets[i].Currency < payload.Wallets[j].Currency })
+			if err := out.write(payload); err != nil {
+				it.Close()
+				return count, err
+			}
+			count++
+		}
+		it.Close()
+		if err := it.Err(); err != nil {
+			return count, err
+		}
+	}
+
+	if err := out.close(count); err != nil {
+		return count, err
+	}
+	return count, buffered.Flush()
+}
+
+type exportCSVWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (c *exportCSVWriter) write(payload WalletNamePayload) error {
+	if !c.headerWritten {
+		if err := c.writer.Write(ExportColumns); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	wallets := payload.Wallets
+	if len(wallets) == 0 {
+		wallets = []WalletPayload{{}}
+	}
+	for _, wallet := range wallets {
+		record := []string{payload.Id, payload.DomainName, payload.Name, payload.ExternalId, wallet.Currency, wallet.WalletAddress}
+		if err := c.writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *exportCSVWriter) close(count int) error {
+	if !c.headerWritten {
+		if err := c.writer.Write(ExportColumns); err != nil {
+			return err
+		}
+	}
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// exportJSONWriter writes JSON Lines, or when document is set the lines of a
+// single JSON object
+type exportJSONWriter struct {
+	writer   *bufio.Writer
+	document bool
+	started  bool
+}
+
+func (j *exportJSONWriter) write(payload WalletNamePayload) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	prefix := ""
+	if j.document && j.started {
+		prefix = ",\n"
+	} else if j.document {
+		prefix = "{\"wallet_names\":[\n"
+	}
+	suffix := "\n"
+	if j.document {
+		suffix = ""
+	}
+	j.started = true
+	_, err = fmt.Fprintf(j.writer, "%s%s%s", prefix, data, suffix)
+	return err
+}
+
+func (j *exportJSONWriter) close(count int) error {
+	if !j.document {
+		return nil
+	}
+	closing := "\n]"
+	if !j.started {
+		closing = "{\"wallet_names\":[]"
+	}
+	_, err := fmt.Fprintf(j.writer, "%s,\"wallet_name_count\":%d}\n", closing, count)
+	return err
+}
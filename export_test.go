@@ -0,0 +1,123 @@
+package netki
+
+import (
+	"bytes"
+	"errors"
+	"github.com/bmizerany/assert"
+	"strings"
+	"testing"
+)
+
+const exportPage = `{"wallet_name_count":2,"wallet_names":[` +
+	`{"id":"id0","domain_name":"domain.com","name":"wallet0","external_id":"ext0","wallets":[{"currency":"ltc","wallet_address":"LKE6iQNDR5YMYa82cvzGRzafu1Vt65SJJt"},{"currency":"BTC","wallet_address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}]},` +
+	`{"id":"id1","domain_name":"domain.com","name":"wallet1","external_id":"","wallets":[]}]}`
+
+func TestExportCSV(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{{returnData: exportPage}}}
+	exporter := &Exporter{Partner: &NetkiPartner{Requester: mockRequester}}
+
+	var out bytes.Buffer
+	count, err := exporter.Export(&out, Domain{DomainName: "domain.com"})
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, "id,domain_name,name,external_id,currency,address\n"+
+		"id0,domain.com,wallet0,ext0,btc,1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2\n"+
+		"id0,domain.com,wallet0,ext0,ltc,LKE6iQNDR5YMYa82cvzGRzafu1Vt65SJJt\n"+
+		"id1,domain.com,wallet1,,,\n", out.String())
+	assert.Equal(t, "/v1/partner/walletname?domain_name=domain.com&limit=500", mockRequester.calls[0].uri)
+}
+
+func TestExportCSVRoundTrip(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{{returnData: exportPage}}}
+	exporter := &Exporter{Partner: &NetkiPartner{Requester: mockRequester}}
+	var out bytes.Buffer
+	_, err := exporter.Export(&out, Domain{DomainName: "domain.com"})
+	assert.Equal(t, nil, err)
+
+	importer := &Importer{Domain: Domain{DomainName: "domain.com"}, DryRun: true}
+	result, err := importer.Import(&out)
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ImportProgress{Total: 2, Saved: 2}, result.ImportProgress)
+	assert.Equal(t, []Wallet{{"btc", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}, {"ltc", "LKE6iQNDR5YMYa82cvzGRzafu1Vt65SJJt"}}, result.WalletNames[0].Wallets)
+	assert.Equal(t, "wallet1", result.WalletNames[1].Name)
+	assert.Equal(t, 0, len(result.WalletNames[1].Wallets))
+}
+
+func TestExportJSONLines(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{{returnData: exportPage}}}
+	exporter := &Exporter{Partner: &NetkiPartner{Requester: mockRequester}, Format: ExportJSONLines}
+
+	var out bytes.Buffer
+	count, err := exporter.Export(&out, Domain{DomainName: "domain.com"})
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, `{"domain_name":"domain.com","external_id":"ext0","id":"id0","name":"wallet0","wallets":[{"currency":"btc","wallet_address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"},{"currency":"ltc","wallet_address":"LKE6iQNDR5YMYa82cvzGRzafu1Vt65SJJt"}]}`+"\n"+
+		`{"domain_name":"domain.com","external_id":"","id":"id1","name":"wallet1","wallets":[]}`+"\n", out.String())
+}
+
+func TestExportJSONAllDomains(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{
+		{returnData: `{"domains":[{"domain_name":"z.com"},{"domain_name":"a.com"}]}`},
+		{returnData: `{"wallet_name_count":1,"wallet_names":[{"id":"id0","domain_name":"a.com","name":"wallet0","external_id":"","wallets":[]}]}`},
+		{returnData: `{"wallet_name_count":0}`},
+	}}
+	exporter := &Exporter{Partner: &NetkiPartner{Requester: mockRequester}, Format: ExportJSON, PageSize: 10}
+
+	var out bytes.Buffer
+	count, err := exporter.Export(&out)
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 3, len(mockRequester.calls))
+	assert.Equal(t, "/v1/partner/walletname?domain_name=a.com&limit=10", mockRequester.calls[1].uri)
+	assert.Equal(t, "/v1/partner/walletname?domain_name=z.com&limit=10", mockRequester.calls[2].uri)
+
+	// The export decodes as a wallet name listing
+	resp := WalletNamesResponse{}
+	assert.Equal(t, nil, decodeJSON(out.Bytes(), &resp, false))
+	assert.Equal(t, 1, resp.WalletNameCount)
+	assert.Equal(t, "wallet0", resp.WalletNames[0].Name)
+	assert.Equal(t, true, strings.HasPrefix(out.String(), "{\"wallet_names\":[\n{"))
+}
+
+func TestExportJSONEmpty(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{{returnData: `{"wallet_name_count":0}`}}}
+	exporter := &Exporter{Partner: &NetkiPartner{Requester: mockRequester}, Format: ExportJSON}
+
+	var out bytes.Buffer
+	count, err := exporter.Export(&out, Domain{DomainName: "domain.com"})
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, count)
+	assert.Equal(t, "{\"wallet_names\":[],\"wallet_name_count\":0}\n", out.String())
+}
+
+func TestExportError(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{
+		{returnError: &NetkiError{"Server Unavailable", make([]string, 0)}},
+	}}
+	exporter := &Exporter{Partner: &NetkiPartner{Requester: mockRequester}}
+
+	var out bytes.Buffer
+	_, err := exporter.Export(&out, Domain{DomainName: "domain.com"})
+
+	assert.Equal(t, "Server Unavailable", err.Error())
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestExportWriteError(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{{returnData: exportPage}}}
+	exporter := &Exporter{Partner: &NetkiPartner{Requester: mockRequester}, Format: ExportJSONLines}
+
+	_, err := exporter.Export(failingWriter{}, Domain{DomainName: "domain.com"})
+
+	assert.Equal(t, "disk full", err.Error())
+}
@@ -0,0 +1,480 @@
+package netki
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ImportFormat is the encoding of a wallet name import
+type ImportFormat int
+
+const (
+	// ImportCSV is comma-separated values under a header row naming the
+	// name, currency and address columns, and optionally external_id, in
+	// any order. Other columns are ignored.
+	ImportCSV ImportFormat = iota
+
+	// ImportJSONLines is one JSON object per line with name, external_id,
+	// currency and address members
+	ImportJSONLines
+)
+
+// importCheckpointVersion is the format version of import checkpoint files
+const importCheckpointVersion = 1
+
+// maxImportLineLength bounds a single JSON Lines row
+const maxImportLineLength = 1024 * 1024
+
+// ImportRow is one currency address of a wallet name
+type ImportRow struct {
+	Name       string `json:"name"`
+	ExternalId string `json:"external_id"`
+	Currency   string `json:"currency"`
+	Address    string `json:"address"`
+}
+
+// ImportFailure is a wallet name, or a row without one, that was not imported
+type ImportFailure struct {
+	// Name is the wallet name, empty when the row could not be read
+	Name string
+
+	// Lines are the input lines of the wallet name's rows, counting from 1
+	Lines []int
+	Err   error
+}
+
+// ImportProgress counts the wallet names of an import
+type ImportProgress struct {
+	// Total is the number of wallet names in the input, counting each row
+	// that could not be read as one
+	Total int
+
+	// Saved wallet names were applied, or in a dry run would have been
+	Saved  int
+	Failed int
+
+	// Skipped wallet names were saved by an earlier run, per the checkpoint
+	Skipped int
+}
+
+// ImportResult is the outcome of an import
+type ImportResult struct {
+	ImportProgress
+
+	// WalletNames are the wallet names saved, with their Ids, or in a dry
+	// run those that would have been
+	WalletNames []WalletName
+	Failures    []ImportFailure
+}
+
+// Importer creates and updates the wallet names of a domain from CSV or JSON
+// Lines rows of name, external_id, currency and address. Rows are grouped
+// into one WalletName per name, in order of first appearance, with later
+// rows replacing earlier addresses of the same currency. A row with neither
+// currency nor address names a wallet name without adding an address, as an
+// Exporter writes wallet names that have none. Wallet names are
+// validated and then saved in batches; a wallet name with any bad row is
+// reported as a failure and not sent.
+//
+// With a CheckpointPath, the wallet names saved are recorded after every
+// batch, and a later run over the same input skips them, so an interrupted
+// import can be resumed.
+type Importer struct {
+	// Partner applies the import. A dry run without MergeExisting needs
+	// no Partner.
+	Partner *NetkiPartner
+
+	// Domain is the domain the wallet names belong to
+	Domain Domain
+	Format ImportFormat
+
+	// DryRun reads and validates the input without saving anything or
+	// writing the checkpoint
+	DryRun bool
+
+	// MergeExisting fetches the domain's wallet names first, so rows for
+	// existing names update them (PUT) rather than failing to create them,
+	// keeping currencies the rows do not mention
+	MergeExisting bool
+
+	// BatchSize is the number of wallet names saved between checkpoints
+	// and progress reports, the Partner's batch size when zero
+	BatchSize int
+
+	// CheckpointPath is the checkpoint file, none when empty
+	CheckpointPath string
+
+	// Progress is called once the input is validated and after every batch
+	Progress func(ImportProgress)
+}
+
+type importCheckpoint struct {
+	Version    int    `json:"version"`
+	DomainName string `json:"domain_name"`
+
+	// Saved maps the wallet names saved to their Ids
+	Saved map[string]string `json:"saved"`
+}
+
+// importGroup is the rows of one wallet name
+type importGroup struct {
+	key        string
+	walletName WalletName
+	externalId string
+	lines      []int
+	err        error
+}
+
+// Import reads r and applies it. Wallet names that fail are listed in the
+// result; the error is for failures that stop the whole import, such as
+// unreadable input or checkpoint.
+func (i *Importer) Import(r io.Reader) (*ImportResult, error) {
+	return i.ImportContext(context.Background(), r)
+}
+
+// ImportContext is like Import but carries ctx to the API requests. When ctx
+// is done the import stops after the current batch and returns ctx.Err().
+func (i *Importer) ImportContext(ctx context.Context, r io.Reader) (*ImportResult, error) {
+	result := &ImportResult{WalletNames: make([]WalletName, 0), Failures: make([]ImportFailure, 0)}
+	if i.Domain.DomainName == "" {
+		return result, &NetkiError{"Import Has No Domain", make([]string, 0)}
+	}
+	if i.Partner == nil && (!i.DryRun || i.MergeExisting) {
+		return result, &NetkiError{"Import Has No Partner", make([]string, 0)}
+	}
+	partner := NetkiPartner{}
+	if i.Partner != nil {
+		partner = *i.Partner
+	}
+
+	checkpoint, err := i.loadCheckpoint()
+	if err != nil {
+		return result, err
+	}
+
+	existing := make(map[string]WalletName)
+	if i.MergeExisting {
+		it := partner.IterateWalletNames(ctx, WalletNamesQuery{DomainName: i.Domain.DomainName, PageSize: i.batchSize(partner)})
+		for it.Next() {
+			wn := it.WalletName()
+			existing[importKey(wn.Name)] = wn
+		}
+		it.Close()
+		if err := it.Err(); err != nil {
+			return result, err
+		}
+	}
+
+	groups, err := i.readGroups(r, partner, existing, result)
+	if err != nil {
+		return result, err
+	}
+
+	pending := make([]*importGroup, 0)
+	for _, group := range groups {
+		result.Total++
+		if _, ok := checkpoint.Saved[group.key]; ok {
+			result.Skipped++
+			continue
+		}
+		if group.err == nil {
+			if _, _, err := group.walletName.ValidateName(); err != nil {
+				group.err = err
+			} else if !partner.SkipAddressValidation {
+				group.err = group.walletName.Validate(partner.Network)
+			}
+		}
+		if group.err != nil {
+			result.fail(group, group.err)
+			continue
+		}
+		pending = append(pending, group)
+	}
+	i.report(result)
+
+	size := i.batchSize(partner)
+	for start := 0; start < len(pending); start += size {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		end := start + size
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+
+		walletNames := make([]WalletName, len(batch))
+		for j, group := range batch {
+			walletNames[j] = group.walletName
+		}
+
+		failed := make(map[int]error)
+		if !i.DryRun {
+			err := partner.SaveWalletNamesContext(ctx, walletNames)
+			batchErr := &BatchError{}
+			if errors.As(err, &batchErr) {
+				for _, failure := range batchErr.Failures {
+					failed[failure.Index] = failure.Err
+				}
+			} else if err != nil {
+				for j := range batch {
+					failed[j] = err
+				}
+			}
+		}
+
+		for j, group := range batch {
+			if err, ok := failed[j]; ok {
+				result.fail(group, err)
+				continue
+			}
+			result.Saved++
+			result.WalletNames = append(result.WalletNames, walletNames[j])
+			checkpoint.Saved[group.key] = walletNames[j].Id
+		}
+
+		if !i.DryRun && i.CheckpointPath != "" {
+			if err := i.saveCheckpoint(checkpoint); err != nil {
+				return result, err
+			}
+		}
+		i.report(result)
+	}
+	return result, ctx.Err()
+}
+
+func (i *Importer) batchSize(partner NetkiPartner) int {
+	if i.BatchSize > 0 {
+		return i.BatchSize
+	}
+	return partner.batchSize()
+}
+
+func (i *Importer) report(result *ImportResult) {
+	if i.Progress != nil {
+		i.Progress(result.ImportProgress)
+	}
+}
+
+// readGroups reads every row of r and groups them by wallet name. Rows that
+// cannot be read, or have no name, are recorded as failures in result.
+func (i *Importer) readGroups(r io.Reader, partner NetkiPartner, existing map[string]WalletName, result *ImportResult) ([]*importGroup, error) {
+	groups := make([]*importGroup, 0)
+	byKey := make(map[string]*importGroup)
+
+	add := func(row ImportRow, line int, err error) {
+		row = ImportRow{
+			Name:       strings.TrimSpace(row.Name),
+			ExternalId: strings.TrimSpace(row.ExternalId),
+			Currency:   strings.TrimSpace(row.Currency),
+			Address:    strings.TrimSpace(row.Address),
+		}
+		if row.Name == "" {
+			if err == nil {
+				err = &NetkiError{"Import Row Missing Fields", []string{"name"}}
+			}
+			result.Total++
+			result.Failed++
+			result.Failures = append(result.Failures, ImportFailure{Lines: []int{line}, Err: err})
+			return
+		}
+
+		key := importKey(row.Name)
+		group, ok := byKey[key]
+		if !ok {
+			group = &importGroup{key: key}
+			if wn, ok := existing[key]; ok {
+				group.walletName = wn
+				group.walletName.Wallets = append(make([]Wallet, 0), wn.Wallets...)
+			} else {
+				group.walletName = partner.CreateNewWalletName(i.Domain, row.Name, make([]Wallet, 0), "")
+			}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.lines = append(group.lines, line)
+		if group.err != nil {
+			return
+		}
+
+		missing := make([]string, 0)
+		if row.Currency == "" {
+			missing = append(missing, "currency")
+		}
+		if row.Address == "" {
+			missing = append(missing, "address")
+		}
+		switch {
+		case err != nil:
+			group.err = err
+		case len(missing) == 1:
+			group.err = &NetkiError{"Import Row Missing Fields", missing}
+		case row.ExternalId != "" && group.externalId != "" && row.ExternalId != group.externalId:
+			group.err = &NetkiError{"Conflicting External Ids", []string{group.externalId, row.ExternalId}}
+		default:
+			if row.ExternalId != "" {
+				group.externalId = row.ExternalId
+				group.walletName.ExternalId = row.ExternalId
+			}
+			if len(missing) == 0 {
+				group.walletName.SetCurrencyAddress(row.Currency, row.Address)
+			}
+		}
+	}
+
+	var err error
+	switch i.Format {
+	case ImportCSV:
+		err = readImportCSV(r, add)
+	case ImportJSONLines:
+		err = readImportJSONLines(r, add)
+	default:
+		err = &NetkiError{fmt.Sprintf("Unknown Import Format %d", i.Format), make([]string, 0)}
+	}
+	return groups, err
+}
+
+// readImportCSV calls add with every row of r. Rows with the wrong number of
+// fields are passed with an error; other malformed input stops the read.
+func readImportCSV(r io.Reader, add func(row ImportRow, line int, err error)) error {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return &NetkiError{"Unable to Read Import: " + err.Error(), make([]string, 0)}
+	}
+	columns := make(map[string]int)
+	for index, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		columns[column] = index
+	}
+	missing := make([]string, 0)
+	for _, column := range []string{"name", "currency", "address"} {
+		if _, ok := columns[column]; !ok {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		return &NetkiError{"Import Missing Columns", missing}
+	}
+
+	field := func(record []string, column string) string {
+		if index, ok := columns[column]; ok && index < len(record) {
+			return record[index]
+		}
+		return ""
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if err != nil && !(errors.As(err, &parseErr) && parseErr.Err == csv.ErrFieldCount) {
+			return &NetkiError{"Unable to Read Import: " + err.Error(), make([]string, 0)}
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil {
+			err = &NetkiError{"Unable to Parse Import Row: " + err.Error(), make([]string, 0)}
+		}
+		add(ImportRow{
+			Name:       field(record, "name"),
+			ExternalId: field(record, "external_id"),
+			Currency:   field(record, "currency"),
+			Address:    field(record, "address"),
+		}, line, err)
+	}
+}
+
+// readImportJSONLines calls add with every non-blank line of r. Lines that
+// are not JSON objects are passed with an error.
+func readImportJSONLines(r io.Reader, add func(row ImportRow, line int, err error)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLineLength)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		row := ImportRow{}
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			add(ImportRow{}, line, &NetkiError{"Unable to Parse Import Row: " + err.Error(), make([]string, 0)})
+			continue
+		}
+		add(row, line, nil)
+	}
+	if err := scanner.Err(); err != nil {
+		return &NetkiError{"Unable to Read Import: " + err.Error(), make([]string, 0)}
+	}
+	return nil
+}
+
+// loadCheckpoint reads CheckpointPath, starting a new checkpoint when there
+// is no path or file
+func (i *Importer) loadCheckpoint() (*importCheckpoint, error) {
+	checkpoint := &importCheckpoint{Version: importCheckpointVersion, DomainName: i.Domain.DomainName, Saved: make(map[string]string)}
+	if i.CheckpointPath == "" {
+		return checkpoint, nil
+	}
+
+	data, err := ioutil.ReadFile(i.CheckpointPath)
+	if os.IsNotExist(err) {
+		return checkpoint, nil
+	} else if err != nil {
+		return nil, &NetkiError{"Unable to Read Import Checkpoint: " + err.Error(), make([]string, 0)}
+	}
+
+	file := importCheckpoint{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, &NetkiError{"Unable to Read Import Checkpoint: " + err.Error(), make([]string, 0)}
+	}
+	if file.Version != importCheckpointVersion {
+		return nil, &NetkiError{fmt.Sprintf("Unsupported Import Checkpoint Version %d", file.Version), make([]string, 0)}
+	}
+	if file.DomainName != i.Domain.DomainName {
+		return nil, &NetkiError{"Import Checkpoint Is For Another Domain", []string{file.DomainName}}
+	}
+	if file.Saved != nil {
+		checkpoint.Saved = file.Saved
+	}
+	return checkpoint, nil
+}
+
+func (i *Importer) saveCheckpoint(checkpoint *importCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(i.CheckpointPath, data); err != nil {
+		return &NetkiError{"Unable to Write Import Checkpoint: " + err.Error(), make([]string, 0)}
+	}
+	return nil
+}
+
+func (r *ImportResult) fail(group *importGroup, err error) {
+	r.Failed++
+	r.Failures = append(r.Failures, ImportFailure{Name: group.walletName.Name, Lines: group.lines, Err: err})
+}
+
+// importKey identifies the rows and checkpoint entries of a wallet name by its
+// ASCII form, which is how the API returns existing wallet names. Invalid names
+// fall back to lower case and fail when saved.
+func importKey(name string) string {
+	name = strings.TrimSpace(name)
+	if ascii, err := ToASCIIName(name); err == nil {
+		return ascii
+	}
+	return strings.ToLower(name)
+}
@@ -0,0 +1,219 @@
+package netki
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/bmizerany/assert"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const importCSV = `currency,Name,address,external_id,notes
+btc,wallet0,1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2,ext0,first
+ltc,wallet0,LKE6iQNDR5YMYa82cvzGRzafu1Vt65SJJt,,
+btc,wallet1,31hANjYptKcgNw8JZtfZabsqqKRKak39vG,,
+BTC,Wallet0,1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2,ext0,
+`
+
+func TestImportCSVDryRun(t *testing.T) {
+	importer := &Importer{Domain: Domain{DomainName: "domain.com"}, DryRun: true}
+	result, err := importer.Import(strings.NewReader(importCSV))
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ImportProgress{Total: 2, Saved: 2}, result.ImportProgress)
+	assert.Equal(t, 0, len(result.Failures))
+	assert.Equal(t, 2, len(result.WalletNames))
+
+	wn := result.WalletNames[0]
+	assert.Equal(t, "domain.com", wn.DomainName)
+	assert.Equal(t, "wallet0", wn.Name)
+	assert.Equal(t, "ext0", wn.ExternalId)
+	assert.Equal(t, []Wallet{{"btc", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}, {"ltc", "LKE6iQNDR5YMYa82cvzGRzafu1Vt65SJJt"}}, wn.Wallets)
+	assert.Equal(t, "wallet1", result.WalletNames[1].Name)
+	assert.Equal(t, "", result.WalletNames[1].ExternalId)
+}
+
+func TestImportCSVMissingColumns(t *testing.T) {
+	importer := &Importer{Domain: Domain{DomainName: "domain.com"}, DryRun: true}
+	_, err := importer.Import(strings.NewReader("name,currency\nwallet0,btc\n"))
+
+	assert.Equal(t, "Import Missing Columns: address", err.Error())
+}
+
+func TestImportCSVBadRows(t *testing.T) {
+	input := "name,currency,address\n" +
+		"wallet0,btc\n" +
+		"wallet0,ltc,LKE6iQNDR5YMYa82cvzGRzafu1Vt65SJJt\n" +
+		",btc,1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2\n" +
+		"wallet1,btc,1bad\n"
+	importer := &Importer{Domain: Domain{DomainName: "domain.com"}, DryRun: true}
+	result, err := importer.Import(strings.NewReader(input))
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ImportProgress{Total: 3, Failed: 3}, result.ImportProgress)
+	assert.Equal(t, 3, len(result.Failures))
+
+	assert.Equal(t, "", result.Failures[0].Name)
+	assert.Equal(t, []int{4}, result.Failures[0].Lines)
+	assert.Equal(t, "Import Row Missing Fields: name", result.Failures[0].Err.Error())
+
+	assert.Equal(t, "wallet0", result.Failures[1].Name)
+	assert.Equal(t, []int{2, 3}, result.Failures[1].Lines)
+	assert.Equal(t, true, strings.HasPrefix(result.Failures[1].Err.Error(), "Unable to Parse Import Row"))
+
+	assert.Equal(t, "wallet1", result.Failures[2].Name)
+	assert.Equal(t, true, errors.Is(result.Failures[2].Err, ErrValidation))
+}
+
+func TestImportJSONLines(t *testing.T) {
+	input := `{"name":"wallet0","external_id":"ext0","currency":"btc","address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}
+
+{"name":"wallet1","external_id":"ext1","currency":"btc","address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}
+not json
+{"name":"wallet1","external_id":"other","currency":"ltc","address":"LKE6iQNDR5YMYa82cvzGRzafu1Vt65SJJt"}
+{"name":"-wallet2","currency":"btc","address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}
+`
+	importer := &Importer{Domain: Domain{DomainName: "domain.com"}, Format: ImportJSONLines, DryRun: true}
+	result, err := importer.Import(strings.NewReader(input))
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ImportProgress{Total: 4, Saved: 1, Failed: 3}, result.ImportProgress)
+	assert.Equal(t, "wallet0", result.WalletNames[0].Name)
+
+	assert.Equal(t, []int{4}, result.Failures[0].Lines)
+	assert.Equal(t, "wallet1", result.Failures[1].Name)
+	assert.Equal(t, []int{3, 5}, result.Failures[1].Lines)
+	assert.Equal(t, "Conflicting External Ids: ext1, other", result.Failures[1].Err.Error())
+	assert.Equal(t, "-wallet2", result.Failures[2].Name)
+	assert.Equal(t, true, errors.Is(result.Failures[2].Err, ErrInvalidHyphen))
+}
+
+func TestImportRequiresPartner(t *testing.T) {
+	importer := &Importer{Domain: Domain{DomainName: "domain.com"}}
+	_, err := importer.Import(strings.NewReader(importCSV))
+
+	assert.Equal(t, "Import Has No Partner", err.Error())
+}
+
+func TestImportCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "import.json")
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{
+		{returnData: `{"wallet_names":[{"id":"id0"}]}`},
+		{returnError: &NetkiError{"Server Unavailable", make([]string, 0)}},
+	}}
+	progress := make([]ImportProgress, 0)
+	importer := &Importer{
+		Partner:        &NetkiPartner{Requester: mockRequester},
+		Domain:         Domain{DomainName: "domain.com"},
+		BatchSize:      1,
+		CheckpointPath: path,
+		Progress:       func(p ImportProgress) { progress = append(progress, p) },
+	}
+	result, err := importer.Import(strings.NewReader(importCSV))
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ImportProgress{Total: 2, Saved: 1, Failed: 1}, result.ImportProgress)
+	assert.Equal(t, "id0", result.WalletNames[0].Id)
+	assert.Equal(t, "wallet1", result.Failures[0].Name)
+	assert.Equal(t, "Server Unavailable", result.Failures[0].Err.Error())
+	assert.Equal(t, []ImportProgress{{Total: 2}, {Total: 2, Saved: 1}, {Total: 2, Saved: 1, Failed: 1}}, progress)
+	assert.Equal(t, 2, len(mockRequester.calls))
+	assert.Equal(t, "POST", mockRequester.calls[0].method)
+
+	data, err := ioutil.ReadFile(path)
+	assert.Equal(t, nil, err)
+	checkpoint := importCheckpoint{}
+	assert.Equal(t, nil, json.Unmarshal(data, &checkpoint))
+	assert.Equal(t, importCheckpoint{Version: 1, DomainName: "domain.com", Saved: map[string]string{"wallet0": "id0"}}, checkpoint)
+
+	// The second run only sends the wallet name that failed
+	mockRequester = &SequenceNetkiRequester{responses: []mockResponse{
+		{returnData: `{"wallet_names":[{"id":"id1"}]}`},
+	}}
+	importer.Partner = &NetkiPartner{Requester: mockRequester}
+	result, err = importer.Import(strings.NewReader(importCSV))
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ImportProgress{Total: 2, Saved: 1, Skipped: 1}, result.ImportProgress)
+	assert.Equal(t, 1, len(mockRequester.calls))
+	assert.Equal(t, true, strings.Contains(mockRequester.calls[0].bodyData, `"name":"wallet1"`))
+
+	data, _ = ioutil.ReadFile(path)
+	assert.Equal(t, nil, json.Unmarshal(data, &checkpoint))
+	assert.Equal(t, map[string]string{"wallet0": "id0", "wallet1": "id1"}, checkpoint.Saved)
+}
+
+func TestImportDryRunSkipsCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "import.json")
+	mockRequester := &SequenceNetkiRequester{}
+	importer := &Importer{Partner: &NetkiPartner{Requester: mockRequester}, Domain: Domain{DomainName: "domain.com"}, DryRun: true, CheckpointPath: path}
+	result, err := importer.Import(strings.NewReader(importCSV))
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, result.Saved)
+	assert.Equal(t, 0, len(mockRequester.calls))
+	_, err = ioutil.ReadFile(path)
+	assert.Equal(t, true, err != nil)
+}
+
+func TestImportCheckpointOtherDomain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "import.json")
+	assert.Equal(t, nil, ioutil.WriteFile(path, []byte(`{"version":1,"domain_name":"other.com","saved":{}}`), 0600))
+
+	importer := &Importer{Domain: Domain{DomainName: "domain.com"}, DryRun: true, CheckpointPath: path}
+	_, err := importer.Import(strings.NewReader(importCSV))
+
+	assert.Equal(t, "Import Checkpoint Is For Another Domain: other.com", err.Error())
+}
+
+func TestImportMergeExisting(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{
+		{returnData: `{"wallet_name_count":1,"wallet_names":[{"id":"id0","domain_name":"domain.com","name":"wallet0","external_id":"ext0","wallets":[{"currency":"dgc","wallet_address":"D59EzT12dqCapmcUBNzXhjgWZvruJ175AZ"}]}]}`},
+		{returnData: `{"wallet_names":[{"id":"id1"}]}`},
+		{returnData: `{"wallet_names":[{"id":"id0"}]}`},
+	}}
+	importer := &Importer{Partner: &NetkiPartner{Requester: mockRequester}, Domain: Domain{DomainName: "domain.com"}, MergeExisting: true}
+	result, err := importer.Import(strings.NewReader(importCSV))
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ImportProgress{Total: 2, Saved: 2}, result.ImportProgress)
+	assert.Equal(t, 3, len(mockRequester.calls))
+	assert.Equal(t, "GET", mockRequester.calls[0].method)
+	assert.Equal(t, "POST", mockRequester.calls[1].method)
+	assert.Equal(t, "PUT", mockRequester.calls[2].method)
+
+	wn := result.WalletNames[0]
+	assert.Equal(t, "id0", wn.Id)
+	assert.Equal(t, []Wallet{{"dgc", "D59EzT12dqCapmcUBNzXhjgWZvruJ175AZ"}, {"btc", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}, {"ltc", "LKE6iQNDR5YMYa82cvzGRzafu1Vt65SJJt"}}, wn.Wallets)
+}
+
+func TestImportMergeExistingIDN(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{
+		{returnData: `{"wallet_name_count":1,"wallet_names":[{"id":"id0","domain_name":"domain.com","name":"xn--bcher-kva","wallets":[{"currency":"dgc","wallet_address":"D59EzT12dqCapmcUBNzXhjgWZvruJ175AZ"}]}]}`},
+		{returnData: `{"wallet_names":[{"id":"id0"}]}`},
+	}}
+	importer := &Importer{Partner: &NetkiPartner{Requester: mockRequester}, Domain: Domain{DomainName: "domain.com"}, MergeExisting: true}
+	result, err := importer.Import(strings.NewReader("name,currency,address\nBücher,btc,1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2\n"))
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, ImportProgress{Total: 1, Saved: 1}, result.ImportProgress)
+	assert.Equal(t, 2, len(mockRequester.calls))
+	assert.Equal(t, "PUT", mockRequester.calls[1].method)
+	assert.Equal(t, "id0", result.WalletNames[0].Id)
+	assert.Equal(t, 2, len(result.WalletNames[0].Wallets))
+}
+
+func TestImportCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mockRequester := &SequenceNetkiRequester{}
+	importer := &Importer{Partner: &NetkiPartner{Requester: mockRequester}, Domain: Domain{DomainName: "domain.com"}}
+	result, err := importer.ImportContext(ctx, strings.NewReader(importCSV))
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, result.Saved)
+	assert.Equal(t, 0, len(mockRequester.calls))
+}
@@ -0,0 +1,203 @@
+package netki
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// ErrInvalidKey is matched by every KeyError
+var ErrInvalidKey = errors.New("netki: invalid key")
+
+// KeyError is returned when a key cannot be loaded or parsed
+type KeyError struct {
+	Source string
+	Reason string
+	Err    error
+}
+
+func (e *KeyError) Error() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("Unable to Load Key")
+	if e.Source != "" {
+		buffer.WriteString(" from ")
+		buffer.WriteString(e.Source)
+	}
+	buffer.WriteString(": ")
+	buffer.WriteString(e.Reason)
+	if e.Err != nil {
+		buffer.WriteString(": ")
+		buffer.WriteString(e.Err.Error())
+	}
+	return buffer.String()
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+func (e *KeyError) Is(target error) bool {
+	return target == ErrInvalidKey
+}
+
+// SupportedCurves are the curves accepted for user and key signing keys
+var SupportedCurves = []elliptic.Curve{elliptic.P256(), elliptic.P384(), elliptic.P521()}
+
+// ParseECPrivateKey parses an EC private key given as PEM ("EC PRIVATE KEY" or
+// "PRIVATE KEY"), SEC1 or PKCS#8 DER, or hex encoded DER.
+func ParseECPrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	return parseECPrivateKey(data, "")
+}
+
+// ParseECPublicKey parses an EC public key given as PEM ("PUBLIC KEY"), PKIX
+// DER, or hex encoded PKIX DER as sent in the X-Identity and X-Partner-Key headers.
+func ParseECPublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	return parseECPublicKey(data, "")
+}
+
+// LoadECPrivateKeyFile reads an EC private key from a file in any format ParseECPrivateKey accepts
+func LoadECPrivateKeyFile(path string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, &KeyError{Source: path, Reason: "unable to read file", Err: err}
+	}
+	return parseECPrivateKey(data, path)
+}
+
+// LoadECPublicKeyFile reads an EC public key from a file in any format ParseECPublicKey accepts
+func LoadECPublicKeyFile(path string) (*ecdsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, &KeyError{Source: path, Reason: "unable to read file", Err: err}
+	}
+	return parseECPublicKey(data, path)
+}
+
+// LoadECPrivateKeyEnv reads an EC private key, as PEM or hex, from an environment variable
+func LoadECPrivateKeyEnv(name string) (*ecdsa.PrivateKey, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return nil, &KeyError{Source: "$" + name, Reason: "environment variable is not set"}
+	}
+	return parseECPrivateKey([]byte(value), "$"+name)
+}
+
+// LoadECPublicKeyEnv reads an EC public key, as PEM or hex, from an environment variable
+func LoadECPublicKeyEnv(name string) (*ecdsa.PublicKey, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return nil, &KeyError{Source: "$" + name, Reason: "environment variable is not set"}
+	}
+	return parseECPublicKey([]byte(value), "$"+name)
+}
+
+// NewNetkiRemotePartnerFromFiles builds a key-signed partner from a user private
+// key file, a key signing public key file and the hex encoded key signature.
+func NewNetkiRemotePartnerFromFiles(apiUrl string, userKeyPath string, keySigningKeyPath string, keySignatureHex string) (*NetkiPartner, error) {
+	userKey, err := LoadECPrivateKeyFile(userKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	keySigningKey, err := LoadECPublicKeyFile(keySigningKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	keySignature, err := hex.DecodeString(keySignatureHex)
+	if err != nil {
+		return nil, &NetkiError{fmt.Sprintf("Invalid Key Signature: %s", err), make([]string, 0)}
+	}
+	return NewNetkiRemotePartner(apiUrl, userKey, keySigningKey, keySignature), nil
+}
+
+func parseECPrivateKey(data []byte, source string) (*ecdsa.PrivateKey, error) {
+	der, err := keyDER(data, source, "EC PRIVATE KEY", "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	key, sec1Err := x509.ParseECPrivateKey(der)
+	if sec1Err != nil {
+		parsed, pkcs8Err := x509.ParsePKCS8PrivateKey(der)
+		if pkcs8Err != nil {
+			return nil, &KeyError{Source: source, Reason: "not a SEC1 or PKCS#8 private key", Err: sec1Err}
+		}
+		var ok bool
+		if key, ok = parsed.(*ecdsa.PrivateKey); !ok {
+			return nil, &KeyError{Source: source, Reason: fmt.Sprintf("expected an EC private key, got %T", parsed)}
+		}
+	}
+
+	if err := checkCurve(key.Curve, source); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func parseECPublicKey(data []byte, source string) (*ecdsa.PublicKey, error) {
+	der, err := keyDER(data, source, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, &KeyError{Source: source, Reason: "not a PKIX public key", Err: err}
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, &KeyError{Source: source, Reason: fmt.Sprintf("expected an EC public key, got %T", parsed)}
+	}
+
+	if err := checkCurve(key.Curve, source); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// keyDER extracts DER bytes from PEM (of one of pemTypes), hex or raw DER input
+func keyDER(data []byte, source string, pemTypes ...string) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, &KeyError{Source: source, Reason: "no key data"}
+	}
+
+	if bytes.HasPrefix(trimmed, []byte("-----BEGIN")) {
+		rest := trimmed
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				return nil, &KeyError{Source: source, Reason: fmt.Sprintf("no %s PEM block found", pemTypes[0])}
+			}
+			for _, pemType := range pemTypes {
+				if block.Type == pemType {
+					if _, encrypted := block.Headers["DEK-Info"]; encrypted {
+						return nil, &KeyError{Source: source, Reason: "encrypted PEM keys are not supported"}
+					}
+					return block.Bytes, nil
+				}
+			}
+		}
+	}
+
+	if der, err := hex.DecodeString(string(trimmed)); err == nil {
+		return der, nil
+	}
+	return data, nil
+}
+
+func checkCurve(curve elliptic.Curve, source string) error {
+	for _, supported := range SupportedCurves {
+		if curve == supported {
+			return nil
+		}
+	}
+	return &KeyError{Source: source, Reason: fmt.Sprintf("unsupported curve %s", curve.Params().Name)}
+}
@@ -0,0 +1,151 @@
+package netki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"github.com/bmizerany/assert"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// SEC1 DER key taken from exampleKsk.go
+const testUserKeyHex = "307702010104208977d5312f492e7b04cbd8cf11334ed6ccb3ab1c530252a37dc6a1fad46f8b7ba00a06082a8648ce3d030107a1440342000472866325007154426e80e40039a6414a27db6c09b536f3bb79712020f505e1ff91daff344a73eae5b96535c6864277eeb389f1d1f632d0174b77b67b4627d6b2"
+
+func getTestUserKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ParseECPrivateKey([]byte(testUserKeyHex))
+	assert.Equal(t, nil, err)
+	return key
+}
+
+func TestParseECPrivateKeyFormats(t *testing.T) {
+	key := getTestUserKey(t)
+	assert.Equal(t, elliptic.P256(), key.Curve)
+
+	sec1, _ := x509.MarshalECPrivateKey(key)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+	inputs := map[string][]byte{
+		"sec1 der":   sec1,
+		"pkcs8 der":  pkcs8,
+		"pkcs8 hex":  []byte(hex.EncodeToString(pkcs8)),
+		"sec1 pem":   pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}),
+		"pkcs8 pem":  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		"params pem": append(pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte{6, 8, 42, 134, 72, 206, 61, 3, 1, 7}}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})...),
+	}
+
+	for name, input := range inputs {
+		parsed, err := ParseECPrivateKey(input)
+		assert.Equal(t, nil, err, name)
+		assert.Equal(t, key.D, parsed.D, name)
+	}
+}
+
+func TestParseECPublicKeyFormats(t *testing.T) {
+	key := getTestUserKey(t)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	inputs := map[string][]byte{
+		"der":        der,
+		"identity":   []byte((&NetkiPartner{UserKey: key}).GetUserPublicKey()),
+		"pem":        pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+		"padded hex": []byte("  " + hex.EncodeToString(der) + "\n"),
+	}
+
+	for name, input := range inputs {
+		parsed, err := ParseECPublicKey(input)
+		assert.Equal(t, nil, err, name)
+		assert.Equal(t, key.PublicKey.X, parsed.X, name)
+	}
+}
+
+func TestParseECPrivateKeyErrors(t *testing.T) {
+	_, err := ParseECPrivateKey([]byte(""))
+	assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+	assert.Equal(t, "Unable to Load Key: no key data", err.Error())
+
+	_, err = ParseECPrivateKey([]byte("not a key"))
+	assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+
+	_, err = ParseECPrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{1}}))
+	assert.Equal(t, "Unable to Load Key: no EC PRIVATE KEY PEM block found", err.Error())
+
+	_, err = ParseECPrivateKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Headers: map[string]string{"Proc-Type": "4,ENCRYPTED", "DEK-Info": "AES-128-CBC,00"}, Bytes: []byte{1}}))
+	assert.Equal(t, "Unable to Load Key: encrypted PEM keys are not supported", err.Error())
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	rsaDER, _ := x509.MarshalPKCS8PrivateKey(rsaKey)
+	_, err = ParseECPrivateKey(rsaDER)
+	assert.Equal(t, "Unable to Load Key: expected an EC private key, got *rsa.PrivateKey", err.Error())
+
+	p224Key, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	p224DER, _ := x509.MarshalECPrivateKey(p224Key)
+	_, err = ParseECPrivateKey(p224DER)
+	assert.Equal(t, "Unable to Load Key: unsupported curve P-224", err.Error())
+}
+
+func TestParseECPublicKeyErrors(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	rsaDER, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	_, err := ParseECPublicKey(rsaDER)
+	assert.Equal(t, "Unable to Load Key: expected an EC public key, got *rsa.PublicKey", err.Error())
+
+	_, err = ParseECPublicKey([]byte("abcd"))
+	assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+}
+
+func TestLoadECKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	key := getTestUserKey(t)
+	sec1, _ := x509.MarshalECPrivateKey(key)
+	pub, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	privPath := filepath.Join(dir, "user.pem")
+	pubPath := filepath.Join(dir, "ksk.pub")
+	ioutil.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}), 0600)
+	ioutil.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0644)
+
+	privKey, err := LoadECPrivateKeyFile(privPath)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, key.D, privKey.D)
+
+	pubKey, err := LoadECPublicKeyFile(pubPath)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, key.PublicKey.Y, pubKey.Y)
+
+	_, err = LoadECPrivateKeyFile(filepath.Join(dir, "missing.pem"))
+	assert.Equal(t, true, errors.Is(err, ErrInvalidKey))
+
+	_, err = LoadECPrivateKeyFile(pubPath)
+	assert.Equal(t, "Unable to Load Key from "+pubPath+": no EC PRIVATE KEY PEM block found", err.Error())
+
+	partner, err := NewNetkiRemotePartnerFromFiles("http://localhost:5000", privPath, pubPath, "abcd")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, key.D, partner.UserKey.D)
+	assert.Equal(t, []byte{0xab, 0xcd}, partner.KeySignature)
+
+	_, err = NewNetkiRemotePartnerFromFiles("http://localhost:5000", privPath, pubPath, "xyz")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestLoadECKeyEnv(t *testing.T) {
+	key := getTestUserKey(t)
+	t.Setenv("NETKI_TEST_USER_KEY", testUserKeyHex)
+	t.Setenv("NETKI_TEST_KSK", (&NetkiPartner{UserKey: key}).GetUserPublicKey())
+
+	privKey, err := LoadECPrivateKeyEnv("NETKI_TEST_USER_KEY")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, key.D, privKey.D)
+
+	pubKey, err := LoadECPublicKeyEnv("NETKI_TEST_KSK")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, key.PublicKey.X, pubKey.X)
+
+	_, err = LoadECPrivateKeyEnv("NETKI_TEST_UNSET")
+	assert.Equal(t, "Unable to Load Key from $NETKI_TEST_UNSET: environment variable is not set", err.Error())
+}
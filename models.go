@@ -0,0 +1,312 @@
+package netki
+
+import (
+	"encoding/json"
+	"github.com/bitly/go-simplejson"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Wire formats of the partner API payloads. Fields without omitempty are
+// required in responses when StrictDecoding is enabled on the NetkiPartner.
+
+// ResponseStatus holds the fields common to every API response
+type ResponseStatus struct {
+	Success  bool             `json:"success,omitempty"`
+	Message  string           `json:"message,omitempty"`
+	Failures []FailurePayload `json:"failures,omitempty"`
+}
+
+// responseStatus is ResponseStatus as read before the response is decoded,
+// telling an absent failures array apart from an empty one
+type responseStatus struct {
+	Success  bool              `json:"success"`
+	Message  string            `json:"message"`
+	Failures *[]FailurePayload `json:"failures"`
+}
+
+type FailurePayload struct {
+	Field   string `json:"field,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+type WalletPayload struct {
+	Currency      string `json:"currency"`
+	WalletAddress string `json:"wallet_address"`
+}
+
+type WalletNamePayload struct {
+	DomainName string          `json:"domain_name"`
+	ExternalId string          `json:"external_id"`
+	Id         string          `json:"id,omitempty"`
+	Name       string          `json:"name"`
+	Wallets    []WalletPayload `json:"wallets"`
+}
+
+// WalletNameRefPayload identifies a wallet name for deletion
+type WalletNameRefPayload struct {
+	DomainName string `json:"domain_name"`
+	Id         string `json:"id"`
+}
+
+// WalletNamesRequest is the body for creating and updating wallet names
+type WalletNamesRequest struct {
+	WalletNames []WalletNamePayload `json:"wallet_names"`
+}
+
+// WalletNamesDeleteRequest is the body for deleting wallet names
+type WalletNamesDeleteRequest struct {
+	WalletNames []WalletNameRefPayload `json:"wallet_names"`
+}
+
+// SavedWalletNamePayload is a wallet name as returned after it was created or
+// updated; only the id is guaranteed to be present
+type SavedWalletNamePayload struct {
+	DomainName string          `json:"domain_name,omitempty"`
+	ExternalId string          `json:"external_id,omitempty"`
+	Id         string          `json:"id"`
+	Name       string          `json:"name,omitempty"`
+	Wallets    []WalletPayload `json:"wallets,omitempty"`
+}
+
+// WalletNamesSaveResponse is returned when wallet names are created or updated
+type WalletNamesSaveResponse struct {
+	ResponseStatus
+	WalletNames []SavedWalletNamePayload `json:"wallet_names"`
+}
+
+// WalletNamesResponse is returned when listing wallet names
+type WalletNamesResponse struct {
+	ResponseStatus
+	WalletNameCount int                 `json:"wallet_name_count"`
+	WalletNames     []WalletNamePayload `json:"wallet_names,omitempty"`
+}
+
+type PartnerPayload struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type PartnerResponse struct {
+	ResponseStatus
+	Partner PartnerPayload `json:"partner"`
+}
+
+type PartnersResponse struct {
+	ResponseStatus
+	Partners []PartnerPayload `json:"partners"`
+}
+
+// DomainRequest is the body for creating a domain
+type DomainRequest struct {
+	PartnerId string `json:"partner_id,omitempty"`
+}
+
+// DomainResponse is returned when creating a domain or fetching its status
+type DomainResponse struct {
+	ResponseStatus
+	DomainName        string   `json:"domain_name,omitempty"`
+	Status            string   `json:"status"`
+	Nameservers       []string `json:"nameservers,omitempty"`
+	DelegationStatus  bool     `json:"delegation_status,omitempty"`
+	DelegationMessage string   `json:"delegation_message,omitempty"`
+	WalletNameCount   int      `json:"wallet_name_count,omitempty"`
+}
+
+type DomainPayload struct {
+	DomainName string `json:"domain_name"`
+}
+
+type DomainsResponse struct {
+	ResponseStatus
+	Domains []DomainPayload `json:"domains"`
+}
+
+type DnssecResponse struct {
+	ResponseStatus
+	NextRollDate        string   `json:"nextroll_date"`
+	DsRecords           []string `json:"ds_records"`
+	PublicKeySigningKey string   `json:"public_key_signing_key"`
+}
+
+type CurrencyPayload struct {
+	Code string `json:"code"`
+	Name string `json:"name,omitempty"`
+}
+
+// CurrenciesResponse is returned when listing the currencies the API supports
+type CurrenciesResponse struct {
+	ResponseStatus
+	Currencies []CurrencyPayload `json:"currencies"`
+}
+
+// LookupResponse is returned by the public wallet lookup API
+type LookupResponse struct {
+	ResponseStatus
+	WalletName    string `json:"wallet_name,omitempty"`
+	Currency      string `json:"currency,omitempty"`
+	WalletAddress string `json:"wallet_address"`
+}
+
+const nextRollDateFormat = "2006-01-02T15:04:05.000Z"
+
+// Conversions between the client types and their payloads
+func (w WalletName) payload() WalletNamePayload {
+	wallets := make([]WalletPayload, 0)
+	for _, wallet := range w.Wallets {
+		wallets = append(wallets, WalletPayload{Currency: NormalizeCurrency(wallet.Currency), WalletAddress: wallet.WalletAddress})
+	}
+	return WalletNamePayload{DomainName: w.DomainName, ExternalId: w.ExternalId, Id: w.Id, Name: w.Name, Wallets: wallets}
+}
+
+func (p WalletNamePayload) walletName() WalletName {
+	wallets := make([]Wallet, 0)
+	for _, wallet := range p.Wallets {
+		wallets = append(wallets, Wallet{wallet.Currency, wallet.WalletAddress})
+	}
+	return WalletName{Id: p.Id, DomainName: p.DomainName, Name: p.Name, Wallets: wallets, ExternalId: p.ExternalId}
+}
+
+func (p CurrencyPayload) currency() Currency {
+	c, ok := LookupCurrency(p.Code)
+	if !ok {
+		c = Currency{Code: strings.ToLower(p.Code)}
+	}
+	if p.Name != "" {
+		c.Name = p.Name
+	}
+	return c
+}
+
+func (p PartnerPayload) partner() Partner {
+	return Partner{p.Id, p.Name}
+}
+
+// decodeResponse decodes the simplejson response of a Requester other than
+// NetkiRequester into v, as decodeJSON does
+func decodeResponse(resp *simplejson.Json, v interface{}, strict bool) error {
+	if resp == nil {
+		resp = &simplejson.Json{}
+	}
+	raw, err := resp.MarshalJSON()
+	if err != nil {
+		return &SchemaError{Payload: payloadName(v), Err: err}
+	}
+	return decodeJSON(raw, v, strict)
+}
+
+// decodeJSON decodes an API response body into v. Type mismatches are always
+// reported; unknown and missing fields only when strict is set.
+func decodeJSON(raw []byte, v interface{}, strict bool) error {
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &SchemaError{Payload: payloadName(v), Err: err}
+	}
+	if !strict {
+		return nil
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return &SchemaError{Payload: payloadName(v), Err: err}
+	}
+	schemaErr := &SchemaError{Payload: payloadName(v)}
+	schemaDiff(generic, reflect.TypeOf(v), "", schemaErr)
+	sort.Strings(schemaErr.Unknown)
+	sort.Strings(schemaErr.Missing)
+	if len(schemaErr.Unknown) > 0 || len(schemaErr.Missing) > 0 {
+		return schemaErr
+	}
+	return nil
+}
+
+func payloadName(v interface{}) string {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return ""
+	}
+	return t.Name()
+}
+
+// schemaDiff walks value alongside t, recording unknown and missing fields on schemaErr
+func schemaDiff(value interface{}, t reflect.Type, path string, schemaErr *SchemaError) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return
+		}
+		obj, _ := value.(map[string]interface{})
+		fields := jsonFields(t)
+
+		for name, field := range fields {
+			fieldValue, ok := obj[name]
+			if !ok {
+				if !field.omitempty {
+					schemaErr.Missing = append(schemaErr.Missing, path+name)
+				}
+				continue
+			}
+			schemaDiff(fieldValue, field.typ, path+name+".", schemaErr)
+		}
+
+		for key := range obj {
+			if _, ok := fields[key]; !ok {
+				schemaErr.Unknown = append(schemaErr.Unknown, path+key)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		arr, _ := value.([]interface{})
+		for i, item := range arr {
+			schemaDiff(item, t.Elem(), strings.TrimSuffix(path, ".")+"["+strconv.Itoa(i)+"].", schemaErr)
+		}
+	}
+}
+
+type jsonField struct {
+	typ       reflect.Type
+	omitempty bool
+}
+
+// jsonFields returns the JSON fields of a struct type, flattening embedded structs
+func jsonFields(t reflect.Type) map[string]jsonField {
+	fields := make(map[string]jsonField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			for name, field := range jsonFields(f.Type) {
+				fields[name] = field
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if name == "" {
+			name = f.Name
+		}
+		omitempty := false
+		for _, opt := range parts[1:] {
+			if opt == "omitempty" {
+				omitempty = true
+			}
+		}
+		fields[name] = jsonField{f.Type, omitempty}
+	}
+	return fields
+}
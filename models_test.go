@@ -0,0 +1,113 @@
+package netki
+
+import (
+	"errors"
+	"github.com/bmizerany/assert"
+	"testing"
+)
+
+func TestWalletNamePayloadRoundTrip(t *testing.T) {
+	wn := getWalletName()
+	wn.Id = "id1"
+
+	assert.Equal(t, wn, wn.payload().walletName())
+}
+
+func TestGetWalletNamesTypeMismatch(t *testing.T) {
+	mockRequester := getMockRequester(`{"wallet_name_count":"1","wallet_names":[]}`, nil)
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	wns, err := mockPartner.GetWalletNames(Domain{}, "")
+
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, errors.Is(err, ErrSchema))
+	assert.Equal(t, 0, len(wns))
+}
+
+func TestGetWalletNamesStrict(t *testing.T) {
+	mockRequester := getMockRequester(`{"success":true,"wallet_name_count":1,"wallet_names":[{"id":"id1","domain_name":"domain1.com","name":"name1","external_id":"ext1","wallets":[{"currency":"btc","wallet_address":"1btcaddress"}]}]}`, nil)
+	mockPartner := &NetkiPartner{Requester: mockRequester, StrictDecoding: true}
+
+	wns, err := mockPartner.GetWalletNames(Domain{}, "")
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(wns))
+	assert.Equal(t, "1btcaddress", wns[0].GetAddress("btc"))
+}
+
+func TestNetkiRequesterDecodesBody(t *testing.T) {
+	server, client := setupHttp(200, "application/json", `{"success":true,"wallet_name_count":1,"wallet_names":[{"id":"id1","domain_name":"domain1.com","name":"name1","external_id":"ext1","wallets":[{"currency":"btc","wallet_address":"1btcaddress"}]}]}`)
+	defer server.Close()
+	partner := &NetkiPartner{Requester: &NetkiRequester{HTTPClient: client}, ApiUrl: "http://domain.com", StrictDecoding: true}
+
+	wns, err := partner.GetWalletNames(Domain{DomainName: "domain1.com"}, "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1btcaddress", wns[0].GetAddress("btc"))
+
+	// Fields of the wrong type fail the same way as with a custom Requester
+	server, client = setupHttp(200, "application/json", `{"success":true,"wallet_name_count":"1","wallet_names":[]}`)
+	defer server.Close()
+	partner.Requester = &NetkiRequester{HTTPClient: client}
+	_, err = partner.GetWalletNames(Domain{DomainName: "domain1.com"}, "")
+	assert.Equal(t, true, errors.Is(err, ErrSchema))
+}
+
+func TestGetWalletNamesStrictSchemaDrift(t *testing.T) {
+	mockRequester := getMockRequester(`{"wallet_name_count":1,"wallet_names":[{"id":"id1","domain":"domain1.com","name":"name1","external_id":"ext1","wallets":[{"currency":"btc","address":"1btcaddress"}]}]}`, nil)
+	mockPartner := &NetkiPartner{Requester: mockRequester, StrictDecoding: true}
+
+	_, err := mockPartner.GetWalletNames(Domain{}, "")
+
+	var schemaErr *SchemaError
+	assert.Equal(t, true, errors.As(err, &schemaErr))
+	assert.Equal(t, "WalletNamesResponse", schemaErr.Payload)
+	assert.Equal(t, []string{"wallet_names[0].domain", "wallet_names[0].wallets[0].address"}, schemaErr.Unknown)
+	assert.Equal(t, []string{"wallet_names[0].domain_name", "wallet_names[0].wallets[0].wallet_address"}, schemaErr.Missing)
+	assert.Equal(t, "Unexpected WalletNamesResponse Data [unknown fields: wallet_names[0].domain, wallet_names[0].wallets[0].address; missing fields: wallet_names[0].domain_name, wallet_names[0].wallets[0].wallet_address]", err.Error())
+}
+
+func TestGetWalletNamesLenientSchemaDrift(t *testing.T) {
+	mockRequester := getMockRequester(`{"wallet_name_count":1,"wallet_names":[{"id":"id1","extra":"field"}]}`, nil)
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	wns, err := mockPartner.GetWalletNames(Domain{}, "")
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(wns))
+	assert.Equal(t, "id1", wns[0].Id)
+}
+
+func TestGetDomainStatusStrictMissing(t *testing.T) {
+	mockRequester := getMockRequester(`{"delegation_status":true}`, nil)
+	mockPartner := &NetkiPartner{Requester: mockRequester, StrictDecoding: true}
+
+	_, err := mockPartner.GetDomainStatus(Domain{DomainName: "domain.com"})
+
+	var schemaErr *SchemaError
+	assert.Equal(t, true, errors.As(err, &schemaErr))
+	assert.Equal(t, []string{"status"}, schemaErr.Missing)
+	assert.Equal(t, 0, len(schemaErr.Unknown))
+}
+
+func TestGetDomainDnssecStrictBadDate(t *testing.T) {
+	mockRequester := getMockRequester(`{"nextroll_date":"tomorrow","ds_records":[],"public_key_signing_key":"publickey"}`, nil)
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	_, err := mockPartner.GetDomainDnssec(Domain{DomainName: "domain.com"})
+	assert.Equal(t, nil, err)
+
+	mockPartner.StrictDecoding = true
+	_, err = mockPartner.GetDomainDnssec(Domain{DomainName: "domain.com"})
+	assert.Equal(t, true, errors.Is(err, ErrSchema))
+}
+
+func TestSaveStrictExtraFields(t *testing.T) {
+	mockRequester := getMockRequester(`{"success":true,"wallet_names":[{"id":"my_id","name":"wallet","domain_name":"domain.com"}]}`, nil)
+	mockPartner := &NetkiPartner{Requester: mockRequester, StrictDecoding: true}
+
+	wn := getWalletName()
+	err := wn.Save(mockPartner)
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "my_id", wn.Id)
+}
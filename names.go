@@ -0,0 +1,161 @@
+package netki
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/net/idna"
+	"strings"
+	"unicode/utf8"
+)
+
+// DNS limits on hostnames (RFC 1035), in ASCII (punycode) form
+const (
+	MaxLabelLength    = 63
+	MaxHostnameLength = 253
+)
+
+// Reasons a name fails validation, usable with errors.Is against a NameError
+var (
+	ErrEmptyLabel       = errors.New("netki: empty label")
+	ErrLabelTooLong     = errors.New("netki: label too long")
+	ErrNameTooLong      = errors.New("netki: name too long")
+	ErrInvalidCharacter = errors.New("netki: invalid character")
+	ErrInvalidHyphen    = errors.New("netki: invalid hyphen")
+	ErrInvalidIDN       = errors.New("netki: invalid internationalized name")
+)
+
+// NameError is returned when a Wallet Name or domain name breaks DNS rules.
+// Err is one of the reason errors above.
+type NameError struct {
+	// Field is what was validated, "Wallet Name" or "Domain Name"
+	Field  string
+	Name   string
+	Label  string
+	Reason string
+	Err    error
+}
+
+func (e *NameError) Error() string {
+	return fmt.Sprintf("Invalid %s %q: %s", e.Field, e.Name, e.Reason)
+}
+
+func (e *NameError) Unwrap() error {
+	return e.Err
+}
+
+func (e *NameError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// ToASCIIName validates a hostname and returns its lower case ASCII form,
+// converting internationalized labels to punycode
+func ToASCIIName(name string) (string, error) {
+	return asciiName("Name", name)
+}
+
+// ToUnicodeName returns the Unicode form of a hostname, decoding punycode labels
+func ToUnicodeName(name string) (string, error) {
+	ascii, err := asciiName("Name", name)
+	if err != nil {
+		return "", err
+	}
+	unicode, err := idna.Lookup.ToUnicode(ascii)
+	if err != nil {
+		return "", &NameError{Field: "Name", Name: name, Reason: err.Error(), Err: ErrInvalidIDN}
+	}
+	return unicode, nil
+}
+
+// ValidateDomainName checks a domain name against DNS rules and returns its ASCII form
+func ValidateDomainName(domainName string) (string, error) {
+	return asciiName("Domain Name", strings.TrimSuffix(domainName, "."))
+}
+
+// ValidateName checks the Wallet Name's name and domain against DNS rules,
+// returning both in ASCII form
+func (w WalletName) ValidateName() (name string, domainName string, err error) {
+	if domainName, err = ValidateDomainName(w.DomainName); err != nil {
+		return "", "", err
+	}
+	if name, err = asciiName("Wallet Name", w.Name); err != nil {
+		return "", "", err
+	}
+	if len(name)+1+len(domainName) > MaxHostnameLength {
+		return "", "", &NameError{Field: "Wallet Name", Name: w.Name, Reason: fmt.Sprintf("%s.%s exceeds %d characters", name, domainName, MaxHostnameLength), Err: ErrNameTooLong}
+	}
+	return name, domainName, nil
+}
+
+// validPayload is payload with the name and domain validated and in ASCII form
+func (w WalletName) validPayload() (WalletNamePayload, error) {
+	name, domainName, err := w.ValidateName()
+	if err != nil {
+		return WalletNamePayload{}, err
+	}
+	payload := w.payload()
+	payload.Name = name
+	payload.DomainName = domainName
+	return payload, nil
+}
+
+func asciiName(field string, name string) (string, error) {
+	if name == "" {
+		return "", &NameError{Field: field, Name: name, Reason: "name is empty", Err: ErrEmptyLabel}
+	}
+
+	ascii := strings.ToLower(name)
+	if !isASCII(name) {
+		var err error
+		if ascii, err = idna.Lookup.ToASCII(name); err != nil {
+			return "", &NameError{Field: field, Name: name, Reason: err.Error(), Err: ErrInvalidIDN}
+		}
+	}
+
+	for _, label := range strings.Split(ascii, ".") {
+		if err := checkLabel(label); err != nil {
+			err.Field, err.Name = field, name
+			return "", err
+		}
+	}
+	if len(ascii) > MaxHostnameLength {
+		return "", &NameError{Field: field, Name: name, Reason: fmt.Sprintf("name exceeds %d characters", MaxHostnameLength), Err: ErrNameTooLong}
+	}
+	return ascii, nil
+}
+
+// checkLabel applies the letters, digits and hyphen rule (RFC 952, RFC 1123)
+// to a lower case ASCII label
+func checkLabel(label string) *NameError {
+	if label == "" {
+		return &NameError{Reason: "empty label", Err: ErrEmptyLabel}
+	}
+	if len(label) > MaxLabelLength {
+		return &NameError{Label: label, Reason: fmt.Sprintf("label %q exceeds %d characters", label, MaxLabelLength), Err: ErrLabelTooLong}
+	}
+	for _, c := range label {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return &NameError{Label: label, Reason: fmt.Sprintf("invalid character %q in label %q", c, label), Err: ErrInvalidCharacter}
+		}
+	}
+	if label[0] == '-' || label[len(label)-1] == '-' {
+		return &NameError{Label: label, Reason: fmt.Sprintf("label %q starts or ends with a hyphen", label), Err: ErrInvalidHyphen}
+	}
+	if len(label) >= 4 && label[2:4] == "--" && !strings.HasPrefix(label, "xn--") {
+		return &NameError{Label: label, Reason: fmt.Sprintf("label %q has hyphens in the third and fourth positions", label), Err: ErrInvalidHyphen}
+	}
+	if strings.HasPrefix(label, "xn--") {
+		if _, err := idna.Lookup.ToUnicode(label); err != nil {
+			return &NameError{Label: label, Reason: err.Error(), Err: ErrInvalidIDN}
+		}
+	}
+	return nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
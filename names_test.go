@@ -0,0 +1,124 @@
+package netki
+
+import (
+	"errors"
+	"github.com/bmizerany/assert"
+	"strings"
+	"testing"
+)
+
+func TestToASCIIName(t *testing.T) {
+	valid := map[string]string{
+		"wallet.domain.com":     "wallet.domain.com",
+		"Wallet.Domain.COM":     "wallet.domain.com",
+		"bücher.example":        "xn--bcher-kva.example",
+		"xn--bcher-kva.example": "xn--bcher-kva.example",
+		"a-b.c0":                "a-b.c0",
+		strings.Repeat("a", 63): strings.Repeat("a", 63),
+	}
+	for name, ascii := range valid {
+		result, err := ToASCIIName(name)
+		assert.Equal(t, nil, err, name)
+		assert.Equal(t, ascii, result)
+	}
+
+	unicode, err := ToUnicodeName("xn--bcher-kva.example")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "bücher.example", unicode)
+}
+
+func TestToASCIINameErrors(t *testing.T) {
+	invalid := []struct {
+		name   string
+		err    error
+		reason string
+	}{
+		{"", ErrEmptyLabel, "name is empty"},
+		{"wallet..com", ErrEmptyLabel, "empty label"},
+		{strings.Repeat("a", 64) + ".com", ErrLabelTooLong, `label "` + strings.Repeat("a", 64) + `" exceeds 63 characters`},
+		{strings.Repeat(strings.Repeat("a", 63)+".", 4) + "com", ErrNameTooLong, "name exceeds 253 characters"},
+		{"wallet_name.com", ErrInvalidCharacter, `invalid character '_' in label "wallet_name"`},
+		{"my wallet.com", ErrInvalidCharacter, `invalid character ' ' in label "my wallet"`},
+		{"-wallet.com", ErrInvalidHyphen, `label "-wallet" starts or ends with a hyphen`},
+		{"ab--cd.com", ErrInvalidHyphen, `label "ab--cd" has hyphens in the third and fourth positions`},
+		{"xn--a.com", ErrInvalidIDN, ""},
+		{"wal\u200dlet.com", ErrInvalidIDN, ""},
+	}
+	for _, v := range invalid {
+		_, err := ToASCIIName(v.name)
+		assert.Equal(t, true, errors.Is(err, v.err), v.name)
+		assert.Equal(t, true, errors.Is(err, ErrValidation))
+		nameErr := err.(*NameError)
+		if v.reason != "" {
+			assert.Equal(t, v.reason, nameErr.Reason)
+		}
+	}
+
+	_, err := ToASCIIName("wallet_name.com")
+	assert.Equal(t, `Invalid Name "wallet_name.com": invalid character '_' in label "wallet_name"`, err.Error())
+}
+
+func TestWalletNameValidateName(t *testing.T) {
+	wn := getWalletName()
+	wn.Name = "Zürich"
+	wn.DomainName = "Domain.com."
+	name, domainName, err := wn.ValidateName()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "xn--zrich-kva", name)
+	assert.Equal(t, "domain.com", domainName)
+
+	wn.Name = strings.Repeat(strings.Repeat("a", 63)+".", 3) + strings.Repeat("a", 60)
+	_, _, err = wn.ValidateName()
+	assert.Equal(t, true, errors.Is(err, ErrNameTooLong))
+
+	wn.Name = "wallet"
+	wn.DomainName = "bad_domain.com"
+	_, _, err = wn.ValidateName()
+	assert.Equal(t, `Invalid Domain Name "bad_domain.com": invalid character '_' in label "bad_domain"`, err.Error())
+}
+
+func TestWalletNameSaveValidatesName(t *testing.T) {
+	mockRequester := getMockRequester(`{"wallet_names":[{"id":"newId"}]}`, nil)
+	partner := &NetkiPartner{Requester: mockRequester}
+
+	wn := getWalletName()
+	wn.Name = "bad name"
+	err := wn.Save(partner)
+	assert.Equal(t, true, errors.Is(err, ErrInvalidCharacter))
+	assert.Equal(t, "", mockRequester.calledUri)
+
+	wn.Name = "Bücher"
+	assert.Equal(t, nil, wn.Save(partner))
+	assert.Equal(t, `{"wallet_names":[{"domain_name":"domain.com","external_id":"ext_id","name":"xn--bcher-kva","wallets":[{"currency":"btc","wallet_address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}]}]}`, mockRequester.calledBodyData)
+}
+
+func TestSaveWalletNamesValidatesNames(t *testing.T) {
+	mockRequester := &SequenceNetkiRequester{responses: []mockResponse{
+		{returnData: `{"wallet_names":[{"id":"id0"}]}`},
+	}}
+	partner := &NetkiPartner{Requester: mockRequester}
+
+	walletNames := getBatchWalletNames(2)
+	walletNames[0].Name = "-wallet0"
+	err := partner.SaveWalletNames(walletNames)
+
+	batchErr := err.(*BatchError)
+	assert.Equal(t, 1, len(batchErr.Failures))
+	assert.Equal(t, 0, batchErr.Failures[0].Index)
+	assert.Equal(t, true, errors.Is(batchErr.Failures[0].Err, ErrInvalidHyphen))
+	assert.Equal(t, 1, len(mockRequester.calls))
+	assert.Equal(t, "id0", walletNames[1].Id)
+}
+
+func TestCreateNewDomainValidatesName(t *testing.T) {
+	mockRequester := getMockRequester(`{"success":true,"domain_name":"xn--bcher-kva.example","status":"completed"}`, nil)
+	partner := &NetkiPartner{Requester: mockRequester}
+
+	_, err := partner.CreateNewDomain("bad domain.com", Partner{})
+	assert.Equal(t, true, errors.Is(err, ErrInvalidCharacter))
+	assert.Equal(t, "", mockRequester.calledUri)
+
+	_, err = partner.CreateNewDomain("Bücher.example", Partner{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "/v1/partner/domain/xn--bcher-kva.example", mockRequester.calledUri)
+}
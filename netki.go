@@ -2,14 +2,17 @@ package netki
 
 import (
 	"bytes"
+	"context"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
-	"encoding/asn1"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/bitly/go-simplejson"
+	"io"
 	"io/ioutil"
 	"math/big"
 	"net/http"
@@ -36,32 +39,26 @@ func (e NetkiError) Error() string {
 
 // WalletNameLookup resolves an address from a netki address and currency.
 func WalletNameLookup(uri, currency string) (string, error) {
-	apimethod := "https://pubapi.netki.com/api/wallet_lookup"
-	resp, err := http.Get(fmt.Sprintf("%s/%s/%s", apimethod, uri, currency))
-	if err != nil {
-		return "", err
-	}
-
-	j, err := simplejson.NewFromReader(resp.Body)
-	if err != nil {
-		return "", err
-	} else if resp.StatusCode != 200 {
-		return "", fmt.Errorf("Could not resolve netki address")
-	}
-
-	if msg, err := j.Get("message").String(); msg != "" {
-		return "", fmt.Errorf(msg)
-	} else if err != nil {
-		return "", err
-	}
+	return WalletNameLookupContext(context.Background(), uri, currency)
+}
 
-	return j.Get("wallet_address").String()
+// WalletNameLookupContext is like WalletNameLookup but carries ctx to the HTTP request.
+func WalletNameLookupContext(ctx context.Context, uri, currency string) (string, error) {
+	return DefaultResolver.LookupContext(ctx, uri, currency)
 }
 
 type Partner struct {
 	id, partnerName string
 }
 
+func (p Partner) Id() string {
+	return p.id
+}
+
+func (p Partner) Name() string {
+	return p.partnerName
+}
+
 type Domain struct {
 	DomainName        string
 	Status            string
@@ -90,8 +87,23 @@ type NetkiRequest interface {
 	ProcessRequest(partner *NetkiPartner, uri string, method string, bodyData string) (*simplejson.Json, error)
 }
 
+// NetkiContextRequest is a NetkiRequest that can also carry a context.Context
+// through to the underlying HTTP request for cancellation and deadlines.
+type NetkiContextRequest interface {
+	NetkiRequest
+	ProcessRequestContext(ctx context.Context, partner *NetkiPartner, uri string, method string, bodyData string) (*simplejson.Json, error)
+}
+
+// NetkiStreamRequest is a NetkiContextRequest that can also return the raw
+// response body, so large responses can be decoded incrementally.
+type NetkiStreamRequest interface {
+	NetkiContextRequest
+	StreamRequestContext(ctx context.Context, partner *NetkiPartner, uri string, method string, bodyData string) (io.ReadCloser, error)
+}
+
 type NetkiRequester struct {
-	HTTPClient *http.Client
+	HTTPClient  *http.Client
+	RetryPolicy *RetryPolicy
 }
 
 type NetkiPartner struct {
@@ -102,6 +114,28 @@ type NetkiPartner struct {
 	UserKey       *ecdsa.PrivateKey
 	KeySigningKey *ecdsa.PublicKey
 	KeySignature  []byte
+
+	// UserSigner signs requests in place of UserKey, so the user key does not
+	// have to be held in process memory
+	UserSigner crypto.Signer
+
+	// StrictDecoding rejects responses with unknown or missing fields
+	StrictDecoding bool
+
+	// MaxBatchSize caps the wallet names sent per request by SaveWalletNames
+	// and DeleteWalletNames, DefaultMaxBatchSize when zero
+	MaxBatchSize int
+
+	// SigningScheme selects how key-signed requests are signed,
+	// SigningSchemeLegacy when zero
+	SigningScheme SigningScheme
+
+	// Network selects the address formats wallet names are validated against
+	// before they are saved, Mainnet when zero
+	Network Network
+
+	// SkipAddressValidation sends wallet addresses to the API unchecked
+	SkipAddressValidation bool
 }
 
 type EcdsaSig struct {
@@ -119,25 +153,88 @@ func urlEncode(text string) string {
 
 // Sign Request
 func (n NetkiRequester) SignRequest(uri string, bodyData string, key *ecdsa.PrivateKey) (string, error) {
-	h := sha256.New()
-	r := big.NewInt(0)
-	s := big.NewInt(0)
+	return n.SignRequestWithSigner(uri, bodyData, key)
+}
+
+// SignRequestWithSigner signs the request with any crypto.Signer holding the
+// user key, e.g. a hardware token or signing agent. The signer must return
+// ASN.1 DER encoded ECDSA signatures, as *ecdsa.PrivateKey does.
+func (n NetkiRequester) SignRequestWithSigner(uri string, bodyData string, signer crypto.Signer) (string, error) {
+	return signData(uri+bodyData, signer)
+}
 
-	h.Write([]byte(uri + bodyData))
-	signDataHash := h.Sum(nil)
+func signData(data string, signer crypto.Signer) (string, error) {
+	signDataHash := sha256.Sum256([]byte(data))
 
-	r, s, err := ecdsa.Sign(rand.Reader, key, signDataHash)
+	sig, err := signer.Sign(rand.Reader, signDataHash[:], crypto.SHA256)
 	if err != nil {
-		return "", &NetkiError{"Unable to Sign Data", make([]string, 0)}
+		return "", fmt.Errorf("Unable to Sign Data: %w", err)
 	}
 
-	sequence := EcdsaSig{r, s}
-	encoding, _ := asn1.Marshal(sequence)
-	return hex.EncodeToString(encoding), nil
+	return hex.EncodeToString(sig), nil
 }
 
 // Generic Request Handling
 func (n NetkiRequester) ProcessRequest(partner *NetkiPartner, uri string, method string, bodyData string) (*simplejson.Json, error) {
+	return n.ProcessRequestContext(context.Background(), partner, uri, method, bodyData)
+}
+
+func (n NetkiRequester) ProcessRequestContext(ctx context.Context, partner *NetkiPartner, uri string, method string, bodyData string) (*simplejson.Json, error) {
+	body, err := n.requestBody(ctx, partner, uri, method, bodyData)
+	if err != nil || body == nil {
+		return &simplejson.Json{}, err
+	}
+
+	js, err := simplejson.NewJson(body)
+	if err != nil {
+		return &simplejson.Json{}, &NetkiError{fmt.Sprintf("Error Retrieving JSON Data: %s", err), make([]string, 0)}
+	}
+	return js, nil
+}
+
+// requestBody sends the request and returns the body of a successful
+// response, or nil for a DELETE answered with 204 No Content
+func (n NetkiRequester) requestBody(ctx context.Context, partner *NetkiPartner, uri string, method string, bodyData string) ([]byte, error) {
+	resp, requestUrl, err := n.send(ctx, partner, uri, method, bodyData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Close the body when we're done with the function
+	defer resp.Body.Close()
+
+	// DELETE with 204 Response, Don't Care About Response Data
+	if method == "DELETE" && resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	return readResponse(resp, method, requestUrl)
+}
+
+// StreamRequestContext sends the request like ProcessRequestContext but hands
+// back the unread response body of a successful request. Error responses are
+// read and returned as errors. The caller must close the body.
+func (n NetkiRequester) StreamRequestContext(ctx context.Context, partner *NetkiPartner, uri string, method string, bodyData string) (io.ReadCloser, error) {
+	resp, requestUrl, err := n.send(ctx, partner, uri, method, bodyData)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		_, err := readResponse(resp, method, requestUrl)
+		if err == nil {
+			err = &APIError{StatusCode: resp.StatusCode, Method: method, URI: requestUrl, Message: http.StatusText(resp.StatusCode), Failures: make([]Failure, 0)}
+		}
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// send performs the HTTP request, retrying according to the RetryPolicy, and
+// returns the response along with the full request URL
+func (n NetkiRequester) send(ctx context.Context, partner *NetkiPartner, uri string, method string, bodyData string) (*http.Response, string, error) {
 	var supported_methods = [...]string{"GET", "POST", "PUT", "DELETE"}
 	var isSupportedMethod = false
 
@@ -149,15 +246,7 @@ func (n NetkiRequester) ProcessRequest(partner *NetkiPartner, uri string, method
 	}
 
 	if !isSupportedMethod {
-		return &simplejson.Json{}, &NetkiError{fmt.Sprintf("Unsupported HTTP Method: %s", method), make([]string, 0)}
-	}
-
-	buf := new(bytes.Buffer)
-	if bodyData != "" {
-		_, err := buf.WriteString(bodyData)
-		if err != nil {
-			return &simplejson.Json{}, &NetkiError{"Unable to Write Request Data to Buffer", make([]string, 0)}
-		}
+		return nil, "", &NetkiError{fmt.Sprintf("Unsupported HTTP Method: %s", method), make([]string, 0)}
 	}
 
 	// Create Our Request
@@ -167,22 +256,7 @@ func (n NetkiRequester) ProcessRequest(partner *NetkiPartner, uri string, method
 		buffer.UnreadRune()
 	}
 	buffer.WriteString(uri)
-
-	req, err := http.NewRequest(method, buffer.String(), buf)
-	req.Header.Set("Content-Type", "application/json")
-	if partner.PartnerId == "" && partner.UserKey != nil {
-		sig, err := n.SignRequest(buffer.String(), bodyData, partner.UserKey)
-		if err != nil {
-			return &simplejson.Json{}, err
-		}
-		req.Header.Set("X-Identity", partner.GetUserPublicKey())
-		req.Header.Set("X-Signature", sig)
-		req.Header.Set("X-Partner-Key", partner.GetKeySigningKey())
-		req.Header.Set("X-Partner-KeySig", hex.EncodeToString(partner.KeySignature))
-	} else {
-		req.Header.Set("X-Partner-ID", partner.PartnerId)
-		req.Header.Set("Authorization", partner.ApiKey)
-	}
+	requestUrl := buffer.String()
 
 	// See if we have an injected HTTPClient
 	var client *http.Client
@@ -192,56 +266,157 @@ func (n NetkiRequester) ProcessRequest(partner *NetkiPartner, uri string, method
 		client = n.HTTPClient
 	}
 
-	// Send Our Request
-	resp, err := client.Do(req)
-	if err != nil {
-		return &simplejson.Json{}, &NetkiError{fmt.Sprintf("HTTP Request Failed: %s", err), make([]string, 0)}
+	// Only retry when the policy allows it for this method
+	maxAttempts := 1
+	if n.RetryPolicy != nil && n.RetryPolicy.allowsMethod(method) && n.RetryPolicy.MaxAttempts > 1 {
+		maxAttempts = n.RetryPolicy.MaxAttempts
 	}
 
-	// DELETE with 204 Response, Don't Care About Response Data
-	if method == "DELETE" && resp.StatusCode == http.StatusNoContent {
-		return &simplejson.Json{}, nil
-	}
+	// Send Our Request, rebuilding (and re-signing) it on every attempt
+	for attempt := 1; ; attempt++ {
+		req, err := n.newRequest(ctx, partner, requestUrl, method, bodyData)
+		if err != nil {
+			return nil, requestUrl, err
+		}
 
-	// Close the body when we're done with the function
-	defer resp.Body.Close()
+		resp, err := client.Do(req)
+		if ctx.Err() != nil {
+			// Surface cancellation and deadlines as-is so callers can check for them
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, requestUrl, ctx.Err()
+		}
+		if attempt >= maxAttempts || !n.RetryPolicy.shouldRetry(resp, err) {
+			if err != nil {
+				return nil, requestUrl, &TransportError{Method: method, URI: requestUrl, Err: err}
+			}
+			return resp, requestUrl, nil
+		}
+
+		delay := n.RetryPolicy.delay(attempt, resp)
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, requestUrl, err
+		}
+	}
+}
 
+// readResponse reads a buffered API response, turning unsuccessful ones into
+// errors, and returns the body of successful ones
+func readResponse(resp *http.Response, method string, requestUrl string) ([]byte, error) {
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return &simplejson.Json{}, &NetkiError{fmt.Sprintf("HTTP Body Read Failed: %s", err), make([]string, 0)}
+		return nil, &NetkiError{fmt.Sprintf("HTTP Body Read Failed: %s", err), make([]string, 0)}
 	}
 
-	// Get Our JSON Data
-	js, err := simplejson.NewJson(body)
-	if err != nil {
-		return &simplejson.Json{}, &NetkiError{fmt.Sprintf("Error Retrieving JSON Data: %s", err), make([]string, 0)}
+	// Get Our JSON Data. Fields of the wrong type are left unset, so a
+	// success that is not true is unsuccessful.
+	status := responseStatus{}
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&status); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			message := fmt.Sprintf("Error Retrieving JSON Data: %s", err)
+			if resp.StatusCode >= 400 {
+				return nil, &APIError{StatusCode: resp.StatusCode, Method: method, URI: requestUrl, Message: message, Failures: make([]Failure, 0)}
+			}
+			return nil, &NetkiError{message, make([]string, 0)}
+		}
 	}
 
 	// Return message if success is false
-	if !js.Get("success").MustBool(false) {
-		errMsg := new(bytes.Buffer)
-		errMsg.WriteString(js.Get("message").MustString())
-		resp, _ := js.Get("failures").Array()
-		if resp != nil {
-			errMsg.WriteString(" [FAILURES: ")
-			failures := make([]string, 0)
-			for i := 0; i < len(js.Get("failures").MustArray()); i++ {
-				failures = append(failures, js.Get("failures").GetIndex(i).Get("message").MustString())
+	if !status.Success {
+		return nil, newAPIError(resp.StatusCode, method, requestUrl, status)
+	}
+
+	return body, nil
+}
+
+// newRequest builds a single signed or API key authenticated HTTP request
+func (n NetkiRequester) newRequest(ctx context.Context, partner *NetkiPartner, requestUrl string, method string, bodyData string) (*http.Request, error) {
+	buf := new(bytes.Buffer)
+	if bodyData != "" {
+		_, err := buf.WriteString(bodyData)
+		if err != nil {
+			return nil, &NetkiError{"Unable to Write Request Data to Buffer", make([]string, 0)}
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl, buf)
+	if err != nil {
+		return nil, &NetkiError{fmt.Sprintf("Unable to Create HTTP Request: %s", err), make([]string, 0)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if signer := partner.userSigner(); partner.PartnerId == "" && signer != nil {
+		if partner.SigningScheme == SigningSchemeV2 {
+			if err := n.signRequestV2(req, requestUrl, bodyData, signer); err != nil {
+				return nil, err
+			}
+		} else {
+			sig, err := n.SignRequestWithSigner(requestUrl, bodyData, signer)
+			if err != nil {
+				return nil, err
 			}
-			errMsg.WriteString(strings.Join(failures, ", "))
-			errMsg.WriteString("]")
+			req.Header.Set("X-Signature", sig)
 		}
-		return &simplejson.Json{}, &NetkiError{errMsg.String(), make([]string, 0)}
+		req.Header.Set("X-Identity", partner.GetUserPublicKey())
+		req.Header.Set("X-Partner-Key", partner.GetKeySigningKey())
+		req.Header.Set("X-Partner-KeySig", hex.EncodeToString(partner.KeySignature))
+	} else {
+		req.Header.Set("X-Partner-ID", partner.PartnerId)
+		req.Header.Set("Authorization", partner.ApiKey)
 	}
+	return req, nil
+}
 
-	return js, nil
+// processRequest hands the request to the partner's Requester, passing ctx along
+// when the Requester implements NetkiContextRequest.
+func processRequest(ctx context.Context, partner *NetkiPartner, uri string, method string, bodyData string) (*simplejson.Json, error) {
+	if requester, ok := partner.Requester.(NetkiContextRequest); ok {
+		return requester.ProcessRequestContext(ctx, partner, uri, method, bodyData)
+	}
+	if err := ctx.Err(); err != nil {
+		return &simplejson.Json{}, err
+	}
+	return partner.Requester.ProcessRequest(partner, uri, method, bodyData)
+}
+
+// bodyRequester is implemented by NetkiRequester, whose responses can be
+// decoded straight from the response body
+type bodyRequester interface {
+	requestBody(ctx context.Context, partner *NetkiPartner, uri string, method string, bodyData string) ([]byte, error)
+}
 
+// requestInto sends a request through the partner's Requester and decodes the
+// response into v, unless v is nil. Other Requesters hand back simplejson,
+// which is decoded with decodeResponse.
+func requestInto(ctx context.Context, partner *NetkiPartner, uri string, method string, bodyData string, v interface{}) error {
+	if requester, ok := partner.Requester.(bodyRequester); ok {
+		body, err := requester.requestBody(ctx, partner, uri, method, bodyData)
+		if err != nil || v == nil {
+			return err
+		}
+		if body == nil {
+			body = []byte("null")
+		}
+		return decodeJSON(body, v, partner.StrictDecoding)
+	}
+
+	resp, err := processRequest(ctx, partner, uri, method, bodyData)
+	if err != nil || v == nil {
+		return err
+	}
+	return decodeResponse(resp, v, partner.StrictDecoding)
 }
 
-// Defined WalletName Methods
+// Defined WalletName Methods. Currency codes are compared after
+// NormalizeCurrency, so "BTC", "btc" and "bitcoin" are the same currency.
 func (w WalletName) GetAddress(currency string) string {
+	currency = NormalizeCurrency(currency)
 	for _, wallet := range w.Wallets {
-		if wallet.Currency == currency {
+		if NormalizeCurrency(wallet.Currency) == currency {
 			return wallet.WalletAddress
 		}
 	}
@@ -251,15 +426,16 @@ func (w WalletName) GetAddress(currency string) string {
 func (w WalletName) UsedCurrencies() []string {
 	currencies := make([]string, 0)
 	for _, wallet := range w.Wallets {
-		currencies = append(currencies, wallet.Currency)
+		currencies = append(currencies, NormalizeCurrency(wallet.Currency))
 	}
 	return currencies
 }
 
 func (w *WalletName) SetCurrencyAddress(currency string, address string) {
-
+	currency = NormalizeCurrency(currency)
 	for index, wallet := range w.Wallets {
-		if wallet.Currency == currency {
+		if NormalizeCurrency(wallet.Currency) == currency {
+			w.Wallets[index].Currency = currency
 			w.Wallets[index].WalletAddress = address
 			return
 		}
@@ -271,8 +447,9 @@ func (w *WalletName) SetCurrencyAddress(currency string, address string) {
 }
 
 func (w *WalletName) RemoveCurrency(currency string) {
+	currency = NormalizeCurrency(currency)
 	for index, wallet := range w.Wallets {
-		if wallet.Currency == currency {
+		if NormalizeCurrency(wallet.Currency) == currency {
 			w.Wallets = append(w.Wallets[:index], w.Wallets[index+1:]...)
 			return
 		}
@@ -280,67 +457,61 @@ func (w *WalletName) RemoveCurrency(currency string) {
 }
 
 func (w *WalletName) Save(partner *NetkiPartner) error {
-	// Set Default HTTP Method
-	httpMethod := "POST"
+	return w.SaveContext(context.Background(), partner)
+}
 
-	wallets := make([]simplejson.Json, 0)
-	for _, wallet := range w.Wallets {
-		_w := simplejson.New()
-		_w.Set("currency", wallet.Currency)
-		_w.Set("wallet_address", wallet.WalletAddress)
-		wallets = append(wallets, *_w)
+func (w *WalletName) SaveContext(ctx context.Context, partner *NetkiPartner) error {
+	payload, err := w.validPayload()
+	if err != nil {
+		return err
+	}
+	if !partner.SkipAddressValidation {
+		if err := w.Validate(partner.Network); err != nil {
+			return err
+		}
 	}
 
-	d := simplejson.New()
-	d.Set("domain_name", w.DomainName)
-	d.Set("name", w.Name)
-	d.Set("wallets", wallets)
-	d.Set("external_id", w.ExternalId)
+	// Set Default HTTP Method
+	httpMethod := "POST"
 	if w.Id != "" {
-		d.Set("id", w.Id)
 		httpMethod = "PUT"
 	}
 
-	wnArray := make([]simplejson.Json, 0)
-	wnArray = append(wnArray, *d)
-	req := simplejson.New()
-	req.Set("wallet_names", wnArray)
-
-	jsondata, err := req.MarshalJSON()
+	req := WalletNamesRequest{WalletNames: []WalletNamePayload{payload}}
+	jsondata, err := json.Marshal(req)
 	if err != nil {
 		return &NetkiError{fmt.Sprintf("Unable to Marshall JSON Data: %s", err), make([]string, 0)}
 	}
 
-	resp, err := partner.Requester.ProcessRequest(partner, "/v1/partner/walletname", httpMethod, string(jsondata[:len(jsondata)]))
-	if err != nil {
+	saved := WalletNamesSaveResponse{}
+	if err := requestInto(ctx, partner, "/v1/partner/walletname", httpMethod, string(jsondata), &saved); err != nil {
 		return err
 	}
-
-	w.Id = resp.Get("wallet_names").GetIndex(0).Get("id").MustString()
+	if len(saved.WalletNames) > 0 {
+		w.Id = saved.WalletNames[0].Id
+	} else {
+		w.Id = ""
+	}
 	return nil
 }
 
 func (w WalletName) Delete(partner *NetkiPartner) error {
+	return w.DeleteContext(context.Background(), partner)
+}
+
+func (w WalletName) DeleteContext(ctx context.Context, partner *NetkiPartner) error {
 
 	if w.Id == "" {
 		return &NetkiError{"WalletName has no ID! Cannot Delete!", make([]string, 0)}
 	}
 
-	d := simplejson.New()
-	d.Set("domain_name", w.DomainName)
-	d.Set("id", w.Id)
-
-	wnArray := make([]simplejson.Json, 0)
-	wnArray = append(wnArray, *d)
-	req := simplejson.New()
-	req.Set("wallet_names", wnArray)
-
-	jsondata, err := req.MarshalJSON()
+	req := WalletNamesDeleteRequest{WalletNames: []WalletNameRefPayload{{DomainName: w.DomainName, Id: w.Id}}}
+	jsondata, err := json.Marshal(req)
 	if err != nil {
 		return &NetkiError{fmt.Sprintf("Unable to Marshall JSON Data: %s", err), make([]string, 0)}
 	}
 
-	_, err = partner.Requester.ProcessRequest(partner, "/v1/partner/walletname", "DELETE", string(jsondata[:len(jsondata)]))
+	err = requestInto(ctx, partner, "/v1/partner/walletname", "DELETE", string(jsondata), nil)
 	if err != nil {
 		return err
 	}
@@ -350,7 +521,11 @@ func (w WalletName) Delete(partner *NetkiPartner) error {
 
 // Define NetkiPartner Utility methods
 func (n NetkiPartner) GetUserPublicKey() string {
-	derkey, err := x509.MarshalPKIXPublicKey(&n.UserKey.PublicKey)
+	signer := n.userSigner()
+	if signer == nil {
+		return ""
+	}
+	derkey, err := x509.MarshalPKIXPublicKey(signer.Public())
 	if err != nil {
 		return ""
 	}
@@ -365,6 +540,17 @@ func (n NetkiPartner) GetKeySigningKey() string {
 	return hex.EncodeToString(derkey)
 }
 
+// userSigner returns the UserSigner, falling back to UserKey
+func (n NetkiPartner) userSigner() crypto.Signer {
+	if n.UserSigner != nil {
+		return n.UserSigner
+	}
+	if n.UserKey != nil {
+		return n.UserKey
+	}
+	return nil
+}
+
 func (n NetkiPartner) SetUserKey(userKey *ecdsa.PrivateKey) {
 	n.UserKey = userKey
 }
@@ -379,41 +565,49 @@ func (n NetkiPartner) SetKeySignature(sig []byte) {
 
 // Define NetkiPartner methods
 func (n NetkiPartner) CreateNewPartner(partnerName string) (Partner, error) {
+	return n.CreateNewPartnerContext(context.Background(), partnerName)
+}
+
+func (n NetkiPartner) CreateNewPartnerContext(ctx context.Context, partnerName string) (Partner, error) {
 	uri := new(bytes.Buffer)
 	uri.WriteString("/v1/admin/partner/")
 	uri.WriteString(urlEncode(partnerName))
 
-	resp, err := n.Requester.ProcessRequest(&n, uri.String(), "POST", "")
-	if err != nil {
+	partnerResp := PartnerResponse{}
+	if err := requestInto(ctx, &n, uri.String(), "POST", "", &partnerResp); err != nil {
 		return Partner{}, err
 	}
 
-	return Partner{resp.Get("partner").Get("id").MustString(), resp.Get("partner").Get("name").MustString()}, nil
+	return partnerResp.Partner.partner(), nil
 }
 
 func (n NetkiPartner) GetPartners() ([]Partner, error) {
-	resp, err := n.Requester.ProcessRequest(&n, "/v1/admin/partner", "GET", "")
-	if err != nil {
+	return n.GetPartnersContext(context.Background())
+}
+
+func (n NetkiPartner) GetPartnersContext(ctx context.Context) ([]Partner, error) {
+	partnersResp := PartnersResponse{}
+	if err := requestInto(ctx, &n, "/v1/admin/partner", "GET", "", &partnersResp); err != nil {
 		return make([]Partner, 0), err
 	}
 
-	ps := resp.Get("partners").MustArray()
-
 	partners := make([]Partner, 0)
-	for i := 0; i < len(ps); i++ {
-		intPartner := resp.Get("partners").GetIndex(i)
-		newObj := Partner{intPartner.Get("id").MustString(), intPartner.Get("name").MustString()}
-		partners = append(partners, newObj)
+	for _, p := range partnersResp.Partners {
+		partners = append(partners, p.partner())
 	}
 	return partners, nil
 }
 
 func (n NetkiPartner) DeletePartner(partner Partner) error {
+	return n.DeletePartnerContext(context.Background(), partner)
+}
+
+func (n NetkiPartner) DeletePartnerContext(ctx context.Context, partner Partner) error {
 	uri := new(bytes.Buffer)
 	uri.WriteString("/v1/admin/partner/")
 	uri.WriteString(urlEncode(partner.partnerName))
 
-	_, err := n.Requester.ProcessRequest(&n, uri.String(), "DELETE", "")
+	err := requestInto(ctx, &n, uri.String(), "DELETE", "", nil)
 	if err != nil {
 		return err
 	}
@@ -423,80 +617,101 @@ func (n NetkiPartner) DeletePartner(partner Partner) error {
 
 // Domain Handlers
 func (n NetkiPartner) CreateNewDomain(domainName string, partner Partner) (Domain, error) {
+	return n.CreateNewDomainContext(context.Background(), domainName, partner)
+}
+
+func (n NetkiPartner) CreateNewDomainContext(ctx context.Context, domainName string, partner Partner) (Domain, error) {
+	domainName, err := ValidateDomainName(domainName)
+	if err != nil {
+		return Domain{}, err
+	}
+
 	uri := new(bytes.Buffer)
 	uri.WriteString("/v1/partner/domain/")
 	uri.WriteString(urlEncode(domainName))
 
-	d := simplejson.New()
-	if partner.id != "" {
-		d.Set("partner_id", partner.id)
-	}
-
-	jsondata, err := d.MarshalJSON()
+	jsondata, err := json.Marshal(DomainRequest{PartnerId: partner.id})
 	if err != nil {
 		return Domain{}, err
 	}
 
-	resp, err := n.Requester.ProcessRequest(&n, uri.String(), "POST", string(jsondata[:len(jsondata)]))
-	if err != nil {
+	domainResp := DomainResponse{}
+	if err := requestInto(ctx, &n, uri.String(), "POST", string(jsondata), &domainResp); err != nil {
 		return Domain{}, err
 	}
 
 	returnDomain := Domain{}
-	returnDomain.DomainName = resp.Get("domain_name").MustString()
-	returnDomain.Status = resp.Get("status").MustString()
-	returnDomain.Namesevers = resp.Get("nameservers").MustStringArray()
+	returnDomain.DomainName = domainResp.DomainName
+	returnDomain.Status = domainResp.Status
+	returnDomain.Namesevers = domainResp.Nameservers
 
 	return returnDomain, nil
 }
 
 func (n NetkiPartner) GetDomains() ([]Domain, error) {
-	resp, err := n.Requester.ProcessRequest(&n, "/api/domain", "GET", "")
-	if err != nil {
+	return n.GetDomainsContext(context.Background())
+}
+
+func (n NetkiPartner) GetDomainsContext(ctx context.Context) ([]Domain, error) {
+	domainsResp := DomainsResponse{}
+	if err := requestInto(ctx, &n, "/api/domain", "GET", "", &domainsResp); err != nil {
 		return make([]Domain, 0), err
 	}
 
 	returnDomains := make([]Domain, 0)
-	for i := 0; i < len(resp.Get("domains").MustArray()); i++ {
-		newDomain := Domain{}
-		newDomain.DomainName = resp.Get("domains").GetIndex(i).Get("domain_name").MustString()
-		returnDomains = append(returnDomains, newDomain)
+	for _, d := range domainsResp.Domains {
+		returnDomains = append(returnDomains, Domain{DomainName: d.DomainName})
 	}
 	return returnDomains, nil
 }
 
 func (n NetkiPartner) GetDomainStatus(domain Domain) (returnDomain Domain, err error) {
-	resp, err := n.Requester.ProcessRequest(&n, "/v1/partner/domain/"+urlEncode(domain.DomainName), "GET", "")
-	if err != nil {
+	return n.GetDomainStatusContext(context.Background(), domain)
+}
+
+func (n NetkiPartner) GetDomainStatusContext(ctx context.Context, domain Domain) (returnDomain Domain, err error) {
+	domainResp := DomainResponse{}
+	if err := requestInto(ctx, &n, "/v1/partner/domain/"+urlEncode(domain.DomainName), "GET", "", &domainResp); err != nil {
 		return Domain{}, err
 	}
 
 	returnDomain = Domain{}
 	returnDomain.DomainName = domain.DomainName
-	returnDomain.Status = resp.Get("status").MustString()
-	returnDomain.DelegationStatus = resp.Get("delegation_status").MustBool(false)
-	returnDomain.DelegationMessage = resp.Get("delegation_message").MustString()
-	returnDomain.WalletNameCount = resp.Get("wallet_name_count").MustInt()
+	returnDomain.Status = domainResp.Status
+	returnDomain.DelegationStatus = domainResp.DelegationStatus
+	returnDomain.DelegationMessage = domainResp.DelegationMessage
+	returnDomain.WalletNameCount = domainResp.WalletNameCount
 	return returnDomain, nil
 }
 
 func (n NetkiPartner) GetDomainDnssec(domain Domain) (returnDomain Domain, err error) {
-	resp, err := n.Requester.ProcessRequest(&n, "/v1/partner/domain/dnssec/"+urlEncode(domain.DomainName), "GET", "")
-	if err != nil {
+	return n.GetDomainDnssecContext(context.Background(), domain)
+}
+
+func (n NetkiPartner) GetDomainDnssecContext(ctx context.Context, domain Domain) (returnDomain Domain, err error) {
+	dnssecResp := DnssecResponse{}
+	if err := requestInto(ctx, &n, "/v1/partner/domain/dnssec/"+urlEncode(domain.DomainName), "GET", "", &dnssecResp); err != nil {
 		return Domain{}, err
 	}
 
 	returnDomain = Domain{}
-	returnDomain.DomainName = fmt.Sprint(domain.DomainName)
-	returnDomain.NextRollDate, _ = time.Parse("2006-01-02T15:04:05.000Z", resp.Get("nextroll_date").MustString())
-	returnDomain.DsRecords = resp.Get("ds_records").MustStringArray()
-	returnDomain.PublicSigningKey = resp.Get("public_key_signing_key").MustString()
+	returnDomain.DomainName = domain.DomainName
+	returnDomain.NextRollDate, err = time.Parse(nextRollDateFormat, dnssecResp.NextRollDate)
+	if err != nil && n.StrictDecoding {
+		return Domain{}, &SchemaError{Payload: "DnssecResponse", Err: err}
+	}
+	returnDomain.DsRecords = dnssecResp.DsRecords
+	returnDomain.PublicSigningKey = dnssecResp.PublicKeySigningKey
 
 	return returnDomain, nil
 }
 
 func (n NetkiPartner) DeleteDomain(domain Domain) error {
-	_, err := n.Requester.ProcessRequest(&n, "/v1/partner/domain/"+urlEncode(domain.DomainName), "DELETE", "")
+	return n.DeleteDomainContext(context.Background(), domain)
+}
+
+func (n NetkiPartner) DeleteDomainContext(ctx context.Context, domain Domain) error {
+	err := requestInto(ctx, &n, "/v1/partner/domain/"+urlEncode(domain.DomainName), "DELETE", "", nil)
 	if err != nil {
 		return err
 	}
@@ -513,52 +728,48 @@ func (n NetkiPartner) CreateNewWalletName(domain Domain, name string, wallets []
 }
 
 func (n NetkiPartner) GetWalletNames(domain Domain, externalId string) ([]WalletName, error) {
-	uri := new(bytes.Buffer)
-	uri.WriteString("/v1/partner/walletname")
-
-	argSlice := make([]string, 0)
-	if domain.DomainName != "" {
-		argSlice = append(argSlice, "domain_name="+domain.DomainName)
-	}
-	if externalId != "" {
-		argSlice = append(argSlice, "external_id="+externalId)
-	}
-
-	if len(argSlice) > 0 {
-		uri.WriteString("?" + strings.Join(argSlice, "&"))
-	}
+	return n.GetWalletNamesContext(context.Background(), domain, externalId)
+}
 
-	resp, err := n.Requester.ProcessRequest(&n, uri.String(), "GET", "")
-	if err != nil {
+func (n NetkiPartner) GetWalletNamesContext(ctx context.Context, domain Domain, externalId string) ([]WalletName, error) {
+	walletNamesResp := WalletNamesResponse{}
+	if err := requestInto(ctx, &n, walletNamesUri(domain.DomainName, externalId), "GET", "", &walletNamesResp); err != nil {
 		return make([]WalletName, 0), err
 	}
 
-	if resp.Get("wallet_name_count").MustInt(0) == 0 {
+	if walletNamesResp.WalletNameCount == 0 {
 		return make([]WalletName, 0), nil
 	}
 
 	walletNames := make([]WalletName, 0)
-	for i := 0; i < len(resp.Get("wallet_names").MustArray()); i++ {
-		wn := resp.Get("wallet_names").GetIndex(i)
-		wallets := make([]Wallet, 0)
-		for j := 0; j < len(wn.Get("wallets").MustArray()); j++ {
-			wallet := wn.Get("wallets").GetIndex(j)
-			newWallet := Wallet{wallet.Get("currency").MustString(), wallet.Get("wallet_address").MustString()}
-			wallets = append(wallets, newWallet)
-		}
-		newWalletName := WalletName{}
-		newWalletName.Id = wn.Get("id").MustString()
-		newWalletName.DomainName = wn.Get("domain_name").MustString()
-		newWalletName.Name = wn.Get("name").MustString()
-		newWalletName.ExternalId = wn.Get("external_id").MustString()
-		newWalletName.Wallets = wallets
-		walletNames = append(walletNames, newWalletName)
+	for _, wn := range walletNamesResp.WalletNames {
+		walletNames = append(walletNames, wn.walletName())
 	}
 
 	return walletNames, nil
 
 }
 
+// walletNamesUri builds the wallet name listing URI with its filters and any extra arguments
+func walletNamesUri(domainName string, externalId string, extraArgs ...string) string {
+	uri := new(bytes.Buffer)
+	uri.WriteString("/v1/partner/walletname")
+
+	argSlice := make([]string, 0)
+	if domainName != "" {
+		argSlice = append(argSlice, "domain_name="+domainName)
+	}
+	if externalId != "" {
+		argSlice = append(argSlice, "external_id="+externalId)
+	}
+	argSlice = append(argSlice, extraArgs...)
+
+	if len(argSlice) > 0 {
+		uri.WriteString("?" + strings.Join(argSlice, "&"))
+	}
+	return uri.String()
+}
+
 // Constructor / NetkiPartner Factory
 func NewNetkiPartner(partnerId string, apiKey string, apiUrl string) *NetkiPartner {
 	return &NetkiPartner{Requester: new(NetkiRequester), PartnerId: partnerId, ApiKey: apiKey, ApiUrl: apiUrl}
@@ -567,3 +778,8 @@ func NewNetkiPartner(partnerId string, apiKey string, apiUrl string) *NetkiPartn
 func NewNetkiRemotePartner(apiUrl string, userKey *ecdsa.PrivateKey, keySigningKey *ecdsa.PublicKey, keySignature []byte) *NetkiPartner {
 	return &NetkiPartner{Requester: new(NetkiRequester), ApiUrl: apiUrl, UserKey: userKey, KeySigningKey: keySigningKey, KeySignature: keySignature}
 }
+
+// NewNetkiSignerPartner is NewNetkiRemotePartner for user keys held behind a crypto.Signer
+func NewNetkiSignerPartner(apiUrl string, userSigner crypto.Signer, keySigningKey *ecdsa.PublicKey, keySignature []byte) *NetkiPartner {
+	return &NetkiPartner{Requester: new(NetkiRequester), ApiUrl: apiUrl, UserSigner: userSigner, KeySigningKey: keySigningKey, KeySignature: keySignature}
+}
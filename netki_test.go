@@ -1,20 +1,27 @@
 package netki
 
 import (
+	"context"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/asn1"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/bitly/go-simplejson"
 	"github.com/bmizerany/assert"
+	"io"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 )
 
 type ecdsaSignature struct {
@@ -47,6 +54,25 @@ func (n *MockNetkiRequester) ProcessRequest(partner *NetkiPartner, uri string, m
 	return n.returnData, n.returnError
 }
 
+// Setup a fake crypto.Signer that never exposes its key
+type fakeSigner struct {
+	key     *ecdsa.PrivateKey
+	err     error
+	digests [][]byte
+}
+
+func (f *fakeSigner) Public() crypto.PublicKey {
+	return &f.key.PublicKey
+}
+
+func (f *fakeSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	f.digests = append(f.digests, digest)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return ecdsa.SignASN1(rand, f.key, digest)
+}
+
 // Setup WalletName Base
 func getWalletName() WalletName {
 	wn := WalletName{}
@@ -55,7 +81,7 @@ func getWalletName() WalletName {
 	wn.Name = "wallet"
 
 	wn.Wallets = make([]Wallet, 0)
-	wallet := Wallet{"btc", "1btcaddress"}
+	wallet := Wallet{"btc", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}
 	wn.Wallets = append(wn.Wallets, wallet)
 	return wn
 }
@@ -134,6 +160,65 @@ func TestProcessRequestUserKey(t *testing.T) {
 	assert.NotEqual(t, nil, result)
 }
 
+func TestProcessRequestUserSigner(t *testing.T) {
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"success":true,"wallet_names":[{"id":"my_id"}]}`)
+	}))
+	defer server.Close()
+
+	userKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	partnerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	signer := &fakeSigner{key: userKey}
+
+	partner := NewNetkiSignerPartner(server.URL, signer, &partnerKey.PublicKey, []byte("keysig"))
+	wn := getWalletName()
+	err := wn.Save(partner)
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(signer.digests))
+
+	userDER, _ := x509.MarshalPKIXPublicKey(&userKey.PublicKey)
+	assert.Equal(t, hex.EncodeToString(userDER), headers.Get("X-Identity"))
+	assert.Equal(t, partner.GetKeySigningKey(), headers.Get("X-Partner-Key"))
+	assert.Equal(t, hex.EncodeToString([]byte("keysig")), headers.Get("X-Partner-KeySig"))
+	assert.Equal(t, "", headers.Get("Authorization"))
+
+	body := `{"wallet_names":[{"domain_name":"domain.com","external_id":"ext_id","name":"wallet","wallets":[{"currency":"btc","wallet_address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}]}]}`
+	digest := sha256.Sum256([]byte(server.URL + "/v1/partner/walletname" + body))
+	sig, _ := hex.DecodeString(headers.Get("X-Signature"))
+	assert.Equal(t, digest[:], signer.digests[0])
+	assert.Equal(t, true, ecdsa.VerifyASN1(&userKey.PublicKey, digest[:], sig))
+}
+
+func TestProcessRequestUserSignerPreferred(t *testing.T) {
+	userKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	signer := &fakeSigner{key: userKey}
+
+	partner := &NetkiPartner{UserKey: otherKey, UserSigner: signer}
+	userDER, _ := x509.MarshalPKIXPublicKey(&userKey.PublicKey)
+	assert.Equal(t, hex.EncodeToString(userDER), partner.GetUserPublicKey())
+	assert.Equal(t, "", (&NetkiPartner{}).GetUserPublicKey())
+}
+
+func TestProcessRequestUserSignerError(t *testing.T) {
+	server, client := setupHttp(200, "application/json", `{"success":true}`)
+	defer server.Close()
+
+	userKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	signer := &fakeSigner{key: userKey, err: errors.New("token removed")}
+
+	requester := &NetkiRequester{HTTPClient: client}
+	_, err := requester.ProcessRequest(&NetkiPartner{UserSigner: signer}, "http://domain.com/uri", "GET", "")
+
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, "Unable to Sign Data: token removed", err.Error())
+	assert.Equal(t, signer.err, errors.Unwrap(err))
+}
+
 func TestProcessRequestDelete204(t *testing.T) {
 	server, client := setupHttp(204, "application/json", `{"success":true,"message":"my message"}`)
 	defer server.Close()
@@ -198,11 +283,78 @@ func TestProcessRequestSuccessFalseWithFailures(t *testing.T) {
 	assert.Equal(t, "Error Message [FAILURES: fail1, fail2]", err.Error())
 }
 
+func TestProcessRequestContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	requester := &NetkiRequester{}
+	result, err := requester.ProcessRequestContext(ctx, &NetkiPartner{ApiUrl: server.URL}, "/uri", "GET", "")
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, &simplejson.Json{}, result)
+}
+
+func TestProcessRequestContextDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	requester := &NetkiRequester{}
+	_, err := requester.ProcessRequestContext(ctx, &NetkiPartner{ApiUrl: server.URL}, "/uri", "GET", "")
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestGetWalletNamesContext(t *testing.T) {
+	var calledUri string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calledUri = r.URL.String()
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"success":true,"wallet_name_count":1,"wallet_names":[{"id":"id1","domain_name":"domain.com","name":"name1","wallets":[{"currency":"btc","wallet_address":"1btcaddress"}]}]}`)
+	}))
+	defer server.Close()
+
+	partner := NewNetkiPartner("partner_id", "api_key", server.URL)
+	wns, err := partner.GetWalletNamesContext(context.Background(), Domain{DomainName: "domain.com"}, "")
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "/v1/partner/walletname?domain_name=domain.com", calledUri)
+	assert.Equal(t, 1, len(wns))
+	assert.Equal(t, "1btcaddress", wns[0].GetAddress("btc"))
+}
+
+func TestSaveContextCanceledLegacyRequester(t *testing.T) {
+	mockRequester := getMockRequester(`{"wallet_names":[{"id":"my_id"}]}`, nil)
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	wn := getWalletName()
+	err := wn.SaveContext(ctx, mockPartner)
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, "", wn.Id)
+	assert.Equal(t, "", mockRequester.calledUri)
+}
+
 // WalletName Tests
 func TestGetAddress(t *testing.T) {
 	wn := getWalletName()
 
-	assert.Equal(t, "1btcaddress", wn.GetAddress("btc"))
+	assert.Equal(t, "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", wn.GetAddress("btc"))
 	assert.Equal(t, "", wn.GetAddress("no_currency"))
 }
 
@@ -247,7 +399,7 @@ func TestSaveNew(t *testing.T) {
 	assert.Equal(t, "my_id", wn.Id)
 	assert.Equal(t, "/v1/partner/walletname", mockRequester.calledUri)
 	assert.Equal(t, "POST", mockRequester.calledMethod)
-	assert.Equal(t, `{"wallet_names":[{"domain_name":"domain.com","external_id":"ext_id","name":"wallet","wallets":[{"currency":"btc","wallet_address":"1btcaddress"}]}]}`, mockRequester.calledBodyData)
+	assert.Equal(t, `{"wallet_names":[{"domain_name":"domain.com","external_id":"ext_id","name":"wallet","wallets":[{"currency":"btc","wallet_address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}]}]}`, mockRequester.calledBodyData)
 }
 
 func TestSaveExisting(t *testing.T) {
@@ -263,7 +415,7 @@ func TestSaveExisting(t *testing.T) {
 	assert.Equal(t, "my_id", wn.Id)
 	assert.Equal(t, "/v1/partner/walletname", mockRequester.calledUri)
 	assert.Equal(t, "PUT", mockRequester.calledMethod)
-	assert.Equal(t, `{"wallet_names":[{"domain_name":"domain.com","external_id":"ext_id","id":"existingId","name":"wallet","wallets":[{"currency":"btc","wallet_address":"1btcaddress"}]}]}`, mockRequester.calledBodyData)
+	assert.Equal(t, `{"wallet_names":[{"domain_name":"domain.com","external_id":"ext_id","id":"existingId","name":"wallet","wallets":[{"currency":"btc","wallet_address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}]}]}`, mockRequester.calledBodyData)
 }
 
 func TestSaveErrorResponse(t *testing.T) {
@@ -277,7 +429,7 @@ func TestSaveErrorResponse(t *testing.T) {
 	assert.Equal(t, "Error Message", err.Error())
 	assert.Equal(t, "/v1/partner/walletname", mockRequester.calledUri)
 	assert.Equal(t, "POST", mockRequester.calledMethod)
-	assert.Equal(t, `{"wallet_names":[{"domain_name":"domain.com","external_id":"ext_id","name":"wallet","wallets":[{"currency":"btc","wallet_address":"1btcaddress"}]}]}`, mockRequester.calledBodyData)
+	assert.Equal(t, `{"wallet_names":[{"domain_name":"domain.com","external_id":"ext_id","name":"wallet","wallets":[{"currency":"btc","wallet_address":"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"}]}]}`, mockRequester.calledBodyData)
 }
 
 func TestDeleteGoRight(t *testing.T) {
@@ -716,32 +868,63 @@ func TestGetWalletNamesZeroWalletCount(t *testing.T) {
 	assert.Equal(t, 0, len(wns))
 }
 
+// Setup a stand-in for the public lookup API
+func setupLookupHttp() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/wallet_lookup/wallet.mattdavid.xyz/btc":
+			fmt.Fprint(w, `{"success":true,"wallet_name":"wallet.mattdavid.xyz","currency":"btc","wallet_address":"1btcaddress"}`)
+		case "/api/wallet_lookup/wallet.mattdavid.xyz/badbad":
+			fmt.Fprint(w, `{"success":false,"message":"Wallet Name Does Not Exist"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"success":false,"message":"Wallet Name Does Not Exist"}`)
+		}
+	}))
+}
+
+func useLookupHttp(t *testing.T) {
+	server := setupLookupHttp()
+	defaultResolver := DefaultResolver
+	DefaultResolver = &Resolver{BaseURL: server.URL + "/api/wallet_lookup", HTTPClient: server.Client()}
+	t.Cleanup(func() {
+		DefaultResolver = defaultResolver
+		server.Close()
+	})
+}
+
 func TestWalletNameLookup(t *testing.T) {
+	useLookupHttp(t)
 	uri := "wallet.mattdavid.xyz"
 	currency := "btc"
 	s, err := WalletNameLookup(uri, currency)
 	if err != nil {
 		t.Error(err)
 	}
-	t.Log("Address:", s)
+	assert.Equal(t, "1btcaddress", s)
 }
 
 func TestWalletNameLookupBadname(t *testing.T) {
+	useLookupHttp(t)
 	uri := "badbad"
 	currency := "btc"
 	s, err := WalletNameLookup(uri, currency)
 	if err == nil {
 		t.Error("Got no error on bad currency")
 	}
-	t.Log("Address:", s)
+	assert.Equal(t, "Could not resolve netki address", err.Error())
+	assert.Equal(t, "", s)
 }
 
 func TestWalletNameLookupBadCurrency(t *testing.T) {
+	useLookupHttp(t)
 	uri := "wallet.mattdavid.xyz"
 	currency := "badbad"
 	s, err := WalletNameLookup(uri, currency)
 	if err == nil {
 		t.Error("Got no error on bad currency")
 	}
-	t.Log("Address:", s)
+	assert.Equal(t, "Wallet Name Does Not Exist", err.Error())
+	assert.Equal(t, "", s)
 }
@@ -0,0 +1,114 @@
+package netkitest
+
+import (
+	"net/http"
+	"netki"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault makes the server misbehave for matching requests
+type Fault struct {
+	// Method and Path select the requests to fail. An empty Method matches
+	// every method; Path is a prefix of the request path, empty matching all.
+	Method string
+	Path   string
+
+	// Times is the number of matching requests to fail, every one when zero
+	Times int
+
+	// Delay is waited before answering, or before Drop
+	Delay time.Duration
+
+	// Drop closes the connection without answering
+	Drop bool
+
+	// StatusCode, Message and Failures make up an error response. Body, when
+	// set, is sent verbatim instead, e.g. to return malformed JSON.
+	StatusCode int
+	Message    string
+	Failures   []netki.FailurePayload
+	Body       string
+
+	// RetryAfter, when set, is sent as the Retry-After header in seconds
+	RetryAfter time.Duration
+
+	served int
+}
+
+// InjectFault adds a fault. Faults are tried in the order they were added and
+// the first matching one is applied.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes every fault
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// fault returns the fault to apply to r, if any, counting it as served
+func (s *Server) fault(r *http.Request) *Fault {
+	for _, f := range s.faults {
+		if f.Method != "" && f.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, f.Path) {
+			continue
+		}
+		if f.Times > 0 && f.served >= f.Times {
+			continue
+		}
+		f.served++
+		copied := *f
+		return &copied
+	}
+	return nil
+}
+
+// apply writes the fault's response, reporting false when the request should
+// be handled normally after the delay
+func (f *Fault) apply(w http.ResponseWriter) bool {
+	if f.Delay > 0 {
+		time.Sleep(f.Delay)
+	}
+
+	if f.Drop {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return true
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	if f.StatusCode == 0 && f.Body == "" {
+		return false
+	}
+	status := f.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if f.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(f.RetryAfter/time.Second)))
+	}
+	if f.Body != "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(f.Body))
+		return true
+	}
+
+	message := f.Message
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	writeStatus(w, status, message, f.Failures)
+	return true
+}
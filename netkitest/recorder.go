@@ -0,0 +1,261 @@
+package netkitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"netki"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// RecorderMode selects whether a Recorder talks to the network
+type RecorderMode int
+
+const (
+	// ModeReplay serves recorded responses and never touches the network
+	ModeReplay RecorderMode = iota
+
+	// ModeRecord sends requests on and records every exchange
+	ModeRecord
+)
+
+// Redacted replaces the values of redacted headers in golden files
+const Redacted = "REDACTED"
+
+// DefaultRedactedHeaders carry credentials and are never written to golden files
+var DefaultRedactedHeaders = []string{"Authorization", "X-Signature", "X-Partner-KeySig", "X-Signature-Nonce", "Cookie", "Set-Cookie"}
+
+const goldenFileVersion = 1
+
+// Interaction is one recorded request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+type goldenFile struct {
+	Version      int            `json:"version"`
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Recorder is an http.RoundTripper that records exchanges to a golden file
+// or replays them from one. Replayed requests are matched on method, path,
+// query and JSON body, ignoring key order and whitespace; each recorded
+// interaction is served once, in recorded order.
+type Recorder struct {
+	// Path is the golden file
+	Path string
+	Mode RecorderMode
+
+	// Transport sends requests in ModeRecord, http.DefaultTransport when nil
+	Transport http.RoundTripper
+
+	// RedactHeaders are redacted in addition to DefaultRedactedHeaders
+	RedactHeaders []string
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewRecorder creates a Recorder for a golden file, loading it in ModeReplay
+func NewRecorder(path string, mode RecorderMode) (*Recorder, error) {
+	r := &Recorder{Path: path, Mode: mode}
+	if mode != ModeReplay {
+		return r, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("netkitest: unable to read golden file: %s", err)
+	}
+	file := goldenFile{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("netkitest: unable to parse golden file %s: %s", path, err)
+	}
+	if file.Version != goldenFileVersion {
+		return nil, fmt.Errorf("netkitest: golden file %s has unsupported version %d", path, file.Version)
+	}
+	r.interactions = file.Interactions
+	r.used = make([]bool, len(file.Interactions))
+	return r, nil
+}
+
+// Client returns an HTTP client using the recorder
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Requester returns a NetkiRequester sending its requests through the recorder
+func (r *Recorder) Requester() *netki.NetkiRequester {
+	return &netki.NetkiRequester{HTTPClient: r.Client()}
+}
+
+// RoundTrip records or replays a single exchange
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		data, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = string(data)
+		req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	}
+	recorded := RecordedRequest{Method: req.Method, Path: req.URL.Path, Query: req.URL.RawQuery, Header: r.redact(req.Header), Body: body}
+
+	if r.Mode == ModeReplay {
+		return r.replay(req, recorded)
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, &Interaction{
+		Request:  recorded,
+		Response: RecordedResponse{StatusCode: resp.StatusCode, Header: r.redact(resp.Header), Body: string(data)},
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	key := matchKey(recorded)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.interactions {
+		if r.used[i] || matchKey(interaction.Request) != key {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Header.Clone(),
+			Body:          ioutil.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("netkitest: no recorded interaction for %s %s", recorded.Method, recorded.Path)
+}
+
+// Unused returns the recorded interactions that have not been replayed
+func (r *Recorder) Unused() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	unused := make([]*Interaction, 0)
+	for i, interaction := range r.interactions {
+		if !r.used[i] {
+			unused = append(unused, interaction)
+		}
+	}
+	return unused
+}
+
+// Save writes the recorded interactions to the golden file
+func (r *Recorder) Save() error {
+	r.mu.Lock()
+	file := goldenFile{Version: goldenFileVersion, Interactions: append(make([]*Interaction, 0), r.interactions...)}
+	data, err := json.MarshalIndent(file, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0755); err != nil {
+		return fmt.Errorf("netkitest: unable to write golden file: %s", err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(r.Path), filepath.Base(r.Path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("netkitest: unable to write golden file: %s", err)
+	}
+	_, err = tmp.Write(append(data, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), r.Path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("netkitest: unable to write golden file: %s", err)
+	}
+	return nil
+}
+
+// redact copies header with credential values replaced
+func (r *Recorder) redact(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range append(append([]string(nil), DefaultRedactedHeaders...), r.RedactHeaders...) {
+		if _, ok := redacted[http.CanonicalHeaderKey(name)]; ok {
+			redacted.Set(name, Redacted)
+		}
+	}
+	return redacted
+}
+
+// matchKey identifies the requests an interaction answers
+func matchKey(req RecordedRequest) string {
+	query, err := url.ParseQuery(req.Query)
+	normalizedQuery := req.Query
+	if err == nil {
+		// Encode sorts by key
+		normalizedQuery = query.Encode()
+	}
+	return strings.Join([]string{strings.ToUpper(req.Method), req.Path, normalizedQuery, normalizeBody(req.Body)}, "\n")
+}
+
+// normalizeBody re-encodes JSON bodies so that key order and whitespace do not matter
+func normalizeBody(body string) string {
+	var v interface{}
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return strings.TrimSpace(body)
+	}
+	// Object keys are marshalled in sorted order
+	normalized, err := json.Marshal(v)
+	if err != nil {
+		return strings.TrimSpace(body)
+	}
+	return string(normalized)
+}
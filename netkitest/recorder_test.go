@@ -0,0 +1,99 @@
+package netkitest
+
+import (
+	"github.com/bmizerany/assert"
+	"io/ioutil"
+	"net/http"
+	"netki"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recordedScenario creates a wallet name and reads it back
+func recordedScenario(t *testing.T, partner *netki.NetkiPartner) {
+	wn := partner.CreateNewWalletName(netki.Domain{DomainName: "domain.com"}, "wallet", []netki.Wallet{{Currency: "btc", WalletAddress: testAddress}}, "ext1")
+	assert.Equal(t, nil, wn.Save(partner))
+	assert.Equal(t, "id1", wn.Id)
+
+	walletNames, err := partner.GetWalletNames(netki.Domain{DomainName: "domain.com"}, "ext1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(walletNames))
+	assert.Equal(t, testAddress, walletNames[0].GetAddress("btc"))
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "testdata", "scenario.json")
+
+	server := NewServer()
+	server.AddDomain("domain.com")
+	recorder, err := NewRecorder(golden, ModeRecord)
+	assert.Equal(t, nil, err)
+	partner := server.Partner()
+	partner.Requester = recorder.Requester()
+	recordedScenario(t, partner)
+	assert.Equal(t, nil, recorder.Save())
+	server.Close()
+
+	data, err := ioutil.ReadFile(golden)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, strings.Contains(string(data), DefaultAPIKey))
+	assert.Equal(t, true, strings.Contains(string(data), Redacted))
+
+	// Replay runs without the server
+	replayer, err := NewRecorder(golden, ModeReplay)
+	assert.Equal(t, nil, err)
+	partner = netki.NewNetkiPartner(DefaultPartnerID, "another-key", "http://staging.invalid")
+	partner.Requester = replayer.Requester()
+	recordedScenario(t, partner)
+	assert.Equal(t, 0, len(replayer.Unused()))
+
+	// Every interaction is served once
+	_, err = partner.GetWalletNames(netki.Domain{DomainName: "domain.com"}, "ext1")
+	assert.Equal(t, true, strings.Contains(err.Error(), "netkitest: no recorded interaction for GET /v1/partner/walletname"))
+}
+
+func TestReplayMatching(t *testing.T) {
+	recorder := &Recorder{Mode: ModeReplay}
+	recorder.interactions = []*Interaction{
+		{Request: RecordedRequest{Method: "POST", Path: "/v1/thing", Query: "b=2&a=1", Body: `{"b": [1, 2], "a": {"y": 1.50, "x": "z"}}`}, Response: RecordedResponse{StatusCode: 201, Body: "first"}},
+		{Request: RecordedRequest{Method: "GET", Path: "/v1/thing"}, Response: RecordedResponse{StatusCode: 200, Body: "second"}},
+	}
+	recorder.used = make([]bool, 2)
+	client := recorder.Client()
+
+	// Different body fails to match
+	resp, err := client.Post("http://any.invalid/v1/thing?a=1&b=2", "application/json", strings.NewReader(`{"a":{"x":"z","y":1.50},"b":[2,1]}`))
+	assert.NotEqual(t, nil, err)
+
+	resp, err = client.Post("http://any.invalid/v1/thing?a=1&b=2", "application/json", strings.NewReader(`{"a":{"x":"z","y":1.50},"b":[1,2]}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 201, resp.StatusCode)
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "first", string(body))
+
+	assert.Equal(t, 1, len(recorder.Unused()))
+	resp, err = client.Get("http://other.invalid/v1/thing")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 0, len(recorder.Unused()))
+}
+
+func TestRecorderRedactsHeaders(t *testing.T) {
+	recorder := &Recorder{RedactHeaders: []string{"X-Custom-Secret"}}
+	header := http.Header{}
+	header.Set("Authorization", "secret-key")
+	header.Set("X-Custom-Secret", "hush")
+	header.Set("X-Partner-ID", "partner")
+
+	redacted := recorder.redact(header)
+	assert.Equal(t, Redacted, redacted.Get("Authorization"))
+	assert.Equal(t, Redacted, redacted.Get("X-Custom-Secret"))
+	assert.Equal(t, "partner", redacted.Get("X-Partner-ID"))
+	assert.Equal(t, "secret-key", header.Get("Authorization"))
+}
+
+func TestNewRecorderMissingFile(t *testing.T) {
+	_, err := NewRecorder(filepath.Join(t.TempDir(), "missing.json"), ModeReplay)
+	assert.NotEqual(t, nil, err)
+}
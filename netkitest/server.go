@@ -0,0 +1,485 @@
+// Package netkitest provides an in-memory fake of the Netki partner and
+// lookup APIs for testing code that uses the netki client.
+//
+//	server := netkitest.NewServer()
+//	defer server.Close()
+//	partner := server.Partner()
+//
+// The server keeps partners, domains and wallet names in memory, answers with
+// the same success and failures envelopes as the real API, and can be told to
+// fail requests with InjectFault.
+package netkitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"netki"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default credentials accepted by a new Server
+const (
+	DefaultPartnerID = "test-partner"
+	DefaultAPIKey    = "test-api-key"
+)
+
+// LookupPath is the path of the public lookup API on the server
+const LookupPath = "/api/wallet_lookup"
+
+// Request is a request the server received
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Header http.Header
+	Body   string
+}
+
+// Server is a stateful fake of the partner API. Its exported fields may be
+// changed before requests are made.
+type Server struct {
+	*httptest.Server
+
+	// PartnerID and APIKey are the credentials API key requests must carry
+	PartnerID string
+	APIKey    string
+
+	// Verifier, when set, checks key-signed requests. Without it any request
+	// carrying X-Identity is accepted.
+	Verifier *netki.SignatureVerifier
+
+	mu          sync.Mutex
+	nextId      int
+	partners    []netki.PartnerPayload
+	domains     []*domainState
+	walletNames []netki.WalletNamePayload
+	faults      []*Fault
+	requests    []Request
+}
+
+type domainState struct {
+	name      string
+	partnerId string
+}
+
+// NewServer starts a Server accepting DefaultPartnerID and DefaultAPIKey.
+// The caller must Close it.
+func NewServer() *Server {
+	s := &Server{PartnerID: DefaultPartnerID, APIKey: DefaultAPIKey}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Partner returns a client authenticated with the server's API key
+func (s *Server) Partner() *netki.NetkiPartner {
+	return netki.NewNetkiPartner(s.PartnerID, s.APIKey, s.URL)
+}
+
+// Resolver returns a resolver that looks up wallet names on the server
+func (s *Server) Resolver() *netki.Resolver {
+	return &netki.Resolver{BaseURL: s.URL + LookupPath, HTTPClient: s.Client()}
+}
+
+// AddDomain creates a domain without going through the API
+func (s *Server) AddDomain(domainName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.domain(domainName) == nil {
+		s.domains = append(s.domains, &domainState{name: domainName})
+	}
+}
+
+// AddWalletName stores a wallet name without going through the API, creating
+// its domain if needed, and returns the id it was given
+func (s *Server) AddWalletName(wn netki.WalletName) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.domain(wn.DomainName) == nil {
+		s.domains = append(s.domains, &domainState{name: wn.DomainName})
+	}
+	payload := netki.WalletNamePayload{DomainName: wn.DomainName, ExternalId: wn.ExternalId, Id: s.newId(), Name: wn.Name, Wallets: make([]netki.WalletPayload, 0)}
+	for _, wallet := range wn.Wallets {
+		payload.Wallets = append(payload.Wallets, netki.WalletPayload{Currency: wallet.Currency, WalletAddress: wallet.WalletAddress})
+	}
+	s.walletNames = append(s.walletNames, payload)
+	return payload.Id
+}
+
+// WalletNames returns the stored wallet names of a domain, or of every domain
+// when domainName is empty
+func (s *Server) WalletNames(domainName string) []netki.WalletName {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	walletNames := make([]netki.WalletName, 0)
+	for _, payload := range s.walletNames {
+		if domainName != "" && payload.DomainName != domainName {
+			continue
+		}
+		wn := netki.WalletName{Id: payload.Id, DomainName: payload.DomainName, Name: payload.Name, ExternalId: payload.ExternalId, Wallets: make([]netki.Wallet, 0)}
+		for _, wallet := range payload.Wallets {
+			wn.Wallets = append(wn.Wallets, netki.Wallet{Currency: wallet.Currency, WalletAddress: wallet.WalletAddress})
+		}
+		walletNames = append(walletNames, wn)
+	}
+	return walletNames
+}
+
+// Requests returns every request received so far, including failed ones
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Reset forgets all state, faults and recorded requests
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.partners, s.domains, s.walletNames, s.faults, s.requests = nil, nil, nil, nil, nil
+}
+
+func (s *Server) newId() string {
+	s.nextId++
+	return "id" + strconv.Itoa(s.nextId)
+}
+
+func (s *Server) domain(domainName string) *domainState {
+	for _, d := range s.domains {
+		if d.name == domainName {
+			return d
+		}
+	}
+	return nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Header: r.Header.Clone(), Body: string(body)})
+	fault := s.fault(r)
+	s.mu.Unlock()
+
+	if fault != nil && fault.apply(w) {
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, LookupPath+"/") && !s.authorized(r, body) {
+		writeStatus(w, http.StatusUnauthorized, "Unauthorized", nil)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := r.URL.Path
+	switch {
+	case strings.HasPrefix(path, LookupPath+"/"):
+		s.lookup(w, strings.TrimPrefix(path, LookupPath+"/"))
+	case path == "/v1/admin/partner" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, netki.PartnersResponse{ResponseStatus: success(), Partners: append(make([]netki.PartnerPayload, 0), s.partners...)})
+	case strings.HasPrefix(path, "/v1/admin/partner/"):
+		s.partner(w, r.Method, strings.TrimPrefix(path, "/v1/admin/partner/"))
+	case path == "/api/domain" && r.Method == "GET":
+		domains := make([]netki.DomainPayload, 0)
+		for _, d := range s.domains {
+			domains = append(domains, netki.DomainPayload{DomainName: d.name})
+		}
+		writeJSON(w, http.StatusOK, netki.DomainsResponse{ResponseStatus: success(), Domains: domains})
+	case strings.HasPrefix(path, "/v1/partner/domain/dnssec/") && r.Method == "GET":
+		s.dnssec(w, strings.TrimPrefix(path, "/v1/partner/domain/dnssec/"))
+	case strings.HasPrefix(path, "/v1/partner/domain/"):
+		s.domainRequest(w, r.Method, strings.TrimPrefix(path, "/v1/partner/domain/"), body)
+	case path == "/v1/partner/walletname":
+		s.walletNameRequest(w, r, body)
+	case path == "/v1/partner/currency" && r.Method == "GET":
+		currencies := make([]netki.CurrencyPayload, 0)
+		for _, c := range netki.RegisteredCurrencies() {
+			currencies = append(currencies, netki.CurrencyPayload{Code: c.Code, Name: c.Name})
+		}
+		writeJSON(w, http.StatusOK, netki.CurrenciesResponse{ResponseStatus: success(), Currencies: currencies})
+	default:
+		writeStatus(w, http.StatusNotFound, "Not Found", nil)
+	}
+}
+
+// authorized checks the API key headers, or the signature of key-signed requests
+func (s *Server) authorized(r *http.Request, body []byte) bool {
+	if r.Header.Get("X-Identity") != "" {
+		if s.Verifier == nil {
+			return true
+		}
+		r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+		_, err := s.Verifier.Verify(r)
+		return err == nil
+	}
+	return r.Header.Get("X-Partner-ID") == s.PartnerID && r.Header.Get("Authorization") == s.APIKey
+}
+
+func (s *Server) partner(w http.ResponseWriter, method string, name string) {
+	for i, p := range s.partners {
+		if p.Name != name {
+			continue
+		}
+		switch method {
+		case "POST":
+			writeStatus(w, http.StatusBadRequest, "Partner Already Exists", nil)
+		case "DELETE":
+			s.partners = append(s.partners[:i], s.partners[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeStatus(w, http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		}
+		return
+	}
+
+	if method != "POST" {
+		writeStatus(w, http.StatusNotFound, "Partner Not Found", nil)
+		return
+	}
+	p := netki.PartnerPayload{Id: s.newId(), Name: name}
+	s.partners = append(s.partners, p)
+	writeJSON(w, http.StatusCreated, netki.PartnerResponse{ResponseStatus: success(), Partner: p})
+}
+
+func (s *Server) domainRequest(w http.ResponseWriter, method string, domainName string, body []byte) {
+	d := s.domain(domainName)
+	switch {
+	case method == "POST" && d != nil:
+		writeStatus(w, http.StatusBadRequest, "Domain Already Exists", nil)
+	case method == "POST":
+		req := netki.DomainRequest{}
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				writeStatus(w, http.StatusBadRequest, "Invalid JSON", nil)
+				return
+			}
+		}
+		s.domains = append(s.domains, &domainState{name: domainName, partnerId: req.PartnerId})
+		writeJSON(w, http.StatusCreated, netki.DomainResponse{ResponseStatus: success(), DomainName: domainName, Status: "completed", Nameservers: nameservers()})
+	case d == nil:
+		writeStatus(w, http.StatusNotFound, "Domain Not Found", nil)
+	case method == "GET":
+		count := 0
+		for _, wn := range s.walletNames {
+			if wn.DomainName == domainName {
+				count++
+			}
+		}
+		writeJSON(w, http.StatusOK, netki.DomainResponse{ResponseStatus: success(), Status: "completed", DelegationStatus: true, DelegationMessage: "Delegated", WalletNameCount: count})
+	case method == "DELETE":
+		for i := range s.domains {
+			if s.domains[i] == d {
+				s.domains = append(s.domains[:i], s.domains[i+1:]...)
+				break
+			}
+		}
+		kept := make([]netki.WalletNamePayload, 0)
+		for _, wn := range s.walletNames {
+			if wn.DomainName != domainName {
+				kept = append(kept, wn)
+			}
+		}
+		s.walletNames = kept
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeStatus(w, http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+	}
+}
+
+func (s *Server) dnssec(w http.ResponseWriter, domainName string) {
+	if s.domain(domainName) == nil {
+		writeStatus(w, http.StatusNotFound, "Domain Not Found", nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, netki.DnssecResponse{
+		ResponseStatus:      success(),
+		NextRollDate:        time.Now().UTC().AddDate(0, 3, 0).Format("2006-01-02T15:04:05.000Z"),
+		DsRecords:           []string{domainName + ". 3600 IN DS 12345 13 2 0000000000000000000000000000000000000000000000000000000000000000"},
+		PublicKeySigningKey: "256 3 13 dGVzdA==",
+	})
+}
+
+func (s *Server) walletNameRequest(w http.ResponseWriter, r *http.Request, body []byte) {
+	if r.Method == "GET" {
+		s.listWalletNames(w, r)
+		return
+	}
+
+	if r.Method == "DELETE" {
+		req := netki.WalletNamesDeleteRequest{}
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeStatus(w, http.StatusBadRequest, "Invalid JSON", nil)
+			return
+		}
+		failures := make([]netki.FailurePayload, 0)
+		seen := make(map[string]bool)
+		for _, ref := range req.WalletNames {
+			if s.walletNameIndex(ref.Id) < 0 {
+				failures = append(failures, netki.FailurePayload{Field: "id", Message: fmt.Sprintf("Wallet Name %s Not Found", ref.Id)})
+			} else if seen[ref.Id] {
+				failures = append(failures, netki.FailurePayload{Field: "id", Message: fmt.Sprintf("Wallet Name %s Listed More Than Once", ref.Id)})
+			}
+			seen[ref.Id] = true
+		}
+		if len(failures) > 0 {
+			writeStatus(w, http.StatusBadRequest, "Wallet Name Deletion Failed", failures)
+			return
+		}
+		for _, ref := range req.WalletNames {
+			i := s.walletNameIndex(ref.Id)
+			s.walletNames = append(s.walletNames[:i], s.walletNames[i+1:]...)
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method != "POST" && r.Method != "PUT" {
+		writeStatus(w, http.StatusMethodNotAllowed, "Method Not Allowed", nil)
+		return
+	}
+	req := netki.WalletNamesRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeStatus(w, http.StatusBadRequest, "Invalid JSON", nil)
+		return
+	}
+
+	// Validate the whole request first so that it is applied entirely or not at all
+	failures := make([]netki.FailurePayload, 0)
+	for i, wn := range req.WalletNames {
+		if message := s.checkWalletName(r.Method, wn, req.WalletNames[:i]); message != "" {
+			failures = append(failures, netki.FailurePayload{Name: wn.Name, Message: message})
+		}
+	}
+	if len(failures) > 0 {
+		writeStatus(w, http.StatusBadRequest, "Wallet Name Validation Failed", failures)
+		return
+	}
+
+	saved := make([]netki.SavedWalletNamePayload, 0)
+	for _, wn := range req.WalletNames {
+		if wn.Wallets == nil {
+			wn.Wallets = make([]netki.WalletPayload, 0)
+		}
+		if r.Method == "POST" {
+			wn.Id = s.newId()
+			s.walletNames = append(s.walletNames, wn)
+		} else {
+			s.walletNames[s.walletNameIndex(wn.Id)] = wn
+		}
+		saved = append(saved, netki.SavedWalletNamePayload{DomainName: wn.DomainName, ExternalId: wn.ExternalId, Id: wn.Id, Name: wn.Name, Wallets: wn.Wallets})
+	}
+
+	status := http.StatusOK
+	if r.Method == "POST" {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, netki.WalletNamesSaveResponse{ResponseStatus: success(), WalletNames: saved})
+}
+
+// checkWalletName returns why a wallet name cannot be saved, or "" when it can.
+// earlier holds the wallet names before it in the same request.
+func (s *Server) checkWalletName(method string, wn netki.WalletNamePayload, earlier []netki.WalletNamePayload) string {
+	if s.domain(wn.DomainName) == nil {
+		return fmt.Sprintf("Domain %s Not Found", wn.DomainName)
+	}
+	if wn.Name == "" {
+		return "Wallet Name Required"
+	}
+	if method == "PUT" && s.walletNameIndex(wn.Id) < 0 {
+		return fmt.Sprintf("Wallet Name %s Not Found", wn.Id)
+	}
+	for _, other := range append(append([]netki.WalletNamePayload(nil), s.walletNames...), earlier...) {
+		if other.DomainName == wn.DomainName && other.Name == wn.Name && (method == "POST" || other.Id != wn.Id) {
+			return fmt.Sprintf("Wallet Name %s.%s Already Exists", wn.Name, wn.DomainName)
+		}
+	}
+	for _, wallet := range wn.Wallets {
+		if wallet.Currency == "" || wallet.WalletAddress == "" {
+			return "Currency and Wallet Address Required"
+		}
+	}
+	return ""
+}
+
+func (s *Server) walletNameIndex(id string) int {
+	for i, wn := range s.walletNames {
+		if id != "" && wn.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Server) listWalletNames(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	matching := make([]netki.WalletNamePayload, 0)
+	for _, wn := range s.walletNames {
+		if domainName := query.Get("domain_name"); domainName != "" && wn.DomainName != domainName {
+			continue
+		}
+		if externalId := query.Get("external_id"); externalId != "" && wn.ExternalId != externalId {
+			continue
+		}
+		matching = append(matching, wn)
+	}
+
+	page := matching
+	if offset, err := strconv.Atoi(query.Get("offset")); err == nil && offset > 0 {
+		if offset > len(page) {
+			offset = len(page)
+		}
+		page = page[offset:]
+	}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 && limit < len(page) {
+		page = page[:limit]
+	}
+	writeJSON(w, http.StatusOK, netki.WalletNamesResponse{ResponseStatus: success(), WalletNameCount: len(matching), WalletNames: page})
+}
+
+func (s *Server) lookup(w http.ResponseWriter, rest string) {
+	parts := strings.Split(rest, "/")
+	if len(parts) != 2 {
+		writeStatus(w, http.StatusNotFound, "Not Found", nil)
+		return
+	}
+	name, currency := strings.ToLower(strings.TrimSuffix(parts[0], ".")), netki.NormalizeCurrency(parts[1])
+
+	for _, wn := range s.walletNames {
+		if strings.ToLower(wn.Name+"."+wn.DomainName) != name {
+			continue
+		}
+		for _, wallet := range wn.Wallets {
+			if netki.NormalizeCurrency(wallet.Currency) == currency {
+				writeJSON(w, http.StatusOK, netki.LookupResponse{ResponseStatus: success(), WalletName: name, Currency: currency, WalletAddress: wallet.WalletAddress})
+				return
+			}
+		}
+	}
+	writeStatus(w, http.StatusNotFound, "Wallet Name Does Not Exist", nil)
+}
+
+func success() netki.ResponseStatus {
+	return netki.ResponseStatus{Success: true}
+}
+
+func nameservers() []string {
+	return []string{"ns1.netkitest.invalid", "ns2.netkitest.invalid"}
+}
+
+func writeStatus(w http.ResponseWriter, status int, message string, failures []netki.FailurePayload) {
+	writeJSON(w, status, netki.ResponseStatus{Success: false, Message: message, Failures: failures})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
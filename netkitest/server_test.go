@@ -0,0 +1,184 @@
+package netkitest
+
+import (
+	"errors"
+	"github.com/bmizerany/assert"
+	"net/http"
+	"netki"
+	"testing"
+	"time"
+)
+
+const testAddress = "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+
+func TestPartnersAndDomains(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	partner := server.Partner()
+
+	created, err := partner.CreateNewPartner("SubPartner")
+	assert.Equal(t, nil, err)
+	partners, err := partner.GetPartners()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []netki.Partner{created}, partners)
+
+	domain, err := partner.CreateNewDomain("domain.com", created)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "domain.com", domain.DomainName)
+	assert.Equal(t, "completed", domain.Status)
+
+	_, err = partner.CreateNewDomain("domain.com", created)
+	assert.Equal(t, "Domain Already Exists", err.Error())
+
+	domains, err := partner.GetDomains()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(domains))
+
+	status, err := partner.GetDomainStatus(domain)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, status.DelegationStatus)
+
+	dnssec, err := partner.GetDomainDnssec(domain)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(dnssec.DsRecords))
+	assert.Equal(t, false, dnssec.NextRollDate.IsZero())
+
+	assert.Equal(t, nil, partner.DeleteDomain(domain))
+	_, err = partner.GetDomainStatus(domain)
+	assert.Equal(t, true, errors.Is(err, netki.ErrNotFound))
+
+	assert.Equal(t, nil, partner.DeletePartner(created))
+	partners, _ = partner.GetPartners()
+	assert.Equal(t, 0, len(partners))
+}
+
+func TestWalletNameLifecycle(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddDomain("domain.com")
+	partner := server.Partner()
+
+	wn := partner.CreateNewWalletName(netki.Domain{DomainName: "domain.com"}, "wallet", []netki.Wallet{{Currency: "btc", WalletAddress: testAddress}}, "ext1")
+	assert.Equal(t, nil, wn.Save(partner))
+	assert.NotEqual(t, "", wn.Id)
+
+	wn.SetCurrencyAddress("dgc", "D59EzT12dqCapmcUBNzXhjgWZvruJ175AZ")
+	assert.Equal(t, nil, wn.Save(partner))
+	stored := server.WalletNames("domain.com")
+	assert.Equal(t, 1, len(stored))
+	assert.Equal(t, 2, len(stored[0].Wallets))
+
+	address, err := server.Resolver().Lookup("wallet.domain.com", "dgc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "D59EzT12dqCapmcUBNzXhjgWZvruJ175AZ", address)
+	_, err = server.Resolver().Lookup("wallet.domain.com", "ltc")
+	assert.Equal(t, true, errors.Is(err, netki.ErrNotFound))
+
+	duplicate := partner.CreateNewWalletName(netki.Domain{DomainName: "domain.com"}, "wallet", []netki.Wallet{{Currency: "btc", WalletAddress: testAddress}}, "")
+	err = duplicate.Save(partner)
+	var apiErr *netki.APIError
+	assert.Equal(t, true, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, []string{"Wallet Name wallet.domain.com Already Exists"}, apiErr.FailureMessages())
+
+	walletNames, err := partner.GetWalletNames(netki.Domain{DomainName: "domain.com"}, "ext1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(walletNames))
+	assert.Equal(t, wn.Id, walletNames[0].Id)
+
+	assert.Equal(t, nil, wn.Delete(partner))
+	assert.Equal(t, 0, len(server.WalletNames("")))
+	err = wn.Delete(partner)
+	assert.Equal(t, true, errors.Is(err, netki.ErrValidation))
+}
+
+func TestBatchAndPagination(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddDomain("domain.com")
+	partner := server.Partner()
+	partner.MaxBatchSize = 2
+
+	walletNames := make([]netki.WalletName, 0)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		walletNames = append(walletNames, netki.WalletName{DomainName: "domain.com", Name: name, Wallets: []netki.Wallet{{Currency: "btc", WalletAddress: testAddress}}})
+	}
+	assert.Equal(t, nil, partner.SaveWalletNames(walletNames))
+	for _, wn := range walletNames {
+		assert.NotEqual(t, "", wn.Id)
+	}
+
+	page, err := partner.GetWalletNamesPage(netki.WalletNamesQuery{DomainName: "domain.com", PageSize: 2, Offset: 2})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 5, page.TotalCount)
+	assert.Equal(t, "c", page.WalletNames[0].Name)
+	assert.Equal(t, true, page.HasMore)
+
+	// Deleting the same wallet name twice in one request fails as a whole
+	err = partner.DeleteWalletNames([]netki.WalletName{walletNames[0], walletNames[0]})
+	batchErr := err.(*netki.BatchError)
+	assert.Equal(t, 2, len(batchErr.Failures))
+	assert.Equal(t, true, errors.Is(batchErr.Failures[0].Err, netki.ErrValidation))
+	assert.Equal(t, 5, len(server.WalletNames("")))
+
+	assert.Equal(t, nil, partner.DeleteWalletNames(walletNames))
+	assert.Equal(t, 0, len(server.WalletNames("")))
+}
+
+func TestUnauthorized(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	partner := netki.NewNetkiPartner("someone", "wrong-key", server.URL)
+	_, err := partner.GetDomains()
+	assert.Equal(t, true, errors.Is(err, netki.ErrUnauthorized))
+}
+
+func TestInjectFault(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	partner := server.Partner()
+
+	server.InjectFault(Fault{Method: "GET", Path: "/api/domain", StatusCode: http.StatusServiceUnavailable, Times: 1})
+	_, err := partner.GetDomains()
+	assert.Equal(t, true, errors.Is(err, netki.ErrServer))
+	_, err = partner.GetDomains()
+	assert.Equal(t, nil, err)
+
+	server.InjectFault(Fault{Path: "/api/domain", Body: `{"success": tru`})
+	_, err = partner.GetDomains()
+	assert.NotEqual(t, nil, err)
+	server.ClearFaults()
+
+	server.InjectFault(Fault{Path: "/api/domain", Drop: true})
+	_, err = partner.GetDomains()
+	assert.Equal(t, true, errors.Is(err, netki.ErrTransport))
+	server.ClearFaults()
+
+	// Retries ride out faults that clear up
+	server.InjectFault(Fault{Path: "/api/domain", StatusCode: http.StatusTooManyRequests, Times: 2})
+	policy := netki.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	partner.Requester = &netki.NetkiRequester{RetryPolicy: policy}
+	before := len(server.Requests())
+	_, err = partner.GetDomains()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(server.Requests())-before)
+}
+
+func TestInjectFaultFailures(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.AddDomain("domain.com")
+	partner := server.Partner()
+
+	server.InjectFault(Fault{Method: "POST", Path: "/v1/partner/walletname", StatusCode: http.StatusBadRequest, Message: "Invalid Wallet Names", Failures: []netki.FailurePayload{{Name: "b", Message: "bad address"}}})
+	walletNames := []netki.WalletName{
+		{DomainName: "domain.com", Name: "a", Wallets: []netki.Wallet{{Currency: "btc", WalletAddress: testAddress}}},
+		{DomainName: "domain.com", Name: "b", Wallets: []netki.Wallet{{Currency: "btc", WalletAddress: testAddress}}},
+	}
+	err := partner.SaveWalletNames(walletNames)
+	batchErr := err.(*netki.BatchError)
+	assert.Equal(t, 2, len(batchErr.Failures))
+	assert.Equal(t, "Invalid Wallet Names [FAILURES: bad address]", batchErr.Failures[1].Err.Error())
+}
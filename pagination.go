@@ -0,0 +1,421 @@
+package netki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// WalletNamesQuery selects wallet names and the page of them to fetch
+type WalletNamesQuery struct {
+	DomainName string
+	ExternalId string
+
+	// PageSize is the number of wallet names per request, sent as limit.
+	// Zero fetches everything in a single response.
+	PageSize int
+
+	// Offset is the index of the first wallet name to fetch
+	Offset int
+}
+
+func (q WalletNamesQuery) uri() string {
+	extraArgs := make([]string, 0)
+	if q.PageSize > 0 {
+		extraArgs = append(extraArgs, "limit="+strconv.Itoa(q.PageSize))
+	}
+	if q.Offset > 0 {
+		extraArgs = append(extraArgs, "offset="+strconv.Itoa(q.Offset))
+	}
+	return walletNamesUri(q.DomainName, q.ExternalId, extraArgs...)
+}
+
+// hasMore reports whether another page follows one that returned received
+// wallet names out of total
+func (q WalletNamesQuery) hasMore(received int, total int) bool {
+	return q.PageSize > 0 && received >= q.PageSize && q.Offset+received < total
+}
+
+// WalletNamesPage is a single page of wallet names
+type WalletNamesPage struct {
+	WalletNames []WalletName
+
+	// TotalCount is the number of wallet names matching the query across all pages
+	TotalCount int
+
+	Offset int
+
+	// NextOffset is the Offset of the following page, valid when HasMore is true
+	NextOffset int
+	HasMore    bool
+}
+
+func (n NetkiPartner) GetWalletNamesPage(query WalletNamesQuery) (WalletNamesPage, error) {
+	return n.GetWalletNamesPageContext(context.Background(), query)
+}
+
+func (n NetkiPartner) GetWalletNamesPageContext(ctx context.Context, query WalletNamesQuery) (WalletNamesPage, error) {
+	page := WalletNamesPage{WalletNames: make([]WalletName, 0), Offset: query.Offset}
+
+	walletNamesResp := WalletNamesResponse{}
+	if err := requestInto(ctx, &n, query.uri(), "GET", "", &walletNamesResp); err != nil {
+		return page, err
+	}
+
+	page.TotalCount = walletNamesResp.WalletNameCount
+	if page.TotalCount == 0 {
+		return page, nil
+	}
+
+	for _, wn := range walletNamesResp.WalletNames {
+		page.WalletNames = append(page.WalletNames, wn.walletName())
+	}
+	page.HasMore = query.hasMore(len(page.WalletNames), page.TotalCount)
+	if page.HasMore {
+		page.NextOffset = query.Offset + len(page.WalletNames)
+	}
+	return page, nil
+}
+
+// WalletNameIterator walks every wallet name matching a query, fetching pages
+// lazily and decoding each response one wallet name at a time. A response
+// that lists wallet_names before wallet_name_count is decoded in full before
+// its first wallet name is returned, since a zero count discards the page, so
+// memory per page is then bounded by PageSize rather than a single wallet name.
+//
+//	it := partner.IterateWalletNames(ctx, netki.WalletNamesQuery{DomainName: "domain.com", PageSize: 500})
+//	defer it.Close()
+//	for it.Next() {
+//		wn := it.WalletName()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type WalletNameIterator struct {
+	ctx     context.Context
+	partner NetkiPartner
+	query   WalletNamesQuery
+
+	// The current page is either streamed or, when the Requester cannot
+	// stream, already decoded into buffered
+	pageOpen bool
+	stream   *walletNameStream
+	buffered []WalletNamePayload
+	received int
+	total    int
+
+	current WalletName
+	done    bool
+	err     error
+}
+
+func (n NetkiPartner) IterateWalletNames(ctx context.Context, query WalletNamesQuery) *WalletNameIterator {
+	return &WalletNameIterator{ctx: ctx, partner: n, query: query}
+}
+
+// Next advances to the next wallet name, returning false when there are no
+// more or an error occurred
+func (it *WalletNameIterator) Next() bool {
+	for !it.done && it.err == nil {
+		if !it.pageOpen {
+			if err := it.fetch(); err != nil {
+				it.fail(err)
+				return false
+			}
+		}
+
+		payload, ok, err := it.nextPayload()
+		if err != nil {
+			it.fail(err)
+			return false
+		}
+		if ok {
+			it.current = payload.walletName()
+			it.received++
+			return true
+		}
+
+		// Current page is exhausted, move on to the next one if there is one
+		it.closePage()
+		if !it.query.hasMore(it.received, it.total) {
+			it.done = true
+			return false
+		}
+		it.query.Offset += it.received
+		it.received = 0
+	}
+	return false
+}
+
+// WalletName returns the wallet name Next advanced to
+func (it *WalletNameIterator) WalletName() WalletName {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *WalletNameIterator) Err() error {
+	return it.err
+}
+
+// TotalCount returns the wallet_name_count reported by the most recent page
+func (it *WalletNameIterator) TotalCount() int {
+	return it.total
+}
+
+// Close releases the response being read; it is safe to call more than once
+func (it *WalletNameIterator) Close() error {
+	it.done = true
+	return it.closePage()
+}
+
+func (it *WalletNameIterator) fail(err error) {
+	it.err = err
+	it.closePage()
+}
+
+func (it *WalletNameIterator) fetch() error {
+	uri := it.query.uri()
+	it.pageOpen = true
+
+	if requester, ok := it.partner.Requester.(NetkiStreamRequest); ok {
+		body, err := requester.StreamRequestContext(it.ctx, &it.partner, uri, "GET", "")
+		if err != nil {
+			return err
+		}
+		it.stream = newWalletNameStream(body, uri, it.partner.StrictDecoding)
+		return it.stream.open()
+	}
+
+	walletNamesResp := WalletNamesResponse{}
+	if err := requestInto(it.ctx, &it.partner, uri, "GET", "", &walletNamesResp); err != nil {
+		return err
+	}
+	it.total = walletNamesResp.WalletNameCount
+	it.buffered = walletNamesResp.WalletNames
+	if it.total == 0 {
+		it.buffered = nil
+	}
+	return nil
+}
+
+func (it *WalletNameIterator) nextPayload() (WalletNamePayload, bool, error) {
+	if it.stream != nil {
+		payload, ok, err := it.stream.next()
+		if it.stream.sawCount {
+			it.total = it.stream.count
+		}
+		return payload, ok, err
+	}
+	if len(it.buffered) == 0 {
+		return WalletNamePayload{}, false, nil
+	}
+	payload := it.buffered[0]
+	it.buffered = it.buffered[1:]
+	return payload, true, nil
+}
+
+func (it *WalletNameIterator) closePage() error {
+	it.pageOpen = false
+	it.buffered = nil
+	if it.stream == nil {
+		return nil
+	}
+	err := it.stream.body.Close()
+	it.stream = nil
+	return err
+}
+
+// walletNameStream incrementally decodes a wallet_names response body
+type walletNameStream struct {
+	body   io.ReadCloser
+	dec    *json.Decoder
+	uri    string
+	strict bool
+
+	status     ResponseStatus
+	sawSuccess bool
+	count      int
+	sawCount   bool
+	inArray    bool
+
+	// buffered holds the wallet names of an array that came before
+	// wallet_name_count, until the count says whether to use them
+	buffered []WalletNamePayload
+}
+
+func newWalletNameStream(body io.ReadCloser, uri string, strict bool) *walletNameStream {
+	return &walletNameStream{body: body, dec: json.NewDecoder(body), uri: uri, strict: strict}
+}
+
+// open reads up to the start of the wallet_names array
+func (s *walletNameStream) open() error {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return s.dataError(err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return s.dataError(fmt.Errorf("expected JSON object"))
+	}
+	return s.readFields()
+}
+
+// next decodes the next wallet name, returning false once the response is exhausted
+func (s *walletNameStream) next() (WalletNamePayload, bool, error) {
+	payload := WalletNamePayload{}
+	if len(s.buffered) > 0 {
+		payload = s.buffered[0]
+		s.buffered = s.buffered[1:]
+		return payload, true, nil
+	}
+	if s.inArray {
+		if s.dec.More() {
+			var raw json.RawMessage
+			if err := s.dec.Decode(&raw); err != nil {
+				return payload, false, s.dataError(err)
+			}
+			if err := decodeJSON(raw, &payload, s.strict); err != nil {
+				return payload, false, err
+			}
+			return payload, true, nil
+		}
+
+		// Consume the closing ']' and whatever follows the array
+		if _, err := s.dec.Token(); err != nil {
+			return payload, false, s.dataError(err)
+		}
+		s.inArray = false
+		if err := s.readFields(); err != nil {
+			return payload, false, err
+		}
+	}
+	return payload, false, nil
+}
+
+// readFields consumes object members until the wallet_names array opens or the object ends
+func (s *walletNameStream) readFields() error {
+	for s.dec.More() {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return s.dataError(err)
+		}
+		key, _ := tok.(string)
+
+		if key == "wallet_names" {
+			if s.sawSuccess && !s.status.Success {
+				return s.apiError()
+			}
+			tok, err := s.dec.Token()
+			if err != nil {
+				return s.dataError(err)
+			}
+			if tok == nil {
+				continue
+			}
+			if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+				return &SchemaError{Payload: "WalletNamesResponse", Err: fmt.Errorf("wallet_names is not an array")}
+			}
+			if s.sawCount && s.count == 0 {
+				if err := s.skipArray(); err != nil {
+					return err
+				}
+				continue
+			}
+			if !s.sawCount {
+				if err := s.bufferArray(); err != nil {
+					return err
+				}
+				continue
+			}
+			s.inArray = true
+			return nil
+		}
+
+		var raw json.RawMessage
+		if err := s.dec.Decode(&raw); err != nil {
+			return s.dataError(err)
+		}
+		switch key {
+		case "wallet_name_count":
+			if err := json.Unmarshal(raw, &s.count); err != nil {
+				return &SchemaError{Payload: "WalletNamesResponse", Err: err}
+			}
+			s.sawCount = true
+		case "success":
+			// Anything but true counts as a failure, like MustBool(false)
+			s.sawSuccess = true
+			json.Unmarshal(raw, &s.status.Success)
+		case "message":
+			json.Unmarshal(raw, &s.status.Message)
+		case "failures":
+			json.Unmarshal(raw, &s.status.Failures)
+		default:
+			if s.strict {
+				return &SchemaError{Payload: "WalletNamesResponse", Unknown: []string{key}}
+			}
+		}
+	}
+
+	// Consume the closing '}'
+	if _, err := s.dec.Token(); err != nil {
+		return s.dataError(err)
+	}
+	if !s.status.Success {
+		return s.apiError()
+	}
+	if s.strict && !s.sawCount {
+		return &SchemaError{Payload: "WalletNamesResponse", Missing: []string{"wallet_name_count"}}
+	}
+	if s.count == 0 {
+		// Like GetWalletNamesPage, a zero count means no wallet names
+		s.buffered = nil
+	}
+	return nil
+}
+
+// bufferArray decodes the rest of the wallet_names array into buffered. It
+// holds a whole page, at most PageSize wallet names.
+func (s *walletNameStream) bufferArray() error {
+	for s.dec.More() {
+		var raw json.RawMessage
+		if err := s.dec.Decode(&raw); err != nil {
+			return s.dataError(err)
+		}
+		payload := WalletNamePayload{}
+		if err := decodeJSON(raw, &payload, s.strict); err != nil {
+			return err
+		}
+		s.buffered = append(s.buffered, payload)
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return s.dataError(err)
+	}
+	return nil
+}
+
+func (s *walletNameStream) skipArray() error {
+	for s.dec.More() {
+		var raw json.RawMessage
+		if err := s.dec.Decode(&raw); err != nil {
+			return s.dataError(err)
+		}
+	}
+	if _, err := s.dec.Token(); err != nil {
+		return s.dataError(err)
+	}
+	return nil
+}
+
+func (s *walletNameStream) apiError() error {
+	apiErr := &APIError{StatusCode: http.StatusOK, Method: "GET", URI: s.uri, Message: s.status.Message, Failures: make([]Failure, 0)}
+	if s.status.Failures != nil {
+		apiErr.hasFailures = true
+		apiErr.Failures = failuresFromPayload(s.status.Failures)
+	}
+	return apiErr
+}
+
+func (s *walletNameStream) dataError(err error) error {
+	return &NetkiError{fmt.Sprintf("Error Retrieving JSON Data: %s", err), make([]string, 0)}
+}
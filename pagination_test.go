@@ -0,0 +1,265 @@
+package netki
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bmizerany/assert"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Setup a server paging through total wallet names with limit/offset
+func setupPagingHttp(total int) (*httptest.Server, *[]string) {
+	calledUris := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calledUris = append(calledUris, r.URL.String())
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		if limit == 0 {
+			limit = total
+		}
+
+		items := make([]string, 0)
+		for i := offset; i < total && i < offset+limit; i++ {
+			items = append(items, fmt.Sprintf(`{"id":"id%d","domain_name":"domain.com","name":"name%d","external_id":"","wallets":[{"currency":"btc","wallet_address":"addr%d"}]}`, i, i, i))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"success":true,"wallet_name_count":%d,"wallet_names":[%s]}`, total, strings.Join(items, ","))
+	}))
+	return server, &calledUris
+}
+
+func TestGetWalletNamesPage(t *testing.T) {
+	mockRequester := getMockRequester(`{"wallet_name_count":5,"wallet_names":[{"id":"id2","name":"name2"},{"id":"id3","name":"name3"}]}`, nil)
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	page, err := mockPartner.GetWalletNamesPage(WalletNamesQuery{DomainName: "domain.com", PageSize: 2, Offset: 2})
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "/v1/partner/walletname?domain_name=domain.com&limit=2&offset=2", mockRequester.calledUri)
+	assert.Equal(t, "GET", mockRequester.calledMethod)
+	assert.Equal(t, 2, len(page.WalletNames))
+	assert.Equal(t, "id2", page.WalletNames[0].Id)
+	assert.Equal(t, 5, page.TotalCount)
+	assert.Equal(t, 2, page.Offset)
+	assert.Equal(t, true, page.HasMore)
+	assert.Equal(t, 4, page.NextOffset)
+}
+
+func TestGetWalletNamesPageLast(t *testing.T) {
+	mockRequester := getMockRequester(`{"wallet_name_count":5,"wallet_names":[{"id":"id4","name":"name4"}]}`, nil)
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	page, err := mockPartner.GetWalletNamesPage(WalletNamesQuery{DomainName: "domain.com", PageSize: 2, Offset: 4})
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(page.WalletNames))
+	assert.Equal(t, false, page.HasMore)
+	assert.Equal(t, 0, page.NextOffset)
+}
+
+func TestGetWalletNamesPageError(t *testing.T) {
+	mockRequester := getMockRequester("", &NetkiError{"Error Message", make([]string, 0)})
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	page, err := mockPartner.GetWalletNamesPage(WalletNamesQuery{ExternalId: "ext1"})
+
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, "/v1/partner/walletname?external_id=ext1", mockRequester.calledUri)
+	assert.Equal(t, 0, len(page.WalletNames))
+}
+
+func TestIterateWalletNamesStreaming(t *testing.T) {
+	server, calledUris := setupPagingHttp(5)
+	defer server.Close()
+
+	partner := NewNetkiPartner("partner_id", "api_key", server.URL)
+	it := partner.IterateWalletNames(context.Background(), WalletNamesQuery{DomainName: "domain.com", PageSize: 2})
+	defer it.Close()
+
+	names := make([]string, 0)
+	for it.Next() {
+		names = append(names, it.WalletName().Name)
+		assert.Equal(t, "domain.com", it.WalletName().DomainName)
+	}
+
+	assert.Equal(t, nil, it.Err())
+	assert.Equal(t, []string{"name0", "name1", "name2", "name3", "name4"}, names)
+	assert.Equal(t, 5, it.TotalCount())
+	assert.Equal(t, []string{
+		"/v1/partner/walletname?domain_name=domain.com&limit=2",
+		"/v1/partner/walletname?domain_name=domain.com&limit=2&offset=2",
+		"/v1/partner/walletname?domain_name=domain.com&limit=2&offset=4",
+	}, *calledUris)
+}
+
+func TestIterateWalletNamesSinglePage(t *testing.T) {
+	server, calledUris := setupPagingHttp(3)
+	defer server.Close()
+
+	partner := NewNetkiPartner("partner_id", "api_key", server.URL)
+	it := partner.IterateWalletNames(context.Background(), WalletNamesQuery{DomainName: "domain.com"})
+
+	count := 0
+	for it.Next() {
+		count++
+	}
+
+	assert.Equal(t, nil, it.Err())
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 1, len(*calledUris))
+}
+
+func TestIterateWalletNamesExactPages(t *testing.T) {
+	server, calledUris := setupPagingHttp(4)
+	defer server.Close()
+
+	partner := NewNetkiPartner("partner_id", "api_key", server.URL)
+	it := partner.IterateWalletNames(context.Background(), WalletNamesQuery{PageSize: 2})
+
+	count := 0
+	for it.Next() {
+		count++
+	}
+
+	assert.Equal(t, nil, it.Err())
+	assert.Equal(t, 4, count)
+	assert.Equal(t, 2, len(*calledUris))
+}
+
+func TestIterateWalletNamesBuffered(t *testing.T) {
+	mockRequester := getMockRequester(`{"wallet_name_count":2,"wallet_names":[{"id":"id1","name":"name1"},{"id":"id2","name":"name2"}]}`, nil)
+	mockPartner := &NetkiPartner{Requester: mockRequester}
+
+	it := mockPartner.IterateWalletNames(context.Background(), WalletNamesQuery{DomainName: "domain.com"})
+
+	ids := make([]string, 0)
+	for it.Next() {
+		ids = append(ids, it.WalletName().Id)
+	}
+
+	assert.Equal(t, nil, it.Err())
+	assert.Equal(t, []string{"id1", "id2"}, ids)
+	assert.Equal(t, "/v1/partner/walletname?domain_name=domain.com", mockRequester.calledUri)
+}
+
+func TestIterateWalletNamesZeroCount(t *testing.T) {
+	server, client := setupHttp(200, "application/json", `{"success":true,"wallet_name_count":0,"wallet_names":[{"id":"id1"}]}`)
+	defer server.Close()
+
+	partner := &NetkiPartner{Requester: &NetkiRequester{HTTPClient: client}, ApiUrl: "http://domain.com"}
+	it := partner.IterateWalletNames(context.Background(), WalletNamesQuery{})
+
+	assert.Equal(t, false, it.Next())
+	assert.Equal(t, nil, it.Err())
+}
+
+func TestIterateWalletNamesZeroCountAfterArray(t *testing.T) {
+	body := `{"success":true,"wallet_names":[{"id":"id1"}],"wallet_name_count":0}`
+	server, client := setupHttp(200, "application/json", body)
+	defer server.Close()
+
+	// The streaming and buffered paths agree that a zero count means no wallet names
+	partner := &NetkiPartner{Requester: &NetkiRequester{HTTPClient: client}, ApiUrl: "http://domain.com"}
+	it := partner.IterateWalletNames(context.Background(), WalletNamesQuery{})
+	assert.Equal(t, false, it.Next())
+	assert.Equal(t, nil, it.Err())
+
+	wns, err := (&NetkiPartner{Requester: getMockRequester(body, nil)}).GetWalletNames(Domain{}, "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(wns))
+}
+
+func TestIterateWalletNamesCountAfterArray(t *testing.T) {
+	total := 5
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		items := make([]string, 0)
+		for i := offset; i < total && i < offset+limit; i++ {
+			items = append(items, fmt.Sprintf(`{"id":"id%d","name":"name%d"}`, i, i))
+		}
+		fmt.Fprintf(w, `{"wallet_names":[%s],"wallet_name_count":%d,"success":true}`, strings.Join(items, ","), total)
+	}))
+	defer server.Close()
+
+	partner := NewNetkiPartner("partner_id", "api_key", server.URL)
+	it := partner.IterateWalletNames(context.Background(), WalletNamesQuery{DomainName: "domain.com", PageSize: 2})
+	defer it.Close()
+
+	names := make([]string, 0)
+	for it.Next() {
+		names = append(names, it.WalletName().Name)
+		assert.Equal(t, true, len(it.stream.buffered) < 2)
+	}
+
+	assert.Equal(t, nil, it.Err())
+	assert.Equal(t, []string{"name0", "name1", "name2", "name3", "name4"}, names)
+	assert.Equal(t, 5, it.TotalCount())
+}
+
+func TestIterateWalletNamesSuccessFalse(t *testing.T) {
+	server, client := setupHttp(200, "application/json", `{"success":false,"message":"Error Message","failures":[{"message":"fail1"}],"wallet_names":[]}`)
+	defer server.Close()
+
+	partner := &NetkiPartner{Requester: &NetkiRequester{HTTPClient: client}, ApiUrl: "http://domain.com"}
+	it := partner.IterateWalletNames(context.Background(), WalletNamesQuery{})
+
+	assert.Equal(t, false, it.Next())
+	assert.Equal(t, "Error Message [FAILURES: fail1]", it.Err().Error())
+}
+
+func TestIterateWalletNamesSuccessAfterArray(t *testing.T) {
+	server, client := setupHttp(200, "application/json", `{"wallet_names":[{"id":"id1"}],"wallet_name_count":1,"success":true}`)
+	defer server.Close()
+
+	partner := &NetkiPartner{Requester: &NetkiRequester{HTTPClient: client}, ApiUrl: "http://domain.com"}
+	it := partner.IterateWalletNames(context.Background(), WalletNamesQuery{})
+
+	assert.Equal(t, true, it.Next())
+	assert.Equal(t, "id1", it.WalletName().Id)
+	assert.Equal(t, false, it.Next())
+	assert.Equal(t, nil, it.Err())
+	assert.Equal(t, 1, it.TotalCount())
+}
+
+func TestIterateWalletNamesHTTPError(t *testing.T) {
+	server, client := setupHttp(404, "application/json", `{"success":false,"message":"No Such Domain"}`)
+	defer server.Close()
+
+	partner := &NetkiPartner{Requester: &NetkiRequester{HTTPClient: client}, ApiUrl: "http://domain.com"}
+	it := partner.IterateWalletNames(context.Background(), WalletNamesQuery{DomainName: "domain.com"})
+
+	assert.Equal(t, false, it.Next())
+	assert.Equal(t, true, errors.Is(it.Err(), ErrNotFound))
+	assert.Equal(t, "No Such Domain", it.Err().Error())
+}
+
+func TestIterateWalletNamesStrict(t *testing.T) {
+	server, client := setupHttp(200, "application/json", `{"success":true,"wallet_name_count":1,"wallet_names":[{"id":"id1","name":"name1","bogus":true}]}`)
+	defer server.Close()
+
+	partner := &NetkiPartner{Requester: &NetkiRequester{HTTPClient: client}, ApiUrl: "http://domain.com", StrictDecoding: true}
+	it := partner.IterateWalletNames(context.Background(), WalletNamesQuery{})
+
+	assert.Equal(t, false, it.Next())
+	assert.Equal(t, true, errors.Is(it.Err(), ErrSchema))
+}
+
+func TestIterateWalletNamesCloseEarly(t *testing.T) {
+	server, calledUris := setupPagingHttp(5)
+	defer server.Close()
+
+	partner := NewNetkiPartner("partner_id", "api_key", server.URL)
+	it := partner.IterateWalletNames(context.Background(), WalletNamesQuery{PageSize: 2})
+
+	assert.Equal(t, true, it.Next())
+	assert.Equal(t, nil, it.Close())
+	assert.Equal(t, false, it.Next())
+	assert.Equal(t, nil, it.Err())
+	assert.Equal(t, 1, len(*calledUris))
+}
@@ -0,0 +1,196 @@
+package netki
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var paymentAmount = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// PaymentURI is a BIP21 style payment URI such as
+// bitcoin:1btcaddress?amount=0.5&label=Shop&message=Order%201
+type PaymentURI struct {
+	Currency string
+	Address  string
+
+	// Amount is a decimal amount in whole coins, e.g. "0.25"
+	Amount  string
+	Label   string
+	Message string
+
+	// Params holds any other parameters, including req- parameters
+	Params url.Values
+}
+
+// NewPaymentURI creates a payment URI for address in currency
+func NewPaymentURI(currency string, address string) (*PaymentURI, error) {
+	currency = NormalizeCurrency(currency)
+	if paymentScheme(currency) == "" {
+		return nil, &NetkiError{fmt.Sprintf("Unsupported Payment URI Currency: %s", currency), make([]string, 0)}
+	}
+	if address == "" {
+		return nil, &NetkiError{"Payment URI Requires an Address", make([]string, 0)}
+	}
+	return &PaymentURI{Currency: currency, Address: address}, nil
+}
+
+// ParsePaymentURI parses a BIP21 style payment URI. As BIP21 requires, URIs
+// with req- parameters are rejected, as none are understood.
+func ParsePaymentURI(uri string) (*PaymentURI, error) {
+	uri = strings.TrimSpace(uri)
+	colon := strings.Index(uri, ":")
+	if colon < 0 {
+		return nil, &NetkiError{"Invalid Payment URI: missing scheme", make([]string, 0)}
+	}
+	scheme := strings.ToLower(uri[:colon])
+	currency := paymentCurrency(scheme)
+	if currency == "" {
+		return nil, &NetkiError{fmt.Sprintf("Unsupported Payment URI Scheme: %s", scheme), make([]string, 0)}
+	}
+
+	rest := strings.TrimPrefix(uri[colon+1:], "//")
+	address, query := rest, ""
+	if question := strings.Index(rest, "?"); question >= 0 {
+		address, query = rest[:question], rest[question+1:]
+	}
+	address, err := url.PathUnescape(address)
+	if err != nil || address == "" {
+		return nil, &NetkiError{"Invalid Payment URI: missing address", make([]string, 0)}
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, &NetkiError{fmt.Sprintf("Invalid Payment URI: %s", err), make([]string, 0)}
+	}
+	p := &PaymentURI{Currency: currency, Address: address, Params: url.Values{}}
+	for key, values := range params {
+		switch key {
+		case "amount":
+			p.Amount = values[0]
+			if !paymentAmount.MatchString(p.Amount) {
+				return nil, &NetkiError{fmt.Sprintf("Invalid Payment URI: bad amount %q", p.Amount), make([]string, 0)}
+			}
+		case "label":
+			p.Label = values[0]
+		case "message":
+			p.Message = values[0]
+		default:
+			if strings.HasPrefix(key, "req-") {
+				return nil, &NetkiError{fmt.Sprintf("Invalid Payment URI: unsupported required parameter %s", key), make([]string, 0)}
+			}
+			p.Params[key] = values
+		}
+	}
+	return p, nil
+}
+
+// String renders the URI, percent-encoding parameter values as RFC 3986 requires
+func (p PaymentURI) String() string {
+	var buffer bytes.Buffer
+	buffer.WriteString(paymentScheme(p.Currency))
+	buffer.WriteString(":")
+	buffer.WriteString(p.Address)
+
+	separator := "?"
+	param := func(key string, value string) {
+		buffer.WriteString(separator)
+		buffer.WriteString(uriEscape(key))
+		buffer.WriteString("=")
+		buffer.WriteString(uriEscape(value))
+		separator = "&"
+	}
+	if p.Amount != "" {
+		param("amount", p.Amount)
+	}
+	if p.Label != "" {
+		param("label", p.Label)
+	}
+	if p.Message != "" {
+		param("message", p.Message)
+	}
+
+	keys := make([]string, 0)
+	for key := range p.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range p.Params[key] {
+			param(key, value)
+		}
+	}
+	return buffer.String()
+}
+
+// Validate checks the currency is supported and the amount is well formed
+func (p PaymentURI) Validate() error {
+	if paymentScheme(p.Currency) == "" {
+		return &NetkiError{fmt.Sprintf("Unsupported Payment URI Currency: %s", p.Currency), make([]string, 0)}
+	}
+	if p.Address == "" {
+		return &NetkiError{"Payment URI Requires an Address", make([]string, 0)}
+	}
+	if p.Amount != "" && !paymentAmount.MatchString(p.Amount) {
+		return &NetkiError{fmt.Sprintf("Invalid Payment URI: bad amount %q", p.Amount), make([]string, 0)}
+	}
+	return nil
+}
+
+// PaymentURI builds a payment URI for the wallet
+func (w Wallet) PaymentURI() (*PaymentURI, error) {
+	return NewPaymentURI(w.Currency, w.WalletAddress)
+}
+
+// PaymentURI builds a payment URI for the Wallet Name's address in currency,
+// labelled with the Wallet Name
+func (w WalletName) PaymentURI(currency string) (*PaymentURI, error) {
+	address := w.GetAddress(currency)
+	if address == "" {
+		return nil, &NetkiError{fmt.Sprintf("Wallet Name Has No %s Address", currency), make([]string, 0)}
+	}
+	p, err := NewPaymentURI(currency, address)
+	if err != nil {
+		return nil, err
+	}
+	if w.Name != "" && w.DomainName != "" {
+		p.Label = w.Name + "." + w.DomainName
+	}
+	return p, nil
+}
+
+// PaymentURI builds a payment URI for the resolved address, labelled with the Wallet Name
+func (r LookupResult) PaymentURI() (*PaymentURI, error) {
+	p, err := NewPaymentURI(r.Currency, r.Address)
+	if err != nil {
+		return nil, err
+	}
+	p.Label = r.Name
+	return p, nil
+}
+
+// paymentScheme returns the URI scheme of a registered currency, empty when
+// it has none
+func paymentScheme(currency string) string {
+	c, _ := LookupCurrency(currency)
+	return c.URIScheme
+}
+
+// paymentCurrency maps a URI scheme back to the first registered currency, in
+// code order, that uses it
+func paymentCurrency(scheme string) string {
+	for _, c := range RegisteredCurrencies() {
+		if c.URIScheme != "" && c.URIScheme == scheme {
+			return c.Code
+		}
+	}
+	return ""
+}
+
+// uriEscape percent-encodes everything but RFC 3986 unreserved characters
+func uriEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
@@ -0,0 +1,108 @@
+package netki
+
+import (
+	"github.com/bmizerany/assert"
+	"net/url"
+	"testing"
+)
+
+func TestPaymentURIString(t *testing.T) {
+	p, err := NewPaymentURI("BTC", "1btcaddress")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "bitcoin:1btcaddress", p.String())
+
+	p.Amount = "0.25"
+	p.Label = "Coffee Shop"
+	p.Message = "Order #42 & tip"
+	p.Params = url.Values{"r": {"https://merchant.example/pay?id=1"}}
+	assert.Equal(t, "bitcoin:1btcaddress?amount=0.25&label=Coffee%20Shop&message=Order%20%2342%20%26%20tip&r=https%3A%2F%2Fmerchant.example%2Fpay%3Fid%3D1", p.String())
+
+	p, _ = NewPaymentURI("dgc", "D548376529834756928376523")
+	assert.Equal(t, "dogecoin:D548376529834756928376523", p.String())
+	p, _ = NewPaymentURI("ltc", "Lltcaddress")
+	assert.Equal(t, "litecoin:Lltcaddress", p.String())
+
+	_, err = NewPaymentURI("xyz", "address")
+	assert.Equal(t, "Unsupported Payment URI Currency: xyz", err.Error())
+	_, err = NewPaymentURI("btc", "")
+	assert.Equal(t, "Payment URI Requires an Address", err.Error())
+}
+
+func TestParsePaymentURI(t *testing.T) {
+	p, err := ParsePaymentURI("bitcoin:1btcaddress?amount=0.25&label=Coffee%20Shop&message=Order+42&r=https%3A%2F%2Fmerchant.example")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "btc", p.Currency)
+	assert.Equal(t, "1btcaddress", p.Address)
+	assert.Equal(t, "0.25", p.Amount)
+	assert.Equal(t, "Coffee Shop", p.Label)
+	assert.Equal(t, "Order 42", p.Message)
+	assert.Equal(t, "https://merchant.example", p.Params.Get("r"))
+
+	p, err = ParsePaymentURI("DOGECOIN://Ddogeaddress")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "dgc", p.Currency)
+	assert.Equal(t, "Ddogeaddress", p.Address)
+
+	// Round trip
+	original := PaymentURI{Currency: "ltc", Address: "Lltcaddress", Amount: "1", Label: "a/b c", Message: "100%"}
+	parsed, err := ParsePaymentURI(original.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, original.Label, parsed.Label)
+	assert.Equal(t, original.Message, parsed.Message)
+	assert.Equal(t, original.Amount, parsed.Amount)
+
+	errors := map[string]string{
+		"1btcaddress":                          "Invalid Payment URI: missing scheme",
+		"ethereum:0xabc":                       "Unsupported Payment URI Scheme: ethereum",
+		"bitcoin:?amount=1":                    "Invalid Payment URI: missing address",
+		"bitcoin:1btcaddress?amount=1,5":       `Invalid Payment URI: bad amount "1,5"`,
+		"bitcoin:1btcaddress?req-somethingnew": "Invalid Payment URI: unsupported required parameter req-somethingnew",
+	}
+	for uri, message := range errors {
+		_, err := ParsePaymentURI(uri)
+		assert.Equal(t, message, err.Error(), uri)
+	}
+}
+
+func TestPaymentURIValidate(t *testing.T) {
+	assert.Equal(t, nil, PaymentURI{Currency: "btc", Address: "1btcaddress", Amount: "0.1"}.Validate())
+	assert.Equal(t, `Invalid Payment URI: bad amount "-1"`, PaymentURI{Currency: "btc", Address: "1btcaddress", Amount: "-1"}.Validate().Error())
+	assert.Equal(t, "Unsupported Payment URI Currency: eth", PaymentURI{Currency: "eth", Address: "0xabc"}.Validate().Error())
+}
+
+func TestPaymentURIRegisteredCurrency(t *testing.T) {
+	RegisterCurrency(Currency{Code: "xpc", Name: "Examplecoin", URIScheme: "examplecoin"})
+	defer func() {
+		currencyRegistryMu.Lock()
+		delete(currencyRegistry, "xpc")
+		currencyRegistryMu.Unlock()
+	}()
+
+	p, err := NewPaymentURI("XPC", "xpcaddress")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "examplecoin:xpcaddress", p.String())
+
+	p, err = ParsePaymentURI("examplecoin:xpcaddress?amount=2")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "xpc", p.Currency)
+	assert.Equal(t, "2", p.Amount)
+}
+
+func TestWalletNamePaymentURI(t *testing.T) {
+	wn := getWalletName()
+	wn.Name = "wallet"
+	p, err := wn.PaymentURI("btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "bitcoin:1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2?label=wallet.domain.com", p.String())
+
+	_, err = wn.PaymentURI("ltc")
+	assert.Equal(t, "Wallet Name Has No ltc Address", err.Error())
+
+	p, err = wn.Wallets[0].PaymentURI()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "bitcoin:1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", p.String())
+
+	p, err = LookupResult{Name: "wallet.domain.com", Currency: "dgc", Address: "Ddogeaddress"}.PaymentURI()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "dogecoin:Ddogeaddress?label=wallet.domain.com", p.String())
+}
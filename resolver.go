@@ -0,0 +1,195 @@
+package netki
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLookupURL is the public wallet lookup API used when Resolver.BaseURL is empty
+const DefaultLookupURL = "https://pubapi.netki.com/api/wallet_lookup"
+
+// DefaultUserAgent is sent by a Resolver without a UserAgent
+const DefaultUserAgent = "netki-go"
+
+// Resolver looks up wallet addresses through the public lookup API
+type Resolver struct {
+	// BaseURL is the lookup endpoint, DefaultLookupURL when empty
+	BaseURL string
+
+	// HTTPClient sends lookups, http.DefaultClient when nil
+	HTTPClient *http.Client
+
+	// UserAgent is sent with every lookup, DefaultUserAgent when empty
+	UserAgent string
+
+	// DNS, when set, resolves Wallet Names from DNS instead of the lookup API
+	DNS *DNSResolver
+
+	// Currencies are tried by LookupAll against the lookup API, which cannot
+	// list the currencies of a name. DefaultLookupCurrencies when empty.
+	Currencies []string
+
+	// Cache, when set, answers repeated lookups from memory
+	Cache *LookupCache
+}
+
+// DefaultLookupCurrencies are tried by LookupAll when Resolver.Currencies is empty
+var DefaultLookupCurrencies = []string{"btc", "ltc", "dgc", "nmc", "tbtc"}
+
+// lookupNotFoundError is a lookup API answer that a name has no address for a currency
+type lookupNotFoundError struct {
+	message string
+}
+
+func (e *lookupNotFoundError) Error() string {
+	return e.message
+}
+
+func (e *lookupNotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// DefaultResolver is used by WalletNameLookup and WalletNameLookupContext
+var DefaultResolver = &Resolver{}
+
+// Lookup resolves the address for a wallet name and currency
+func (r *Resolver) Lookup(name string, currency string) (string, error) {
+	return r.LookupContext(context.Background(), name, currency)
+}
+
+// LookupContext is like Lookup but carries ctx to the HTTP request
+func (r *Resolver) LookupContext(ctx context.Context, name string, currency string) (string, error) {
+	if r.Cache == nil {
+		address, _, err := r.lookup(ctx, name, currency)
+		return address, err
+	}
+
+	if address, ok, err := r.Cache.get(name, currency); ok {
+		return address, err
+	}
+	address, ttl, err := r.lookup(ctx, name, currency)
+	r.Cache.put(name, currency, address, ttl, err)
+	return address, err
+}
+
+// lookup resolves an address along with how long it may be cached, unknownTTL
+// when unknown
+func (r *Resolver) lookup(ctx context.Context, name string, currency string) (string, time.Duration, error) {
+	if r.DNS != nil {
+		result, err := r.DNS.Resolve(ctx, name, currency)
+		if err != nil {
+			return "", 0, err
+		}
+		return result.Address, result.TTL, nil
+	}
+
+	baseUrl := r.BaseURL
+	if baseUrl == "" {
+		baseUrl = DefaultLookupURL
+	}
+	requestUrl := fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(baseUrl, "/"), url.PathEscape(name), url.PathEscape(currency))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", requestUrl, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	userAgent := r.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	client := r.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+
+	lookup := LookupResponse{}
+	if err := json.Unmarshal(body, &lookup); err != nil {
+		return "", 0, err
+	} else if resp.StatusCode == http.StatusNotFound {
+		return "", 0, &lookupNotFoundError{"Could not resolve netki address"}
+	} else if resp.StatusCode != 200 {
+		return "", 0, errors.New("Could not resolve netki address")
+	}
+
+	if lookup.Message != "" {
+		return "", 0, &lookupNotFoundError{lookup.Message}
+	}
+
+	return lookup.WalletAddress, maxAge(resp.Header.Get("Cache-Control")), nil
+}
+
+// maxAge returns the max-age directive of a Cache-Control header, unknownTTL
+// when absent
+func maxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if strings.HasPrefix(directive, "max-age=") {
+			if seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age=")); err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return unknownTTL
+}
+
+// LookupAll resolves every currency/address pair of a wallet name. Currencies
+// the name has no address for are left out; a name with none fails with a
+// LookupError matching ErrNotFound.
+func (r *Resolver) LookupAll(name string) ([]Wallet, error) {
+	return r.LookupAllContext(context.Background(), name)
+}
+
+// LookupAllContext is like LookupAll but carries ctx to the lookups
+func (r *Resolver) LookupAllContext(ctx context.Context, name string) ([]Wallet, error) {
+	if r.DNS != nil {
+		return r.DNS.LookupAllContext(ctx, name)
+	}
+
+	currencies := r.Currencies
+	if len(currencies) == 0 {
+		currencies = DefaultLookupCurrencies
+	}
+
+	// The lookup API answers one currency per request, so ask for them
+	// together through a bounded pool of workers
+	requests := make([]LookupRequest, len(currencies))
+	for i, currency := range currencies {
+		requests[i] = LookupRequest{Name: name, Currency: currency}
+	}
+	results := (&BulkResolver{Resolver: r}).LookupContext(ctx, requests)
+
+	wallets := make([]Wallet, 0)
+	for i, result := range results {
+		if errors.Is(result.Err, ErrNotFound) {
+			continue
+		} else if result.Err != nil {
+			return nil, result.Err
+		}
+		wallets = append(wallets, Wallet{Currency: currencies[i], WalletAddress: result.Address})
+	}
+	if len(wallets) == 0 {
+		return nil, noAddressesError(name)
+	}
+	return wallets, nil
+}
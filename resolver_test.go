@@ -0,0 +1,63 @@
+package netki
+
+import (
+	"context"
+	"fmt"
+	"github.com/bmizerany/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResolverLookup(t *testing.T) {
+	var userAgent, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		path = r.URL.EscapedPath()
+		fmt.Fprint(w, `{"success":true,"wallet_address":"1btcaddress"}`)
+	}))
+	defer server.Close()
+
+	resolver := &Resolver{BaseURL: server.URL + "/lookup/", HTTPClient: server.Client()}
+	address, err := resolver.Lookup("my wallet.domain.com", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "1btcaddress", address)
+	assert.Equal(t, "/lookup/my%20wallet.domain.com/btc", path)
+	assert.Equal(t, DefaultUserAgent, userAgent)
+
+	resolver.UserAgent = "my-app/1.0"
+	resolver.Lookup("wallet.domain.com", "btc")
+	assert.Equal(t, "my-app/1.0", userAgent)
+}
+
+func TestResolverLookupErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow/btc":
+			time.Sleep(200 * time.Millisecond)
+		case "/garbage/btc":
+			fmt.Fprint(w, `not json`)
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	resolver := &Resolver{BaseURL: server.URL, HTTPClient: server.Client()}
+	_, err := resolver.Lookup("garbage", "btc")
+	assert.NotEqual(t, nil, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = resolver.LookupContext(ctx, "slow", "btc")
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+
+	resolver.HTTPClient = &http.Client{Timeout: 10 * time.Millisecond}
+	_, err = resolver.Lookup("slow", "btc")
+	assert.NotEqual(t, nil, err)
+
+	address, err := (&Resolver{BaseURL: server.URL}).Lookup("empty", "btc")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", address)
+}
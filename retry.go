@@ -0,0 +1,142 @@
+package netki
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how NetkiRequester retries failed requests.
+//
+// Transport failures and responses with one of RetryableStatusCodes are retried
+// with exponential backoff. GET, PUT and DELETE are idempotent and retried
+// whenever a policy is set; POST is only retried when RetryPOST is true.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry, growing by Multiplier
+	// on each further retry up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// Jitter randomizes each delay by up to this fraction (0.0 - 1.0) in either
+	// direction, never beyond MaxBackoff
+	Jitter float64
+
+	RetryableStatusCodes []int
+
+	// RetryPOST enables retries for POST requests, which may not be idempotent
+	RetryPOST bool
+
+	// RespectRetryAfter uses the server's Retry-After header, when present, as
+	// the delay, capped at MaxBackoff
+	RespectRetryAfter bool
+}
+
+// DefaultRetryPolicy returns a policy suited to transient partner API failures
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:          4,
+		InitialBackoff:       250 * time.Millisecond,
+		MaxBackoff:           10 * time.Second,
+		Multiplier:           2.0,
+		Jitter:               0.2,
+		RetryableStatusCodes: []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+		RespectRetryAfter:    true,
+	}
+}
+
+func (p *RetryPolicy) allowsMethod(method string) bool {
+	switch method {
+	case "GET", "PUT", "DELETE":
+		return true
+	case "POST":
+		return p.RetryPOST
+	}
+	return false
+}
+
+func (p *RetryPolicy) shouldRetry(resp *http.Response, err error) bool {
+	if p == nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	for _, code := range p.RetryableStatusCodes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before the attempt following attempt
+func (p *RetryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	if p.RespectRetryAfter && resp != nil {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if p.MaxBackoff > 0 && d > p.MaxBackoff {
+				d = p.MaxBackoff
+			}
+			return d
+		}
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (2*rand.Float64() - 1)
+	}
+	// Jitter must not push a capped delay past MaxBackoff
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if backoff < 0 {
+		return 0
+	}
+	return time.Duration(backoff)
+}
+
+// parseRetryAfter accepts both the delay-seconds and HTTP-date forms of Retry-After
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		d := time.Until(date)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,190 @@
+package netki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"github.com/bmizerany/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Setup a server that fails with failCode for the first failCount requests
+func setupFlakyHttp(failCount int, failCode int, headers http.Header) (*httptest.Server, *[]*http.Request) {
+	requests := make([]*http.Request, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if len(requests) <= failCount {
+			for k, v := range headers {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(failCode)
+			fmt.Fprintln(w, `{"success":false,"message":"Unavailable"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, `{"success":true,"message":"my message"}`)
+	}))
+	return server, &requests
+}
+
+func getTestRetryPolicy() *RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = 5 * time.Millisecond
+	return policy
+}
+
+func TestProcessRequestRetry(t *testing.T) {
+	server, requests := setupFlakyHttp(2, http.StatusServiceUnavailable, nil)
+	defer server.Close()
+
+	requester := &NetkiRequester{RetryPolicy: getTestRetryPolicy()}
+	result, err := requester.ProcessRequest(&NetkiPartner{ApiUrl: server.URL}, "/uri", "GET", "")
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(*requests))
+	assert.Equal(t, "my message", result.Get("message").MustString())
+}
+
+func TestProcessRequestRetryExhausted(t *testing.T) {
+	server, requests := setupFlakyHttp(10, http.StatusBadGateway, nil)
+	defer server.Close()
+
+	requester := &NetkiRequester{RetryPolicy: getTestRetryPolicy()}
+	_, err := requester.ProcessRequest(&NetkiPartner{ApiUrl: server.URL}, "/uri", "PUT", `{"a":1}`)
+
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, "Unavailable", err.Error())
+	assert.Equal(t, 4, len(*requests))
+}
+
+func TestProcessRequestRetryNoPolicy(t *testing.T) {
+	server, requests := setupFlakyHttp(1, http.StatusServiceUnavailable, nil)
+	defer server.Close()
+
+	requester := &NetkiRequester{}
+	_, err := requester.ProcessRequest(&NetkiPartner{ApiUrl: server.URL}, "/uri", "GET", "")
+
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, 1, len(*requests))
+}
+
+func TestProcessRequestRetryNonRetryableStatus(t *testing.T) {
+	server, requests := setupFlakyHttp(1, http.StatusBadRequest, nil)
+	defer server.Close()
+
+	requester := &NetkiRequester{RetryPolicy: getTestRetryPolicy()}
+	_, err := requester.ProcessRequest(&NetkiPartner{ApiUrl: server.URL}, "/uri", "GET", "")
+
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, 1, len(*requests))
+}
+
+func TestProcessRequestRetryPOST(t *testing.T) {
+	server, requests := setupFlakyHttp(1, http.StatusServiceUnavailable, nil)
+	defer server.Close()
+
+	requester := &NetkiRequester{RetryPolicy: getTestRetryPolicy()}
+	_, err := requester.ProcessRequest(&NetkiPartner{ApiUrl: server.URL}, "/uri", "POST", `{"a":1}`)
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, 1, len(*requests))
+
+	requester.RetryPolicy.RetryPOST = true
+	*requests = (*requests)[:0]
+	_, err = requester.ProcessRequest(&NetkiPartner{ApiUrl: server.URL}, "/uri", "POST", `{"a":1}`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(*requests))
+}
+
+func TestProcessRequestRetryTransportError(t *testing.T) {
+	server, _ := setupFlakyHttp(0, 0, nil)
+	serverUrl := server.URL
+	server.Close()
+
+	policy := getTestRetryPolicy()
+	policy.MaxAttempts = 2
+	requester := &NetkiRequester{RetryPolicy: policy}
+	_, err := requester.ProcessRequest(&NetkiPartner{ApiUrl: serverUrl}, "/uri", "GET", "")
+
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, "HTTP Request Failed", err.Error()[:19])
+}
+
+func TestProcessRequestRetryResigns(t *testing.T) {
+	server, requests := setupFlakyHttp(1, http.StatusServiceUnavailable, nil)
+	defer server.Close()
+
+	userKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	partnerKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	partner := &NetkiPartner{ApiUrl: server.URL, UserKey: userKey, KeySigningKey: &partnerKey.PublicKey, KeySignature: []byte("sig")}
+
+	requester := &NetkiRequester{RetryPolicy: getTestRetryPolicy()}
+	_, err := requester.ProcessRequest(partner, "/uri", "GET", "")
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(*requests))
+	assert.NotEqual(t, "", (*requests)[0].Header.Get("X-Signature"))
+	assert.NotEqual(t, (*requests)[0].Header.Get("X-Signature"), (*requests)[1].Header.Get("X-Signature"))
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2.0}
+
+	assert.Equal(t, 100*time.Millisecond, policy.delay(1, nil))
+	assert.Equal(t, 200*time.Millisecond, policy.delay(2, nil))
+	assert.Equal(t, 400*time.Millisecond, policy.delay(3, nil))
+	assert.Equal(t, time.Second, policy.delay(5, nil))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		d := policy.delay(1, nil)
+		assert.Equal(t, true, d >= 50*time.Millisecond && d <= 150*time.Millisecond)
+	}
+	for i := 0; i < 20; i++ {
+		d := policy.delay(10, nil)
+		assert.Equal(t, true, d >= 500*time.Millisecond && d <= time.Second)
+	}
+}
+
+func TestRetryPolicyDelayRetryAfter(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, RespectRetryAfter: true}
+	resp := &http.Response{Header: http.Header{}}
+
+	resp.Header.Set("Retry-After", "3")
+	assert.Equal(t, 3*time.Second, policy.delay(1, resp))
+
+	resp.Header.Set("Retry-After", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat))
+	assert.Equal(t, time.Duration(0), policy.delay(1, resp))
+
+	// A hostile Retry-After is capped at MaxBackoff
+	policy.MaxBackoff = 10 * time.Second
+	resp.Header.Set("Retry-After", "86400")
+	assert.Equal(t, 10*time.Second, policy.delay(1, resp))
+	resp.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	assert.Equal(t, 10*time.Second, policy.delay(1, resp))
+
+	resp.Header.Set("Retry-After", "garbage")
+	assert.Equal(t, 100*time.Millisecond, policy.delay(1, resp))
+
+	policy.RespectRetryAfter = false
+	resp.Header.Set("Retry-After", "3")
+	assert.Equal(t, 100*time.Millisecond, policy.delay(1, resp))
+}
+
+func TestProcessRequestRetryAfterHeader(t *testing.T) {
+	server, requests := setupFlakyHttp(1, http.StatusTooManyRequests, http.Header{"Retry-After": []string{"0"}})
+	defer server.Close()
+
+	policy := getTestRetryPolicy()
+	policy.InitialBackoff = time.Hour
+	policy.MaxBackoff = time.Hour
+	requester := &NetkiRequester{RetryPolicy: policy}
+	_, err := requester.ProcessRequest(&NetkiPartner{ApiUrl: server.URL}, "/uri", "GET", "")
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(*requests))
+}
@@ -0,0 +1,76 @@
+package netki
+
+import (
+	"context"
+	"github.com/bmizerany/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSigningSchemeString(t *testing.T) {
+	assert.Equal(t, "legacy", SigningSchemeLegacy.String())
+	assert.Equal(t, "v2", SigningSchemeV2.String())
+	assert.Equal(t, "SigningScheme(7)", SigningScheme(7).String())
+}
+
+func TestSignRequestV2(t *testing.T) {
+	userKey := getTestUserKey(t)
+	timestamp := time.Unix(1700000000, 0)
+
+	sig, err := NetkiRequester{}.SignRequestV2("delete", "http://localhost:5000/v1/partner/walletname", "{}", timestamp, "abcd", userKey)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, VerifyRequestSignatureV2("DELETE", "http://localhost:5000/v1/partner/walletname", "{}", timestamp, "abcd", &userKey.PublicKey, sig))
+
+	assert.NotEqual(t, nil, VerifyRequestSignatureV2("GET", "http://localhost:5000/v1/partner/walletname", "{}", timestamp, "abcd", &userKey.PublicKey, sig))
+	assert.NotEqual(t, nil, VerifyRequestSignatureV2("DELETE", "http://localhost:5000/v1/partner/walletname", "{}", timestamp.Add(time.Second), "abcd", &userKey.PublicKey, sig))
+	assert.NotEqual(t, nil, VerifyRequestSignatureV2("DELETE", "http://localhost:5000/v1/partner/walletname", "{}", timestamp, "abce", &userKey.PublicKey, sig))
+
+	// The legacy scheme does not accept a V2 signature
+	assert.NotEqual(t, nil, VerifyRequestSignature("http://localhost:5000/v1/partner/walletname", "{}", &userKey.PublicKey, sig))
+}
+
+func TestNewRequestSigningSchemeV2(t *testing.T) {
+	_, partner := getSignedPartner(t, "http://localhost:5000")
+	partner.SigningScheme = SigningSchemeV2
+
+	before := time.Now().Unix()
+	req, err := NetkiRequester{}.newRequest(context.Background(), partner, "http://localhost:5000/v1/partner/domain", "GET", "")
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, "2", req.Header.Get("X-Signature-Version"))
+	assert.Equal(t, 32, len(req.Header.Get("X-Signature-Nonce")))
+	timestamp, err := strconv.ParseInt(req.Header.Get("X-Signature-Timestamp"), 10, 64)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, timestamp >= before && timestamp <= time.Now().Unix())
+	assert.Equal(t, nil, VerifyRequestSignatureV2("GET", "http://localhost:5000/v1/partner/domain", "", time.Unix(timestamp, 0), req.Header.Get("X-Signature-Nonce"), &getTestUserKey(t).PublicKey, req.Header.Get("X-Signature")))
+
+	again, _ := NetkiRequester{}.newRequest(context.Background(), partner, "http://localhost:5000/v1/partner/domain", "GET", "")
+	assert.NotEqual(t, req.Header.Get("X-Signature-Nonce"), again.Header.Get("X-Signature-Nonce"))
+
+	partner.SigningScheme = SigningSchemeLegacy
+	legacy, _ := NetkiRequester{}.newRequest(context.Background(), partner, "http://localhost:5000/v1/partner/domain", "GET", "")
+	assert.Equal(t, "", legacy.Header.Get("X-Signature-Version"))
+	assert.Equal(t, "", legacy.Header.Get("X-Signature-Nonce"))
+}
+
+func TestMemoryNonceCache(t *testing.T) {
+	cache := NewMemoryNonceCache()
+	expires := time.Now().Add(time.Minute)
+
+	assert.Equal(t, true, cache.Add("a", expires))
+	assert.Equal(t, false, cache.Add("a", expires))
+	assert.Equal(t, true, cache.Add("b", expires))
+
+	// Expired entries may be reused and are pruned
+	assert.Equal(t, true, cache.Add("old", time.Now().Add(-time.Second)))
+	assert.Equal(t, true, cache.Add("old", expires))
+	cache.nextPrune = time.Time{}
+	cache.Add("c", time.Now().Add(-time.Second))
+	cache.nextPrune = time.Time{}
+	cache.Add("d", expires)
+	assert.Equal(t, 4, cache.Len())
+
+	var zero MemoryNonceCache
+	assert.Equal(t, true, zero.Add("a", expires))
+}
@@ -0,0 +1,289 @@
+package netki
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidSignature is matched by every SignatureError
+var ErrInvalidSignature = errors.New("netki: invalid request signature")
+
+// DefaultMaxSignedBodySize caps the request body a SignatureVerifier reads
+const DefaultMaxSignedBodySize = 10 << 20
+
+// DefaultMaxClockSkew is how far a SigningSchemeV2 timestamp may be from the verifier's clock
+const DefaultMaxClockSkew = 5 * time.Minute
+
+// SignatureError is returned when a key-signed request fails verification
+type SignatureError struct {
+	Reason string
+	Err    error
+}
+
+func (e *SignatureError) Error() string {
+	var buffer bytes.Buffer
+	buffer.WriteString("Invalid Request Signature: ")
+	buffer.WriteString(e.Reason)
+	if e.Err != nil {
+		buffer.WriteString(": ")
+		buffer.WriteString(e.Err.Error())
+	}
+	return buffer.String()
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+func (e *SignatureError) Is(target error) bool {
+	return target == ErrInvalidSignature
+}
+
+// VerifiedIdentity is the user behind a request that passed verification
+type VerifiedIdentity struct {
+	// Identity is the hex encoded user public key as sent in X-Identity
+	Identity      string
+	UserKey       *ecdsa.PublicKey
+	KeySigningKey *ecdsa.PublicKey
+	KeySignature  []byte
+
+	// Scheme is the scheme the request was signed with. Timestamp and Nonce
+	// are only set for SigningSchemeV2.
+	Scheme    SigningScheme
+	Timestamp time.Time
+	Nonce     string
+}
+
+type identityContextKey struct{}
+
+// IdentityFromContext returns the identity stored by SignatureVerifier.Middleware
+func IdentityFromContext(ctx context.Context) (*VerifiedIdentity, bool) {
+	identity, ok := ctx.Value(identityContextKey{}).(*VerifiedIdentity)
+	return identity, ok
+}
+
+// VerifyRequestSignature checks a hex encoded signature produced by
+// NetkiRequester.SignRequest over requestUrl and bodyData.
+func VerifyRequestSignature(requestUrl string, bodyData string, userKey *ecdsa.PublicKey, signature string) error {
+	sig, err := hex.DecodeString(signature)
+	if err != nil {
+		return &SignatureError{Reason: "malformed X-Signature header", Err: err}
+	}
+
+	signDataHash := sha256.Sum256([]byte(requestUrl + bodyData))
+	if !ecdsa.VerifyASN1(userKey, signDataHash[:], sig) {
+		return &SignatureError{Reason: "signature does not match request"}
+	}
+	return nil
+}
+
+// VerifyRequestSignatureV2 checks a hex encoded signature produced by
+// NetkiRequester.SignRequestV2. It does not check the timestamp or nonce.
+func VerifyRequestSignatureV2(method string, requestUrl string, bodyData string, timestamp time.Time, nonce string, userKey *ecdsa.PublicKey, signature string) error {
+	return VerifyRequestSignature(signingMaterialV2(method, requestUrl, bodyData, formatTimestamp(timestamp), nonce), "", userKey, signature)
+}
+
+// SignatureVerifier validates requests signed by key-signed remote partners:
+// a trusted key signing key must have signed the user key, and the user key
+// must have signed the request URL and body.
+type SignatureVerifier struct {
+	// KeySigningKeys are the partner keys trusted to sign user keys
+	KeySigningKeys []*ecdsa.PublicKey
+
+	// BaseURL is the API URL clients are configured with. The signed URL is
+	// BaseURL followed by the request URI; when empty it is rebuilt from the
+	// request's scheme and Host.
+	BaseURL string
+
+	// MaxBodySize caps the body read for verification, DefaultMaxSignedBodySize when zero
+	MaxBodySize int64
+
+	// RequireReplayProtection rejects requests signed with SigningSchemeLegacy
+	RequireReplayProtection bool
+
+	// MaxClockSkew bounds the age of SigningSchemeV2 timestamps, DefaultMaxClockSkew when zero
+	MaxClockSkew time.Duration
+
+	// Nonces rejects reused SigningSchemeV2 nonces. Nonces are not tracked when nil.
+	Nonces NonceCache
+
+	// Now returns the current time, time.Now when nil
+	Now func() time.Time
+
+	// ErrorHandler writes the response for rejected requests, a 401 JSON
+	// error in the API's format when nil
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// NewSignatureVerifier creates a verifier trusting the given key signing keys,
+// tracking nonces in a MemoryNonceCache
+func NewSignatureVerifier(keySigningKeys ...*ecdsa.PublicKey) *SignatureVerifier {
+	return &SignatureVerifier{KeySigningKeys: keySigningKeys, Nonces: NewMemoryNonceCache()}
+}
+
+// Verify checks the signature chain of r. The body is read and replaced, so
+// it can still be read by the caller afterwards.
+func (v *SignatureVerifier) Verify(r *http.Request) (*VerifiedIdentity, error) {
+	headers := []string{"X-Identity", "X-Signature", "X-Partner-Key", "X-Partner-KeySig"}
+	for _, header := range headers {
+		if r.Header.Get(header) == "" {
+			return nil, &SignatureError{Reason: "missing " + header + " header"}
+		}
+	}
+
+	identity := &VerifiedIdentity{Identity: r.Header.Get("X-Identity")}
+	var err error
+	if identity.UserKey, err = parseECPublicKey([]byte(identity.Identity), "X-Identity"); err != nil {
+		return nil, &SignatureError{Reason: "malformed X-Identity header", Err: err}
+	}
+	if identity.KeySigningKey, err = parseECPublicKey([]byte(r.Header.Get("X-Partner-Key")), "X-Partner-Key"); err != nil {
+		return nil, &SignatureError{Reason: "malformed X-Partner-Key header", Err: err}
+	}
+	if identity.KeySignature, err = hex.DecodeString(r.Header.Get("X-Partner-KeySig")); err != nil {
+		return nil, &SignatureError{Reason: "malformed X-Partner-KeySig header", Err: err}
+	}
+
+	if !v.trusted(identity.KeySigningKey) {
+		return nil, &SignatureError{Reason: "untrusted key signing key"}
+	}
+	if err := VerifyKeySignature(identity.KeySigningKey, identity.UserKey, identity.KeySignature); err != nil {
+		return nil, &SignatureError{Reason: "key signature does not match user key", Err: err}
+	}
+
+	body, err := v.readBody(r)
+	if err != nil {
+		return nil, err
+	}
+	switch version := r.Header.Get("X-Signature-Version"); version {
+	case "":
+		if v.RequireReplayProtection {
+			return nil, &SignatureError{Reason: "legacy signatures are not accepted"}
+		}
+		if err := VerifyRequestSignature(v.requestUrl(r), string(body), identity.UserKey, r.Header.Get("X-Signature")); err != nil {
+			return nil, err
+		}
+	case signingSchemeV2Header:
+		if err := v.verifyV2(r, string(body), identity); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &SignatureError{Reason: "unsupported signature version " + strconv.Quote(version)}
+	}
+
+	return identity, nil
+}
+
+// verifyV2 checks a SigningSchemeV2 signature, its timestamp window and nonce
+func (v *SignatureVerifier) verifyV2(r *http.Request, bodyData string, identity *VerifiedIdentity) error {
+	identity.Scheme = SigningSchemeV2
+	identity.Nonce = r.Header.Get("X-Signature-Nonce")
+	if identity.Nonce == "" {
+		return &SignatureError{Reason: "missing X-Signature-Nonce header"}
+	}
+	if len(identity.Nonce) > 4*nonceSize {
+		return &SignatureError{Reason: "malformed X-Signature-Nonce header"}
+	}
+	seconds, err := strconv.ParseInt(r.Header.Get("X-Signature-Timestamp"), 10, 64)
+	if err != nil {
+		return &SignatureError{Reason: "malformed X-Signature-Timestamp header", Err: err}
+	}
+	identity.Timestamp = time.Unix(seconds, 0)
+
+	maxClockSkew := v.MaxClockSkew
+	if maxClockSkew <= 0 {
+		maxClockSkew = DefaultMaxClockSkew
+	}
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	if identity.Timestamp.Before(now.Add(-maxClockSkew)) || identity.Timestamp.After(now.Add(maxClockSkew)) {
+		return &SignatureError{Reason: "timestamp outside allowed window"}
+	}
+
+	if err := VerifyRequestSignatureV2(r.Method, v.requestUrl(r), bodyData, identity.Timestamp, identity.Nonce, identity.UserKey, r.Header.Get("X-Signature")); err != nil {
+		return err
+	}
+
+	// Only record nonces of authentic requests so they cannot be spent by others
+	if v.Nonces != nil && !v.Nonces.Add(identity.Identity+":"+identity.Nonce, identity.Timestamp.Add(maxClockSkew)) {
+		return &SignatureError{Reason: "nonce has already been used"}
+	}
+	return nil
+}
+
+// Middleware rejects requests that fail Verify and passes the rest to next
+// with the VerifiedIdentity in the request context.
+func (v *SignatureVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, err := v.Verify(r)
+		if err != nil {
+			if v.ErrorHandler != nil {
+				v.ErrorHandler(w, r, err)
+			} else {
+				writeSignatureError(w, err)
+			}
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityContextKey{}, identity)))
+	})
+}
+
+func (v *SignatureVerifier) trusted(keySigningKey *ecdsa.PublicKey) bool {
+	for _, trusted := range v.KeySigningKeys {
+		if trusted != nil && trusted.Equal(keySigningKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestUrl rebuilds the URL the client signed, mirroring NetkiRequester.send
+func (v *SignatureVerifier) requestUrl(r *http.Request) string {
+	if v.BaseURL != "" {
+		return v.BaseURL + r.URL.RequestURI()
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+func (v *SignatureVerifier) readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return []byte{}, nil
+	}
+
+	maxBodySize := v.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxSignedBodySize
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return nil, &SignatureError{Reason: "unable to read request body", Err: err}
+	}
+	if int64(len(body)) > maxBodySize {
+		return nil, &SignatureError{Reason: "request body too large"}
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func writeSignatureError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(ResponseStatus{Success: false, Message: err.Error()})
+}
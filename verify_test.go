@@ -0,0 +1,239 @@
+package netki
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bmizerany/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setupVerifiedHttp(verifier *SignatureVerifier) *httptest.Server {
+	return httptest.NewServer(verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := IdentityFromContext(r.Context())
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"success":%t,"identity":%q,"body":%q}`, ok, identity.Identity, body)
+	})))
+}
+
+func getSignedPartner(t *testing.T, apiUrl string) (*ecdsa.PrivateKey, *NetkiPartner) {
+	partnerKey, cred := getTestCredential(t)
+	partner, err := cred.NewPartner(apiUrl, getTestUserKey(t))
+	assert.Equal(t, nil, err)
+	partner.Requester = &NetkiRequester{}
+	return partnerKey, partner
+}
+
+func TestSignatureVerifierMiddleware(t *testing.T) {
+	verifier := NewSignatureVerifier()
+	server := setupVerifiedHttp(verifier)
+	defer server.Close()
+
+	partnerKey, partner := getSignedPartner(t, server.URL)
+	verifier.KeySigningKeys = append(verifier.KeySigningKeys, &partnerKey.PublicKey)
+
+	js, err := partner.Requester.ProcessRequest(partner, "/v1/partner/walletname?domain_name=domain.com", "POST", `{"name":"wallet"}`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, partner.GetUserPublicKey(), js.Get("identity").MustString())
+	assert.Equal(t, `{"name":"wallet"}`, js.Get("body").MustString())
+
+	js, err = partner.Requester.ProcessRequest(partner, "/v1/partner/walletname", "GET", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", js.Get("body").MustString())
+}
+
+func TestSignatureVerifierBaseURL(t *testing.T) {
+	verifier := NewSignatureVerifier()
+	verifier.BaseURL = "https://proxy.example.com/api"
+	server := setupVerifiedHttp(verifier)
+	defer server.Close()
+
+	partnerKey, partner := getSignedPartner(t, verifier.BaseURL)
+	verifier.KeySigningKeys = append(verifier.KeySigningKeys, &partnerKey.PublicKey)
+
+	req, err := NetkiRequester{}.newRequest(context.Background(), partner, verifier.BaseURL+"/v1/partner/domain", "GET", "")
+	assert.Equal(t, nil, err)
+	req.URL.Path = "/v1/partner/domain"
+	req.Host = "internal:8080"
+
+	_, err = verifier.Verify(req)
+	assert.Equal(t, nil, err)
+}
+
+func TestSignatureVerifierRejects(t *testing.T) {
+	partnerKey, partner := getSignedPartner(t, "http://api.example.com")
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	verifier := NewSignatureVerifier(&partnerKey.PublicKey)
+
+	newSigned := func() *http.Request {
+		req, err := NetkiRequester{}.newRequest(context.Background(), partner, "http://api.example.com/v1/partner/walletname", "POST", `{"name":"wallet"}`)
+		assert.Equal(t, nil, err)
+		return req
+	}
+
+	req := newSigned()
+	identity, err := verifier.Verify(req)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, identity.UserKey.Equal(&getTestUserKey(t).PublicKey))
+	body, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, `{"name":"wallet"}`, string(body))
+
+	req = newSigned()
+	req.Body = ioutil.NopCloser(strings.NewReader(`{"name":"tampered"}`))
+	_, err = verifier.Verify(req)
+	assert.Equal(t, "Invalid Request Signature: signature does not match request", err.Error())
+
+	req = newSigned()
+	req.URL.Path = "/v1/partner/domain"
+	_, err = verifier.Verify(req)
+	assert.Equal(t, true, errors.Is(err, ErrInvalidSignature))
+
+	req = newSigned()
+	req.Header.Del("X-Signature")
+	_, err = verifier.Verify(req)
+	assert.Equal(t, "Invalid Request Signature: missing X-Signature header", err.Error())
+
+	req = newSigned()
+	req.Header.Set("X-Partner-KeySig", "zz")
+	_, err = verifier.Verify(req)
+	assert.Equal(t, true, strings.HasPrefix(err.Error(), "Invalid Request Signature: malformed X-Partner-KeySig header"))
+
+	otherSig, _ := SignUserKey(otherKey, &getTestUserKey(t).PublicKey)
+	req = newSigned()
+	req.Header.Set("X-Partner-KeySig", fmt.Sprintf("%x", otherSig))
+	_, err = verifier.Verify(req)
+	assert.Equal(t, "Invalid Request Signature: key signature does not match user key: netki: invalid key signature", err.Error())
+
+	req = newSigned()
+	_, err = NewSignatureVerifier(&otherKey.PublicKey).Verify(req)
+	assert.Equal(t, "Invalid Request Signature: untrusted key signing key", err.Error())
+
+	req = newSigned()
+	_, err = (&SignatureVerifier{KeySigningKeys: verifier.KeySigningKeys, MaxBodySize: 4}).Verify(req)
+	assert.Equal(t, "Invalid Request Signature: request body too large", err.Error())
+}
+
+func TestSignatureVerifierMiddlewareError(t *testing.T) {
+	partnerKey, partner := getSignedPartner(t, "http://api.example.com")
+	verifier := NewSignatureVerifier(&partnerKey.PublicKey)
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler called for rejected request")
+	}))
+
+	req, _ := NetkiRequester{}.newRequest(context.Background(), partner, "http://api.example.com/v1/partner/walletname", "POST", `{"name":"wallet"}`)
+	req.Body = ioutil.NopCloser(strings.NewReader(`{}`))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	status := ResponseStatus{}
+	json.Unmarshal(recorder.Body.Bytes(), &status)
+	assert.Equal(t, false, status.Success)
+	assert.Equal(t, "Invalid Request Signature: signature does not match request", status.Message)
+
+	var handled error
+	verifier.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		w.WriteHeader(http.StatusForbidden)
+	}
+	req, _ = NetkiRequester{}.newRequest(context.Background(), partner, "http://api.example.com/v1/partner/walletname", "GET", "")
+	req.Header.Del("X-Identity")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Equal(t, true, errors.Is(handled, ErrInvalidSignature))
+}
+
+func TestSignatureVerifierSchemeV2(t *testing.T) {
+	verifier := NewSignatureVerifier()
+	server := setupVerifiedHttp(verifier)
+	defer server.Close()
+
+	partnerKey, partner := getSignedPartner(t, server.URL)
+	partner.SigningScheme = SigningSchemeV2
+	verifier.KeySigningKeys = append(verifier.KeySigningKeys, &partnerKey.PublicKey)
+	verifier.RequireReplayProtection = true
+
+	js, err := partner.Requester.ProcessRequest(partner, "/v1/partner/walletname", "POST", `{"name":"wallet"}`)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `{"name":"wallet"}`, js.Get("body").MustString())
+
+	partner.SigningScheme = SigningSchemeLegacy
+	_, err = partner.Requester.ProcessRequest(partner, "/v1/partner/walletname", "GET", "")
+	assert.Equal(t, true, errors.Is(err, ErrUnauthorized))
+	assert.Equal(t, "Invalid Request Signature: legacy signatures are not accepted", err.Error())
+}
+
+func TestSignatureVerifierSchemeV2Rejects(t *testing.T) {
+	partnerKey, partner := getSignedPartner(t, "http://api.example.com")
+	partner.SigningScheme = SigningSchemeV2
+	verifier := NewSignatureVerifier(&partnerKey.PublicKey)
+
+	newSigned := func() *http.Request {
+		req, err := NetkiRequester{}.newRequest(context.Background(), partner, "http://api.example.com/v1/partner/walletname", "DELETE", `{}`)
+		assert.Equal(t, nil, err)
+		return req
+	}
+
+	req := newSigned()
+	replay := req.Clone(context.Background())
+	replay.Body = ioutil.NopCloser(strings.NewReader(`{}`))
+	identity, err := verifier.Verify(req)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, SigningSchemeV2, identity.Scheme)
+	assert.Equal(t, req.Header.Get("X-Signature-Nonce"), identity.Nonce)
+	_, err = verifier.Verify(replay)
+	assert.Equal(t, "Invalid Request Signature: nonce has already been used", err.Error())
+
+	req = newSigned()
+	req.Method = "GET"
+	_, err = verifier.Verify(req)
+	assert.Equal(t, "Invalid Request Signature: signature does not match request", err.Error())
+
+	req = newSigned()
+	req.Header.Set("X-Signature-Nonce", "00")
+	_, err = verifier.Verify(req)
+	assert.Equal(t, "Invalid Request Signature: signature does not match request", err.Error())
+
+	req = newSigned()
+	req.Header.Del("X-Signature-Nonce")
+	_, err = verifier.Verify(req)
+	assert.Equal(t, "Invalid Request Signature: missing X-Signature-Nonce header", err.Error())
+
+	req = newSigned()
+	req.Header.Set("X-Signature-Timestamp", "soon")
+	_, err = verifier.Verify(req)
+	assert.Equal(t, true, strings.HasPrefix(err.Error(), "Invalid Request Signature: malformed X-Signature-Timestamp header"))
+
+	req = newSigned()
+	req.Header.Set("X-Signature-Version", "3")
+	_, err = verifier.Verify(req)
+	assert.Equal(t, `Invalid Request Signature: unsupported signature version "3"`, err.Error())
+
+	late := &SignatureVerifier{KeySigningKeys: verifier.KeySigningKeys, MaxClockSkew: time.Minute, Now: func() time.Time { return time.Now().Add(2 * time.Minute) }}
+	_, err = late.Verify(newSigned())
+	assert.Equal(t, "Invalid Request Signature: timestamp outside allowed window", err.Error())
+	late.Now = func() time.Time { return time.Now().Add(-2 * time.Minute) }
+	_, err = late.Verify(newSigned())
+	assert.Equal(t, "Invalid Request Signature: timestamp outside allowed window", err.Error())
+
+	// Without a nonce cache only the window protects against replays
+	noCache := &SignatureVerifier{KeySigningKeys: verifier.KeySigningKeys}
+	req = newSigned()
+	replay = req.Clone(context.Background())
+	replay.Body = ioutil.NopCloser(strings.NewReader(`{}`))
+	_, err = noCache.Verify(req)
+	assert.Equal(t, nil, err)
+	_, err = noCache.Verify(replay)
+	assert.Equal(t, nil, err)
+}